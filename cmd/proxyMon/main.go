@@ -2,8 +2,11 @@ package main
 
 import (
 	"AI-Sid/monitor/internal/tools"
+	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"time"
 )
 
 import _ "AI-Sid/monitor/cmd/proxyMon/resources"
@@ -12,6 +15,14 @@ import _ "AI-Sid/monitor/cmd/proxyMon/resources"
 var Build = "false"
 
 var startFlag, stopFlag, quitFlag bool
+var configPath, outPath, reasonText string
+var instanceName, namespaceName string
+var installEventSource, removeEventSource bool
+var historyFlag, jsonFlag, importFlag, verifyFlag, decryptFlag bool
+var reportFlag, htmlFlag, statusFlag, followFlag bool
+var reportPeriod string
+var historyArgs tools.HistoryArgs
+var controlTimeout, pauseDuration time.Duration
 
 func usage() {
 	flag.PrintDefaults()
@@ -25,13 +36,113 @@ func init() {
 	flag.BoolVar(&startFlag, "start", false, "Option for start Proxy Settings monitoring")
 	flag.BoolVar(&stopFlag, "stop", false, "Option for stop Proxy Settings monitoring")
 	flag.BoolVar(&quitFlag, "quit", false, "Option for quit Proxy Settings monitor")
+	flag.DurationVar(&pauseDuration, "pause", 0, "Pause Proxy Settings monitoring of the main instance for the duration (\"30m\", \"2h\"), it is resumed automatically")
+	flag.StringVar(&reasonText, "reason", "", "With -start, -stop, -pause or -quit: reason written to the log of the main instance")
+	flag.DurationVar(&controlTimeout, "timeout", tools.CONTROL_TIMEOUT, "Time to wait for the main instance to confirm -start, -stop, -quit or answer -status")
+	flag.StringVar(&instanceName, "instance", "", "Name of independent monitor instance, its files are in %APPDATA%/appname/<name> (default - the main monitor)")
+	flag.StringVar(&namespaceName, "namespace", "global", "Namespace of the instance: global (one per machine) or local (one per terminal session)")
+	flag.StringVar(&configPath, "config", "", "Path to JSON config file (default %APPDATA%/appname/appname.json, see -instance)")
+	flag.BoolVar(&installEventSource, "install-eventsource", false, "Register proxyMon event source in Windows Event Log (administrator rights required)")
+	flag.BoolVar(&removeEventSource, "remove-eventsource", false, "Remove proxyMon event source from Windows Event Log (administrator rights required)")
+	flag.BoolVar(&historyFlag, "history", false, "Print change history (see -since, -until, -source, -at)")
+	flag.StringVar(&historyArgs.Since, "since", "", "Start of period: \"2006-01-02 15:04\", \"15:04\" (today) or duration back from now (\"24h\", \"7d\")")
+	flag.StringVar(&historyArgs.Until, "until", "", "End of period, same formats as -since")
+	flag.StringVar(&historyArgs.Source, "source", "", "Settings source filter (HKCU)")
+	flag.StringVar(&historyArgs.At, "at", "", "With -history: print proxy settings at the moment, same formats as -since")
+	flag.BoolVar(&statusFlag, "status", false, "Print state of the main instance (see -json)")
+	flag.BoolVar(&followFlag, "follow", false, "Print events of the main instance as they happen (see -json, -source)")
+	flag.BoolVar(&jsonFlag, "json", false, "Print command output as JSON")
+	flag.BoolVar(&verifyFlag, "verify-log", false, "Verify hash chain of log files given as arguments (default - appname.log and rotated files)")
+	flag.BoolVar(&decryptFlag, "decrypt-log", false, "Print decrypted records of log files given as arguments (default - appname.log and rotated files)")
+	flag.BoolVar(&reportFlag, "report", false, "Print summary of history per period (see -period, -since, -until, -source, -html, -out)")
+	flag.StringVar(&reportPeriod, "period", "day", "With -report: period of summary, day or week")
+	flag.BoolVar(&htmlFlag, "html", false, "With -report: HTML page with timeline instead of text")
+	flag.StringVar(&outPath, "out", "", "With -decrypt-log or -report: output file (default - console)")
+	flag.BoolVar(&importFlag, "import-log", false, "Import text logs given as arguments (default - appname.log and rotated files) into history")
 	flag.Parse()
 }
 
 const welcome = "Proxy Settings Monitor v.1.0"
 
 func main() {
-	fmt.Printf("Build mode: %v\n", Build)
+	if !jsonFlag { // JSON output is parsed by scripts
+		fmt.Printf("Build mode: %v\n", Build)
+	}
+	if err := tools.SetInstance(instanceName, namespaceName); err != nil {
+		fmt.Printf("Instance error: %v\n", err)
+		os.Exit(tools.EXIT_ERROR)
+	}
+	if err := tools.LoadConfig(configPath); err != nil {
+		fmt.Printf("Config error: %v (default settings are used)\n", err)
+	}
+	if installEventSource || removeEventSource {
+		if err := tools.RegisterEventSource(installEventSource); err != nil {
+			fmt.Printf("Event source registration error: %v\n", err)
+		} else {
+			fmt.Println("Event source registration updated")
+		}
+		return
+	}
+	if verifyFlag {
+		ok, err := tools.RunVerifyCommand(flag.Args())
+		if err != nil {
+			fmt.Printf("Verification error: %v\n", err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+	if decryptFlag {
+		if err := tools.RunDecryptCommand(flag.Args(), outPath); err != nil {
+			fmt.Printf("Decryption error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if importFlag {
+		if err := tools.RunImportCommand(flag.Args()); err != nil {
+			fmt.Printf("Import error: %v\n", err)
+		}
+		return
+	}
+	if statusFlag {
+		if err := tools.RunStatusCommand(jsonFlag, controlTimeout); err != nil {
+			fmt.Printf("Status error: %v\n", err)
+			os.Exit(tools.ExitCode(err))
+		}
+		return
+	}
+	if followFlag {
+		if err := tools.RunFollowCommand(historyArgs.Source, jsonFlag, controlTimeout); err != nil {
+			fmt.Printf("Follow error: %v\n", err)
+			os.Exit(tools.ExitCode(err))
+		}
+		return
+	}
+	if reportFlag {
+		args := tools.ReportArgs{Since: historyArgs.Since, Until: historyArgs.Until, Source: historyArgs.Source,
+			Period: reportPeriod, HTML: htmlFlag, Out: outPath}
+		if err := tools.RunReportCommand(args); err != nil {
+			fmt.Printf("Report error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if historyFlag {
+		historyArgs.JSON = jsonFlag
+		if err := tools.RunHistoryCommand(historyArgs); err != nil {
+			fmt.Printf("History error: %v\n", err)
+		}
+		return
+	}
+	if pauseDuration != 0 {
+		err := tools.SendPause(pauseDuration, reasonText, controlTimeout)
+		if err != nil {
+			fmt.Printf("Action %v error: %v\n", tools.ActionsDisplay[tools.ACTION_PAUSE], err)
+		}
+		os.Exit(tools.ExitCode(err))
+	}
 	action := tools.ACTION_NONE
 	if quitFlag {
 		action = tools.ACTION_QUIT
@@ -40,23 +151,32 @@ func main() {
 	} else if startFlag {
 		action = tools.ACTION_START
 	}
+	code := tools.EXIT_OK
 	if tools.InitializeControl(action) { // primary instance
 		if action != tools.ACTION_QUIT {
 			tools.RunTray()
 		} else {
             fmt.Printf("%v\nInstance closed by -quit flag is set.\n", welcome)
+            code = tools.EXIT_NO_PRIMARY
         }
 	} else if tools.IsNormalState() { // secondary instance
         fmt.Printf("%v (secondary)\n", welcome)
         if action == tools.ACTION_NONE {
             fmt.Println("Can't change main instance state because no flags is set")
         } else {
-            if tools.SendAction(action) {
-                fmt.Printf("Action %v sent successfully", tools.ActionsDisplay[action])
+            err := tools.SendAction(action, reasonText, controlTimeout)
+            if err == nil {
+                fmt.Printf("Action %v confirmed by main instance\n", tools.ActionsDisplay[action])
+            } else if errors.Is(err, tools.ErrNotConfirmed) {
+                fmt.Printf("Action %v sent: %v\n", tools.ActionsDisplay[action], err)
             } else {
-                fmt.Printf("Action %v sent with error", tools.ActionsDisplay[action])
+                fmt.Printf("Action %v error: %v\n", tools.ActionsDisplay[action], err)
             }
+            code = tools.ExitCode(err)
         }
+	} else {
+		code = tools.EXIT_FAILED
 	}
 	tools.DoExitProgram()
+	os.Exit(code)
 }
@@ -0,0 +1,82 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+type Client struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+	enc     *json.Encoder
+	lastID  uint64
+	Timeout time.Duration // of every call, 0 - without timeout
+}
+
+// Dial connects to the primary instance, ErrNotRunning is returned if it does not listen
+func Dial(transport Transport, name string, timeout time.Duration) (*Client, error) {
+	if transport == nil {
+		return nil, fmt.Errorf("control channel is not supported")
+	}
+	conn, err := transport.Dial(name, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+func NewClient(conn net.Conn) *Client {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxMessageSize)
+	return &Client{conn: conn, scanner: scanner, enc: json.NewEncoder(conn)}
+}
+
+// Call sends the command and decodes the result, a failed command returns *Error
+func (v *Client) Call(command string, args, result any) error {
+	req, err := NewRequest(command, args)
+	if err != nil {
+		return err
+	}
+	v.lastID++
+	req.ID = v.lastID
+	if v.Timeout > 0 {
+		v.conn.SetDeadline(time.Now().Add(v.Timeout))
+		defer v.conn.SetDeadline(time.Time{})
+	}
+	if err := v.enc.Encode(req); err != nil {
+		return err
+	}
+	for {
+		resp, err := v.Receive()
+		if err != nil {
+			return err
+		}
+		// responses of other requests (e.g. after timeout of the previous call) are skipped
+		if resp.ID == req.ID {
+			return resp.Decode(result)
+		}
+	}
+}
+
+// Receive reads the next message of the server
+func (v *Client) Receive() (*Response, error) {
+	if !v.scanner.Scan() {
+		if err := v.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	var resp Response
+	if err := json.Unmarshal(v.scanner.Bytes(), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (v *Client) Close() error {
+	return v.conn.Close()
+}
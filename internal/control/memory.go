@@ -0,0 +1,95 @@
+package control
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// MemoryTransport connects clients and servers of one process by net.Pipe,
+// it lets the protocol be used without system objects
+type MemoryTransport struct {
+	mutex     sync.Mutex
+	listeners map[string]*memoryListener
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{listeners: make(map[string]*memoryListener)}
+}
+
+func (v *MemoryTransport) Listen(name string) (net.Listener, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if _, ok := v.listeners[name]; ok {
+		return nil, &net.OpError{Op: "listen", Net: "memory", Addr: nameAddr{"memory", name}, Err: errAddressInUse}
+	}
+	l := &memoryListener{owner: v, name: name, conns: make(chan net.Conn), done: make(chan struct{})}
+	v.listeners[name] = l
+	return l, nil
+}
+
+func (v *MemoryTransport) Dial(name string, timeout time.Duration) (net.Conn, error) {
+	v.mutex.Lock()
+	l := v.listeners[name]
+	v.mutex.Unlock()
+	if l == nil {
+		return nil, ErrNotRunning
+	}
+	client, server := net.Pipe()
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, ErrNotRunning
+	case <-expired:
+		return nil, &net.OpError{Op: "dial", Net: "memory", Addr: l.Addr(), Err: errTimeout}
+	}
+}
+
+type memoryError string
+
+func (v memoryError) Error() string   { return string(v) }
+func (v memoryError) Timeout() bool   { return v == errTimeout }
+func (v memoryError) Temporary() bool { return false }
+
+const (
+	errAddressInUse memoryError = "address in use"
+	errTimeout      memoryError = "i/o timeout"
+)
+
+type memoryListener struct {
+	owner *MemoryTransport
+	name  string
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (v *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-v.conns:
+		return conn, nil
+	case <-v.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (v *memoryListener) Close() error {
+	v.once.Do(func() {
+		close(v.done)
+		v.owner.mutex.Lock()
+		delete(v.owner.listeners, v.name)
+		v.owner.mutex.Unlock()
+	})
+	return nil
+}
+
+func (v *memoryListener) Addr() net.Addr {
+	return nameAddr{"memory", v.name}
+}
@@ -0,0 +1,39 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrPeerUnknown is returned for connections which can't tell their client (e.g. in memory)
+var ErrPeerUnknown = errors.New("client process is unknown")
+
+// Peer is the client process of a connection, fields which can't be determined are empty.
+// User is taken from the connection and can be used for access checks. Image is found by PID after
+// the connection, the client may exit and its PID may be reused: ImageVerified is set only if the
+// process was proved to be the client, only then Image can be used for access checks
+type Peer struct {
+	PID           int    `json:"pid"`
+	Image         string `json:"image,omitempty"`
+	ImageVerified bool   `json:"imageVerified,omitempty"`
+	User          string `json:"user,omitempty"`     // SID on Windows, uid on Linux
+	UserName      string `json:"userName,omitempty"` // DOMAIN\user on Windows
+	Session       int    `json:"session"`            // -1 if unknown
+}
+
+func (v *Peer) String() string {
+	parts := []string{fmt.Sprintf("pid %d", v.PID)}
+	if v.Image != "" {
+		parts = append(parts, v.Image)
+	}
+	if v.UserName != "" {
+		parts = append(parts, "user "+v.UserName+" ("+v.User+")")
+	} else if v.User != "" {
+		parts = append(parts, "user "+v.User)
+	}
+	if v.Session >= 0 {
+		parts = append(parts, fmt.Sprintf("session %d", v.Session))
+	}
+	return strings.Join(parts, ", ")
+}
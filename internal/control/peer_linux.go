@@ -0,0 +1,65 @@
+package control
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// SO_PEERPIDFD (Linux 6.5) is not defined by x/sys yet
+const soPeerPidfd = 77
+
+// connPeer reads credentials of the socket client, session is the audit session of the process
+func connPeer(conn net.Conn) (*Peer, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, ErrPeerUnknown
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	pidfd := -1
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+		if credErr == nil {
+			pidfd, _ = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, soPeerPidfd)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+	if pidfd >= 0 {
+		defer unix.Close(pidfd)
+	}
+	p := &Peer{PID: int(cred.Pid), User: strconv.FormatUint(uint64(cred.Uid), 10), Session: -1}
+	if u, err := user.LookupId(p.User); err == nil {
+		p.UserName = u.Username
+	}
+	p.Image, _ = os.Readlink(fmt.Sprintf("/proc/%d/exe", cred.Pid))
+	p.ImageVerified = p.Image != "" && pidfd >= 0 && processAlive(pidfd)
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/sessionid", cred.Pid)); err == nil {
+		if id, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32); err == nil && id != math.MaxUint32 {
+			p.Session = int(id)
+		}
+	}
+	return p, nil
+}
+
+// processAlive checks the process of the connection by its pidfd: if it is still alive after
+// the image is read, its PID could not be reused. EPERM is returned for processes of other users
+func processAlive(pidfd int) bool {
+	err := unix.PidfdSendSignal(pidfd, 0, nil, 0)
+	return err == nil || err == unix.EPERM
+}
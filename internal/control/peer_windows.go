@@ -0,0 +1,90 @@
+package control
+
+import (
+	"net"
+	"runtime"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+var procImpersonateNamedPipeClient = windows.NewLazySystemDLL("advapi32.dll").NewProc("ImpersonateNamedPipeClient")
+
+// connPeer finds the client of the pipe, the user is taken from the identification token
+// of the client, so it can't be confused by reuse of the PID
+func connPeer(conn net.Conn) (*Peer, error) {
+	c, ok := conn.(*pipeConn)
+	if !ok {
+		return nil, ErrPeerUnknown
+	}
+	if _, ok := c.begin(false); !ok {
+		return nil, net.ErrClosed
+	}
+	defer c.ops.Done()
+	var pid uint32
+	if err := windows.GetNamedPipeClientProcessId(c.handle, &pid); err != nil {
+		return nil, err
+	}
+	p := &Peer{PID: int(pid), Session: -1}
+	var session uint32
+	if windows.ProcessIdToSessionId(pid, &session) == nil {
+		p.Session = int(session)
+	}
+	p.Image, p.ImageVerified, _ = processImage(pid, c.accepted)
+	sid, err := pipeClientSID(c.handle)
+	if err != nil {
+		return p, err
+	}
+	p.User = sid.String()
+	if account, domain, _, err := sid.LookupAccount(""); err == nil {
+		p.UserName = domain + `\` + account
+	}
+	return p, nil
+}
+
+// processImage opens the process by PID and checks that it was created before the connection was accepted:
+// the PID can't belong to two processes at once, so such a process is the client and not a later one with
+// the reused PID. The handle keeps the process, so the image is read from the same one
+func processImage(pid uint32, accepted time.Time) (image string, verified bool, err error) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return "", false, err
+	}
+	defer windows.CloseHandle(h)
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	n := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(h, 0, &buf[0], &n); err != nil {
+		return "", false, err
+	}
+	image = windows.UTF16ToString(buf[:n])
+	var creation, exit, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		return image, false, err
+	}
+	return image, !accepted.IsZero() && time.Unix(0, creation.Nanoseconds()).Before(accepted), nil
+}
+
+// pipeClientSID impersonates the client on the locked thread, the thread is not returned
+// to the scheduler if it can't revert to the own token
+func pipeClientSID(h windows.Handle) (*windows.SID, error) {
+	runtime.LockOSThread()
+	if r, _, err := procImpersonateNamedPipeClient.Call(uintptr(h)); r == 0 {
+		runtime.UnlockOSThread()
+		return nil, err
+	}
+	defer func() {
+		if windows.RevertToSelf() == nil {
+			runtime.UnlockOSThread()
+		}
+	}()
+	var token windows.Token
+	if err := windows.OpenThreadToken(windows.CurrentThread(), windows.TOKEN_QUERY, true, &token); err != nil {
+		return nil, err
+	}
+	defer token.Close()
+	user, err := token.GetTokenUser()
+	if err != nil {
+		return nil, err
+	}
+	return user.User.Sid.Copy()
+}
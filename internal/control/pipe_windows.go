@@ -0,0 +1,333 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	PIPE_PREFIX = `\\.\pipe\`
+
+	pipeBufferSize = 4096
+	pipeBusyRetry  = 20 * time.Millisecond
+	waitTimeout    = uint32(windows.WAIT_TIMEOUT)
+)
+
+func init() {
+	DefaultTransport = &PipeTransport{}
+}
+
+// PipeTransport uses local named pipes with overlapped I/O, so reading and writing
+// of one connection can run at the same time and can be cancelled by Close or deadline
+type PipeTransport struct {
+	// SDDL of pipes, default - the current user, administrators and LocalSystem
+	SDDL string
+}
+
+func (v *PipeTransport) securityAttributes() (*windows.SecurityAttributes, error) {
+	sddl := v.SDDL
+	if sddl == "" {
+		user, err := windows.GetCurrentProcessToken().GetTokenUser()
+		if err != nil {
+			return nil, err
+		}
+		sddl = fmt.Sprintf("D:P(A;;GA;;;%v)(A;;GA;;;BA)(A;;GA;;;SY)", user.User.Sid)
+	}
+	sd, err := windows.SecurityDescriptorFromString(sddl)
+	if err != nil {
+		return nil, err
+	}
+	sa := &windows.SecurityAttributes{SecurityDescriptor: sd}
+	sa.Length = uint32(unsafe.Sizeof(*sa))
+	return sa, nil
+}
+
+func (v *PipeTransport) Listen(name string) (net.Listener, error) {
+	sa, err := v.securityAttributes()
+	if err != nil {
+		return nil, err
+	}
+	done, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	l := &pipeListener{path: PIPE_PREFIX + name, sa: sa, done: done}
+	// the first instance is created at once: clients can connect right after Listen,
+	// and the name can't be taken by another process
+	if l.pending, err = l.create(true); err != nil {
+		windows.CloseHandle(done)
+		return nil, &net.OpError{Op: "listen", Net: "pipe", Addr: l.Addr(), Err: err}
+	}
+	return l, nil
+}
+
+func (v *PipeTransport) Dial(name string, timeout time.Duration) (net.Conn, error) {
+	path := PIPE_PREFIX + name
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		// the server may identify the client, but it can't act on its behalf
+		h, err := windows.CreateFile(p, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING,
+			windows.FILE_FLAG_OVERLAPPED|windows.SECURITY_SQOS_PRESENT|windows.SECURITY_IDENTIFICATION, 0)
+		if err == nil {
+			return newPipeConn(h, path)
+		}
+		switch {
+		case errors.Is(err, windows.ERROR_FILE_NOT_FOUND):
+			return nil, ErrNotRunning
+		case !errors.Is(err, windows.ERROR_PIPE_BUSY):
+			return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: nameAddr{"pipe", path}, Err: err}
+		case !deadline.IsZero() && time.Now().After(deadline):
+			return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: nameAddr{"pipe", path}, Err: os.ErrDeadlineExceeded}
+		}
+		time.Sleep(pipeBusyRetry)
+	}
+}
+
+// overlappedIO starts the operation and waits for its completion, Close of the owner (done)
+// or deadline; the operation is cancelled in the last two cases
+func overlappedIO(h, done windows.Handle, deadline time.Time, start func(o *windows.Overlapped, n *uint32) error) (int, error) {
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(event)
+	o := &windows.Overlapped{HEvent: event}
+	var n uint32
+	if err := start(o, &n); err != nil && err != windows.ERROR_IO_PENDING {
+		return int(n), err
+	}
+	timeout := uint32(windows.INFINITE)
+	if !deadline.IsZero() {
+		timeout = 0
+		if d := time.Until(deadline); d > 0 {
+			timeout = uint32(d.Milliseconds()) + 1
+		}
+	}
+	var cause error
+	r, err := windows.WaitForMultipleObjects([]windows.Handle{event, done}, false, timeout)
+	switch {
+	case err != nil:
+		cause = err
+	case r == windows.WAIT_OBJECT_0+1:
+		cause = net.ErrClosed
+	case r == waitTimeout:
+		cause = os.ErrDeadlineExceeded
+	}
+	if cause != nil {
+		windows.CancelIoEx(h, o)
+	}
+	err = windows.GetOverlappedResult(h, o, &n, true)
+	if cause != nil && err == windows.ERROR_OPERATION_ABORTED {
+		return int(n), cause
+	}
+	return int(n), err
+}
+
+type pipeListener struct {
+	path    string
+	sa      *windows.SecurityAttributes
+	done    windows.Handle // set by Close
+	mutex   sync.Mutex
+	pending windows.Handle // instance waiting for a client
+	closed  bool
+	ops     sync.WaitGroup
+}
+
+func (v *pipeListener) create(first bool) (windows.Handle, error) {
+	p, err := windows.UTF16PtrFromString(v.path)
+	if err != nil {
+		return 0, err
+	}
+	flags := uint32(windows.PIPE_ACCESS_DUPLEX | windows.FILE_FLAG_OVERLAPPED)
+	if first {
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	return windows.CreateNamedPipe(p, flags, windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+		windows.PIPE_UNLIMITED_INSTANCES, pipeBufferSize, pipeBufferSize, 0, v.sa)
+}
+
+func (v *pipeListener) Accept() (net.Conn, error) {
+	v.mutex.Lock()
+	if v.closed {
+		v.mutex.Unlock()
+		return nil, net.ErrClosed
+	}
+	h := v.pending
+	v.pending = 0
+	v.ops.Add(1)
+	v.mutex.Unlock()
+	defer v.ops.Done()
+	var err error
+	if h == 0 {
+		if h, err = v.create(false); err != nil {
+			return nil, &net.OpError{Op: "accept", Net: "pipe", Addr: v.Addr(), Err: err}
+		}
+	}
+	_, err = overlappedIO(h, v.done, time.Time{}, func(o *windows.Overlapped, n *uint32) error {
+		return windows.ConnectNamedPipe(h, o)
+	})
+	if err == windows.ERROR_PIPE_CONNECTED { // the client connected before ConnectNamedPipe
+		err = nil
+	}
+	if err != nil {
+		windows.CloseHandle(h)
+		if err == net.ErrClosed {
+			return nil, err
+		}
+		return nil, &net.OpError{Op: "accept", Net: "pipe", Addr: v.Addr(), Err: err}
+	}
+	c, err := newPipeConn(h, v.path)
+	if err != nil {
+		return nil, err
+	}
+	c.accepted = time.Now()
+	return c, nil
+}
+
+func (v *pipeListener) Close() error {
+	v.mutex.Lock()
+	if v.closed {
+		v.mutex.Unlock()
+		return nil
+	}
+	v.closed = true
+	if v.pending != 0 {
+		windows.CloseHandle(v.pending)
+		v.pending = 0
+	}
+	windows.SetEvent(v.done)
+	v.mutex.Unlock()
+	v.ops.Wait()
+	return windows.CloseHandle(v.done)
+}
+
+func (v *pipeListener) Addr() net.Addr {
+	return nameAddr{"pipe", v.path}
+}
+
+type pipeConn struct {
+	handle windows.Handle
+	path   string
+	done   windows.Handle // set by Close
+	mutex  sync.Mutex
+	closed bool
+	ops    sync.WaitGroup
+
+	readDeadline, writeDeadline time.Time
+	accepted                    time.Time // server side: when the client was connected, for peer checks
+}
+
+func newPipeConn(h windows.Handle, path string) (*pipeConn, error) {
+	done, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		windows.CloseHandle(h)
+		return nil, err
+	}
+	return &pipeConn{handle: h, path: path, done: done}, nil
+}
+
+// begin registers an operation, Close waits for registered operations before closing the handle
+func (v *pipeConn) begin(write bool) (time.Time, bool) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.closed {
+		return time.Time{}, false
+	}
+	v.ops.Add(1)
+	if write {
+		return v.writeDeadline, true
+	}
+	return v.readDeadline, true
+}
+
+func (v *pipeConn) Read(b []byte) (int, error) {
+	deadline, ok := v.begin(false)
+	if !ok {
+		return 0, net.ErrClosed
+	}
+	defer v.ops.Done()
+	n, err := overlappedIO(v.handle, v.done, deadline, func(o *windows.Overlapped, n *uint32) error {
+		return windows.ReadFile(v.handle, b, n, o)
+	})
+	if err == windows.ERROR_BROKEN_PIPE || err == windows.ERROR_PIPE_NOT_CONNECTED || (err == nil && n == 0 && len(b) > 0) {
+		return n, io.EOF
+	}
+	return n, err
+}
+
+func (v *pipeConn) Write(b []byte) (int, error) {
+	deadline, ok := v.begin(true)
+	if !ok {
+		return 0, net.ErrClosed
+	}
+	defer v.ops.Done()
+	written := 0
+	for written < len(b) {
+		n, err := overlappedIO(v.handle, v.done, deadline, func(o *windows.Overlapped, n *uint32) error {
+			return windows.WriteFile(v.handle, b[written:], n, o)
+		})
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (v *pipeConn) Close() error {
+	v.mutex.Lock()
+	if v.closed {
+		v.mutex.Unlock()
+		return nil
+	}
+	v.closed = true
+	windows.SetEvent(v.done)
+	v.mutex.Unlock()
+	v.ops.Wait()
+	windows.CloseHandle(v.done)
+	return windows.CloseHandle(v.handle)
+}
+
+func (v *pipeConn) LocalAddr() net.Addr {
+	return nameAddr{"pipe", v.path}
+}
+
+func (v *pipeConn) RemoteAddr() net.Addr {
+	return nameAddr{"pipe", v.path}
+}
+
+func (v *pipeConn) SetDeadline(t time.Time) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.readDeadline, v.writeDeadline = t, t
+	return nil
+}
+
+func (v *pipeConn) SetReadDeadline(t time.Time) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.readDeadline = t
+	return nil
+}
+
+func (v *pipeConn) SetWriteDeadline(t time.Time) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.writeDeadline = t
+	return nil
+}
@@ -0,0 +1,188 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"AI-Sid/monitor/internal/journal"
+)
+
+// PROTOCOL_VERSION is changed on incompatible changes of messages,
+// the server rejects requests of other versions with ERROR_VERSION
+const PROTOCOL_VERSION = 1
+
+// commands of the primary instance
+const (
+	COMMAND_PING     = "ping"
+	COMMAND_STATUS   = "status"
+	COMMAND_START    = "start"
+	COMMAND_STOP     = "stop"
+	COMMAND_QUIT     = "quit"
+	COMMAND_PAUSE    = "pause"
+	COMMAND_SNAPSHOT = "snapshot" // write the current settings to the log
+
+	// after the response the server sends events of the subscription with its ID,
+	// until the client disconnects
+	COMMAND_SUBSCRIBE = "subscribe"
+)
+
+// error codes of responses
+const (
+	ERROR_VERSION         = "version"
+	ERROR_BAD_REQUEST     = "bad-request"
+	ERROR_UNKNOWN_COMMAND = "unknown-command"
+	ERROR_REJECTED        = "rejected" // the command is valid, but it is not allowed now
+	ERROR_FAILED          = "failed"
+)
+
+// Request and Response are sent as JSON lines, ID of the request is returned in its response
+type Request struct {
+	Version int             `json:"version"`
+	ID      uint64          `json:"id,omitempty"`
+	Command string          `json:"command"`
+	Args    json.RawMessage `json:"args,omitempty"`
+}
+
+type Response struct {
+	Version int             `json:"version"`
+	ID      uint64          `json:"id,omitempty"`
+	OK      bool            `json:"ok"`
+	Error   *Error          `json:"error,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Event   *journal.Event  `json:"event,omitempty"`   // subscription
+	Dropped uint64          `json:"dropped,omitempty"` // events of the subscription lost before this one
+}
+
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (v *Error) Error() string {
+	if v.Message == "" {
+		return v.Code
+	}
+	return v.Message
+}
+
+type SubscribeArgs struct {
+	Filter journal.Filter `json:"filter"`
+}
+
+// ActionArgs are arguments of start, stop, quit and pause
+type ActionArgs struct {
+	Reason    string `json:"reason,omitempty"`
+	Requester string `json:"requester,omitempty"` // user of the secondary instance
+	Duration  string `json:"duration,omitempty"`  // pause, e.g. "30m"
+}
+
+// ActionResult is the state after an action, Changed is false if it was already requested
+type ActionResult struct {
+	Changed     bool              `json:"changed"`
+	Monitoring  bool              `json:"monitoring"`
+	PausedUntil *time.Time        `json:"pausedUntil,omitempty"`
+	Snapshot    *journal.Snapshot `json:"snapshot,omitempty"`
+}
+
+type PingResult struct {
+	PID        int  `json:"pid"`
+	Monitoring bool `json:"monitoring"`
+}
+
+// SourceStatus is the last observed settings of a source
+type SourceStatus struct {
+	Source string `json:"source"`
+	journal.Snapshot
+	Since   time.Time `json:"since"`   // settings are the same since
+	Checked time.Time `json:"checked"` // the last time they were read
+}
+
+type ErrorStatus struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+type PauseStatus struct {
+	Until     time.Time `json:"until"`
+	Reason    string    `json:"reason,omitempty"`
+	Requester string    `json:"requester,omitempty"`
+}
+
+// TransitionStatus is the next action of the schedule
+type TransitionStatus struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Rule   string    `json:"rule"`
+}
+
+type ScheduleStatus struct {
+	Rules int               `json:"rules"`
+	Next  *TransitionStatus `json:"next,omitempty"`
+}
+
+type StatusResult struct {
+	PID         int             `json:"pid"`
+	Version     string          `json:"version"`
+	Instance    string          `json:"instance,omitempty"` // empty for the default instance
+	Namespace   string          `json:"namespace"`
+	Monitoring  bool            `json:"monitoring"`
+	Pause       *PauseStatus    `json:"pause,omitempty"`
+	NormalState bool            `json:"normalState"`
+	Started     time.Time       `json:"started"`
+	Uptime      float64         `json:"uptimeSeconds"`
+	LogPath     string          `json:"logPath"`
+	Sources     []SourceStatus  `json:"sources"`
+	LastChange  *time.Time      `json:"lastChange,omitempty"`
+	LastError   *ErrorStatus    `json:"lastError,omitempty"`
+	Schedule    *ScheduleStatus `json:"schedule,omitempty"`
+}
+
+func NewRequest(command string, args any) (*Request, error) {
+	req := &Request{Version: PROTOCOL_VERSION, Command: command}
+	if args != nil {
+		data, err := json.Marshal(args)
+		if err != nil {
+			return nil, err
+		}
+		req.Args = data
+	}
+	return req, nil
+}
+
+// DecodeArgs decodes arguments of the request, missing arguments keep defaults of args
+func (v *Request) DecodeArgs(args any) error {
+	if len(v.Args) == 0 {
+		return nil
+	}
+	return json.Unmarshal(v.Args, args)
+}
+
+func NewResult(result any) *Response {
+	if result == nil {
+		return &Response{OK: true}
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return NewError(ERROR_FAILED, "%v", err)
+	}
+	return &Response{OK: true, Result: data}
+}
+
+func NewError(code, format string, args ...any) *Response {
+	return &Response{Error: &Error{Code: code, Message: fmt.Sprintf(format, args...)}}
+}
+
+// Decode returns the error of a failed response (*Error) or decodes its result
+func (v *Response) Decode(result any) error {
+	if !v.OK {
+		if v.Error == nil {
+			return &Error{Code: ERROR_FAILED}
+		}
+		return v.Error
+	}
+	if result == nil || len(v.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(v.Result, result)
+}
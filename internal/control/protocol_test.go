@@ -0,0 +1,220 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+const testName = "test"
+
+// startServer serves handler over a memory transport until the end of the test
+func startServer(t *testing.T, handler Handler) (*MemoryTransport, *Server) {
+	transport := NewMemoryTransport()
+	l, err := transport.Listen(testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(l, handler)
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+	return transport, server
+}
+
+func dial(t *testing.T, transport Transport) *Client {
+	client, err := Dial(transport, testName, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	client.Timeout = 5 * time.Second
+	return client
+}
+
+func pingHandler(s *Session, req *Request) *Response {
+	if req.Command == COMMAND_PING {
+		return NewResult(PingResult{PID: 1, Monitoring: true})
+	}
+	return NewError(ERROR_UNKNOWN_COMMAND, "unknown command %q", req.Command)
+}
+
+// sendRaw writes the line as is and reads one response
+func sendRaw(t *testing.T, client *Client, line string) *Response {
+	if _, err := io.WriteString(client.conn, line+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestVersionMismatch(t *testing.T) {
+	transport, _ := startServer(t, pingHandler)
+	client := dial(t, transport)
+	resp := sendRaw(t, client, fmt.Sprintf(`{"version":%d,"id":7,"command":"ping"}`, PROTOCOL_VERSION+1))
+	if resp.OK || resp.Error == nil || resp.Error.Code != ERROR_VERSION || resp.ID != 7 {
+		t.Fatalf("response %+v, version error of request 7 expected", resp)
+	}
+	if resp.Version != PROTOCOL_VERSION {
+		t.Errorf("response version %d, want %d", resp.Version, PROTOCOL_VERSION)
+	}
+	// the session is still usable by the supported version
+	var ping PingResult
+	if err := client.Call(COMMAND_PING, nil, &ping); err != nil || ping.PID != 1 {
+		t.Errorf("ping after version error: %+v, %v", ping, err)
+	}
+}
+
+func TestBadRequest(t *testing.T) {
+	transport, _ := startServer(t, pingHandler)
+	client := dial(t, transport)
+	for _, line := range []string{"not json", `{"version":"1"}`, `[1,2]`} {
+		resp := sendRaw(t, client, line)
+		if resp.OK || resp.Error == nil || resp.Error.Code != ERROR_BAD_REQUEST {
+			t.Errorf("%q: response %+v, bad request expected", line, resp)
+		}
+	}
+	err := client.Call("unknown", nil, nil)
+	var e *Error
+	if !errors.As(err, &e) || e.Code != ERROR_UNKNOWN_COMMAND {
+		t.Errorf("unknown command: %v", err)
+	}
+}
+
+func TestResultWithArgs(t *testing.T) {
+	until := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	transport, _ := startServer(t, func(s *Session, req *Request) *Response {
+		args := ActionArgs{Duration: "15m"}
+		if err := req.DecodeArgs(&args); err != nil {
+			return NewError(ERROR_BAD_REQUEST, "%v", err)
+		}
+		if req.Command != COMMAND_PAUSE || args.Reason == "" {
+			return NewError(ERROR_REJECTED, "pause with reason expected, got %v %+v", req.Command, args)
+		}
+		d, err := time.ParseDuration(args.Duration)
+		if err != nil {
+			return NewError(ERROR_BAD_REQUEST, "%v", err)
+		}
+		// a response of another request is skipped by the client
+		s.Send(&Response{ID: req.ID + 100, OK: true})
+		paused := until.Add(d - 30*time.Minute)
+		return NewResult(ActionResult{Changed: true, PausedUntil: &paused})
+	})
+	client := dial(t, transport)
+	var res ActionResult
+	if err := client.Call(COMMAND_PAUSE, ActionArgs{Reason: "update", Duration: "30m"}, &res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.Changed || res.PausedUntil == nil || !res.PausedUntil.Equal(until) {
+		t.Errorf("result %+v", res)
+	}
+	// defaults of arguments are kept
+	err := client.Call(COMMAND_PAUSE, nil, &res)
+	var e *Error
+	if !errors.As(err, &e) || e.Code != ERROR_REJECTED {
+		t.Errorf("pause without reason: %v", err)
+	}
+	if err := client.Call(COMMAND_PAUSE, ActionArgs{Reason: "x", Duration: "soon"}, &res); !errors.As(err, &e) || e.Code != ERROR_BAD_REQUEST {
+		t.Errorf("pause with invalid duration: %v", err)
+	}
+}
+
+func TestCallDeadline(t *testing.T) {
+	release := make(chan struct{})
+	transport, _ := startServer(t, func(s *Session, req *Request) *Response {
+		select {
+		case <-release:
+		case <-s.Done():
+		}
+		return NewResult(nil)
+	})
+	defer close(release)
+	client := dial(t, transport)
+	client.Timeout = 50 * time.Millisecond
+	start := time.Now()
+	err := client.Call(COMMAND_PING, nil, nil)
+	if !IsTimeout(err) {
+		t.Fatalf("call error %v, timeout expected", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("call returned after %v", d)
+	}
+}
+
+func TestDialNotRunning(t *testing.T) {
+	transport := NewMemoryTransport()
+	if _, err := Dial(transport, testName, time.Second); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("dial without listener: %v", err)
+	}
+	if _, err := Dial(nil, testName, time.Second); err == nil {
+		t.Error("dial without transport succeeded")
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	transport, server := startServer(t, pingHandler)
+	client := dial(t, transport)
+	if err := client.Call(COMMAND_PING, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := transport.Listen(testName); err == nil {
+		t.Error("the name is listened twice")
+	}
+	done := make(chan error)
+	go func() { done <- server.Close() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("close: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("close does not return while the client is connected")
+	}
+	if err := client.Call(COMMAND_PING, nil, nil); err == nil {
+		t.Error("call succeeded after the server was closed")
+	}
+	if _, err := Dial(transport, testName, time.Second); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("dial after close: %v", err)
+	}
+	// the name is released
+	l, err := transport.Listen(testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("accept after close: %v", err)
+	}
+}
+
+func TestSessionDone(t *testing.T) {
+	sessions := make(chan *Session, 1)
+	transport, _ := startServer(t, func(s *Session, req *Request) *Response {
+		sessions <- s
+		return NewResult(nil)
+	})
+	client := dial(t, transport)
+	if err := client.Call(COMMAND_SUBSCRIBE, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	s := <-sessions
+	select {
+	case <-s.Done():
+		t.Fatal("session is done before the client disconnects")
+	default:
+	}
+	client.Close()
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("session is not done after the client disconnected")
+	}
+	if err := s.Send(&Response{OK: true}); err == nil {
+		t.Error("send to the disconnected client succeeded")
+	}
+}
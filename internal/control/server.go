@@ -0,0 +1,138 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+)
+
+const maxMessageSize = 64 * 1024
+
+// Handler returns the response of the request, nil if it is already sent by the session
+type Handler func(s *Session, req *Request) *Response
+
+// Session is a connection of one client
+type Session struct {
+	Conn  net.Conn
+	mutex sync.Mutex
+	enc   *json.Encoder
+	done  chan struct{}
+
+	peerOnce sync.Once
+	peer     *Peer
+	peerErr  error
+}
+
+func newSession(conn net.Conn) *Session {
+	return &Session{Conn: conn, enc: json.NewEncoder(conn), done: make(chan struct{})}
+}
+
+// Done is closed when the client disconnects, goroutines which send to the session
+// (e.g. subscriptions) must stop then
+func (v *Session) Done() <-chan struct{} {
+	return v.done
+}
+
+// Peer returns the client process, it is found on the first call, because the pipe client
+// can be identified only after a request is read. Peer can be partial if err is not nil
+func (v *Session) Peer() (*Peer, error) {
+	v.peerOnce.Do(func() {
+		v.peer, v.peerErr = connPeer(v.Conn)
+	})
+	return v.peer, v.peerErr
+}
+
+// Send writes the message to the client, it can be called from any goroutine
+func (v *Session) Send(resp *Response) error {
+	resp.Version = PROTOCOL_VERSION
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.enc.Encode(resp)
+}
+
+type Server struct {
+	listener net.Listener
+	handler  Handler
+	mutex    sync.Mutex
+	sessions map[*Session]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+func NewServer(listener net.Listener, handler Handler) *Server {
+	return &Server{listener: listener, handler: handler, sessions: make(map[*Session]struct{})}
+}
+
+// Serve accepts clients until Close, every client is served by its own goroutine
+func (v *Server) Serve() error {
+	for {
+		conn, err := v.listener.Accept()
+		if err != nil {
+			v.mutex.Lock()
+			closed := v.closed
+			v.mutex.Unlock()
+			if closed || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		s := newSession(conn)
+		v.mutex.Lock()
+		if v.closed {
+			v.mutex.Unlock()
+			conn.Close()
+			return nil
+		}
+		v.sessions[s] = struct{}{}
+		v.wg.Add(1)
+		v.mutex.Unlock()
+		go v.serve(s)
+	}
+}
+
+func (v *Server) serve(s *Session) {
+	defer v.wg.Done()
+	defer func() {
+		v.mutex.Lock()
+		delete(v.sessions, s)
+		v.mutex.Unlock()
+		close(s.done)
+		s.Conn.Close()
+	}()
+	scanner := bufio.NewScanner(s.Conn)
+	scanner.Buffer(make([]byte, 4096), maxMessageSize)
+	for scanner.Scan() {
+		var req Request
+		var resp *Response
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp = NewError(ERROR_BAD_REQUEST, "%v", err)
+		} else if req.Version != PROTOCOL_VERSION {
+			resp = NewError(ERROR_VERSION, "protocol version %d is not supported, server version is %d", req.Version, PROTOCOL_VERSION)
+		} else if resp = v.handler(s, &req); resp == nil {
+			continue
+		}
+		resp.ID = req.ID
+		if err := s.Send(resp); err != nil {
+			return
+		}
+	}
+}
+
+// Close stops accepting, closes connections of clients and waits for their handlers
+func (v *Server) Close() error {
+	v.mutex.Lock()
+	if v.closed {
+		v.mutex.Unlock()
+		return nil
+	}
+	v.closed = true
+	err := v.listener.Close()
+	for s := range v.sessions {
+		s.Conn.Close()
+	}
+	v.mutex.Unlock()
+	v.wg.Wait()
+	return err
+}
@@ -0,0 +1,91 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const SOCKET_SUFFIX = ".sock"
+
+func init() {
+	DefaultTransport = &SocketTransport{}
+}
+
+// RuntimeDir is the directory of sockets and lock files of the current user:
+// $XDG_RUNTIME_DIR or a private directory in the temp directory
+func RuntimeDir() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir, nil
+	}
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("proxyMon-%d", os.Getuid()))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	// the directory can be created by another user before
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); !ok || !info.IsDir() || int(st.Uid) != os.Getuid() || info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("runtime directory %v is not private", dir)
+	}
+	return dir, nil
+}
+
+// SocketTransport uses Unix domain sockets accessible only by the current user
+type SocketTransport struct {
+	// directory of sockets, default - RuntimeDir()
+	Dir string
+}
+
+func (v *SocketTransport) path(name string) (string, error) {
+	dir := v.Dir
+	if dir == "" {
+		var err error
+		if dir, err = RuntimeDir(); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, name+SOCKET_SUFFIX), nil
+}
+
+func (v *SocketTransport) Listen(name string) (net.Listener, error) {
+	path, err := v.path(name)
+	if err != nil {
+		return nil, err
+	}
+	// the socket of a crashed primary is left, it is removed if nobody listens on it
+	if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		c.Close()
+		return nil, &net.OpError{Op: "listen", Net: "unix", Addr: nameAddr{"unix", path}, Err: syscall.EADDRINUSE}
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (v *SocketTransport) Dial(name string, timeout time.Duration) (net.Conn, error) {
+	path, err := v.path(name)
+	if err != nil {
+		return nil, err
+	}
+	c, err := net.DialTimeout("unix", path, timeout)
+	if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ECONNREFUSED) {
+		return nil, ErrNotRunning
+	}
+	return c, err
+}
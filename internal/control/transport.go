@@ -0,0 +1,42 @@
+package control
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+// ErrNotRunning is returned by Dial if nobody listens on the name
+var ErrNotRunning = errors.New("primary instance is not running")
+
+// Transport creates the endpoint of the primary instance and connects secondary instances to it.
+// Names are system independent, a transport maps them to pipes, sockets, ...
+type Transport interface {
+	Listen(name string) (net.Listener, error)
+	Dial(name string, timeout time.Duration) (net.Conn, error)
+}
+
+// DefaultTransport is the transport of the platform, nil if control channel is not supported
+var DefaultTransport Transport
+
+type nameAddr struct {
+	network, name string
+}
+
+func (v nameAddr) Network() string {
+	return v.network
+}
+
+func (v nameAddr) String() string {
+	return v.name
+}
+
+// IsTimeout checks whether the call failed by deadline
+func IsTimeout(err error) bool {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
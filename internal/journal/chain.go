@@ -0,0 +1,395 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	CHAIN_ANCHOR_EXT     = ".chain"
+	CHAIN_CHECKPOINT_EXT = ".chain-start" // the last link of files removed by retention
+
+	chainTextMarker = "  #chain:"
+	chainJSONMarker = `,"chain":"`
+)
+
+type ChainOptions struct {
+	Enabled bool   `json:"enabled,omitempty"`
+	Key     string `json:"key,omitempty"`     // HMAC key, empty - plain SHA-256
+	KeyFile string `json:"keyFile,omitempty"` // file with HMAC key, used instead of Key
+}
+
+func (v *ChainOptions) LoadKey() ([]byte, error) {
+	if v.KeyFile != "" {
+		data, err := os.ReadFile(v.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimSpace(data), nil
+	}
+	return []byte(v.Key), nil
+}
+
+// chainHash = H(previous hash || seq || record), H is HMAC-SHA256 with key or SHA-256 without it
+func chainHash(key, previous []byte, seq uint64, record []byte) []byte {
+	var h hash.Hash
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(previous)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], seq)
+	h.Write(b[:])
+	h.Write(record)
+	return h.Sum(nil)
+}
+
+var chainGenesis = make([]byte, sha256.Size)
+
+// sealRecord adds "<seq>:<hash>" to record: as "chain" field to JSON objects, as suffix to text lines
+func sealRecord(record []byte, seq uint64, sum []byte) []byte {
+	link := strconv.FormatUint(seq, 10) + ":" + hex.EncodeToString(sum)
+	if len(record) > 1 && record[0] == '{' && record[len(record)-1] == '}' {
+		res := append([]byte{}, record[:len(record)-1]...)
+		return append(res, chainJSONMarker+link+`"}`...)
+	}
+	return append(append([]byte{}, record...), chainTextMarker+link...)
+}
+
+// splitRecord returns the original record and its link, ok is false for unsealed records
+func splitRecord(line []byte) (record []byte, seq uint64, sum []byte, ok bool) {
+	var link string
+	if i := bytes.LastIndex(line, []byte(chainJSONMarker)); i > 0 && bytes.HasSuffix(line, []byte(`"}`)) {
+		record = append(append([]byte{}, line[:i]...), '}')
+		link = string(line[i+len(chainJSONMarker) : len(line)-2])
+	} else if i := bytes.LastIndex(line, []byte(chainTextMarker)); i > 0 {
+		record = line[:i]
+		link = string(line[i+len(chainTextMarker):])
+	} else {
+		return line, 0, nil, false
+	}
+	s, h, found := strings.Cut(link, ":")
+	if !found {
+		return line, 0, nil, false
+	}
+	seq, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return line, 0, nil, false
+	}
+	sum, err = hex.DecodeString(h)
+	if err != nil || len(sum) != sha256.Size {
+		return line, 0, nil, false
+	}
+	return record, seq, sum, true
+}
+
+// ChainAnchor is the last link, kept outside of the log so removal of records
+// from the end of the log can be detected
+type ChainAnchor struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+func ReadChainAnchor(name string) (*ChainAnchor, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	res := new(ChainAnchor)
+	if err := json.Unmarshal(data, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (v *ChainAnchor) write(name string) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// ChainWriter seals every line written into it with a hash linked to the previous
+// line. Every Write must contain exactly one record, as WriterSink does
+type ChainWriter struct {
+	mutex      sync.Mutex
+	writer     io.Writer
+	key        []byte
+	anchorPath string
+	seq        uint64
+	last       []byte
+}
+
+// NewChainWriter continues the chain from the anchor file, or from the last
+// sealed record of the log files if the anchor is missing (decoders are optional, see VerifyChain)
+func NewChainWriter(writer io.Writer, key []byte, logPath string, decoders DecoderFactory) (*ChainWriter, error) {
+	res := &ChainWriter{writer: writer, key: key, anchorPath: logPath + CHAIN_ANCHOR_EXT, last: chainGenesis}
+	anchor, err := ReadChainAnchor(res.anchorPath)
+	if err == nil {
+		if res.last, err = hex.DecodeString(anchor.Hash); err != nil {
+			return nil, fmt.Errorf("chain anchor: %w", err)
+		}
+		res.seq = anchor.Seq
+		return res, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	files, err := LogFiles(logPath)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(files) - 1; i >= 0 && res.seq == 0; i-- {
+		if err := res.restore(files[i], newDecoder(decoders)); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (v *ChainWriter) restore(name string, decode LineDecoder) error {
+	link, err := lastChainLink(name, decode)
+	if err != nil || link == nil {
+		return err
+	}
+	v.seq = link.Seq
+	v.last, err = hex.DecodeString(link.Hash)
+	return err
+}
+
+// lastChainLink returns the link of the last sealed record of the file, nil if there are no sealed records
+func lastChainLink(name string, decode LineDecoder) (*ChainAnchor, error) {
+	f, err := OpenRecordFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var res *ChainAnchor
+	err = scanLines(f, func(line int, data []byte) error {
+		if decode != nil {
+			var err error
+			if data, err = decode(data); err != nil {
+				return fmt.Errorf("%v:%d: %w", name, line, err)
+			}
+		}
+		if _, seq, sum, ok := splitRecord(data); ok {
+			res = &ChainAnchor{seq, hex.EncodeToString(sum)}
+		}
+		return nil
+	})
+	return res, err
+}
+
+// RemoveChainedFile is the removal of rotated files for retention: the last link of the file
+// is saved to the checkpoint first, so the first kept record can be verified against it.
+// The file is kept if its link can't be read
+func RemoveChainedFile(name, checkpointPath string, decoders DecoderFactory) error {
+	link, err := lastChainLink(name, newDecoder(decoders))
+	if err != nil {
+		return fmt.Errorf("chain checkpoint: %w", err)
+	}
+	if err := os.Remove(name); err != nil {
+		return err
+	}
+	if link == nil {
+		return nil
+	}
+	// files can be removed in any order, the checkpoint only moves forward
+	if cp, err := ReadChainAnchor(checkpointPath); err == nil && cp.Seq >= link.Seq {
+		return nil
+	}
+	if err := link.write(checkpointPath); err != nil {
+		return fmt.Errorf("chain checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (v *ChainWriter) Write(p []byte) (int, error) {
+	record := bytes.TrimRight(p, "\r\n")
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	seq := v.seq + 1
+	sum := chainHash(v.key, v.last, seq, record)
+	if _, err := v.writer.Write(append(sealRecord(record, seq, sum), '\n')); err != nil {
+		return 0, err
+	}
+	v.seq, v.last = seq, sum
+	anchor := ChainAnchor{seq, hex.EncodeToString(sum)}
+	if err := anchor.write(v.anchorPath); err != nil {
+		return len(p), fmt.Errorf("chain anchor: %w", err)
+	}
+	return len(p), nil
+}
+
+func (v *ChainWriter) Close() error {
+	if c, ok := v.writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+const (
+	CHAIN_BROKEN    = "broken link"        // record was changed
+	CHAIN_REORDERED = "reordered"          // sequence goes back
+	CHAIN_MISSING   = "missing records"    // sequence gap, records were removed
+	CHAIN_UNSEALED  = "unsealed record"    // record without hash inside of the chain
+	CHAIN_TRUNCATED = "truncated"          // records after the last one are removed (anchor is ahead)
+	CHAIN_NO_START  = "unverifiable start" // older records are removed without checkpoint
+)
+
+type ChainProblem struct {
+	Kind   string
+	File   string
+	Line   int
+	Detail string
+}
+
+func (v *ChainProblem) String() string {
+	if v.File == "" {
+		return fmt.Sprintf("%v: %v", v.Kind, v.Detail)
+	}
+	return fmt.Sprintf("%v at %v:%d: %v", v.Kind, v.File, v.Line, v.Detail)
+}
+
+type ChainReport struct {
+	Records  int    // sealed records
+	Legacy   int    // unsealed records before the chain start
+	FirstSeq uint64 // >1 when older files were removed by retention, it follows the checkpoint then
+	LastSeq  uint64
+	Problem  *ChainProblem // the first problem, nil if the chain is intact
+}
+
+// LineDecoder converts stored lines into records (e.g. decrypts them), nil - lines are records
+type LineDecoder = func(line []byte) ([]byte, error)
+
+// DecoderFactory creates a LineDecoder for a separate pass over files (decoders may check the order of lines)
+type DecoderFactory = func() LineDecoder
+
+func newDecoder(decoders DecoderFactory) LineDecoder {
+	if decoders == nil {
+		return nil
+	}
+	return decoders()
+}
+
+type chainVerifier struct {
+	key    []byte
+	decode LineDecoder
+	start  *ChainAnchor
+	report ChainReport
+	last   []byte
+}
+
+// VerifyChain checks files in order (oldest first) as one chain. Anchor is optional, checkpoint
+// is required if the chain does not start at the first record (see RemoveChainedFile)
+func VerifyChain(files []string, key []byte, anchor, checkpoint *ChainAnchor, decode LineDecoder) (*ChainReport, error) {
+	v := &chainVerifier{key: key, decode: decode, start: checkpoint}
+	for _, name := range files {
+		if err := v.verifyFile(name); err != nil {
+			return nil, err
+		}
+		if v.report.Problem != nil {
+			return &v.report, nil
+		}
+	}
+	if anchor != nil && v.report.Problem == nil {
+		if anchor.Seq > v.report.LastSeq {
+			v.report.Problem = &ChainProblem{Kind: CHAIN_TRUNCATED, Detail: fmt.Sprintf("last record %d, anchor %d", v.report.LastSeq, anchor.Seq)}
+		} else if anchor.Seq == v.report.LastSeq && anchor.Hash != hex.EncodeToString(v.last) {
+			v.report.Problem = &ChainProblem{Kind: CHAIN_BROKEN, Detail: "last record does not match anchor"}
+		}
+	}
+	return &v.report, nil
+}
+
+func (v *chainVerifier) verifyFile(name string) error {
+	f, err := OpenRecordFile(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := scanner.Bytes()
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		if v.decode != nil {
+			if data, err = v.decode(data); err != nil {
+				v.report.Problem = &ChainProblem{CHAIN_BROKEN, name, line, err.Error()}
+				return nil
+			}
+		}
+		if v.report.Problem = v.check(data); v.report.Problem != nil {
+			v.report.Problem.File, v.report.Problem.Line = name, line
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+func (v *chainVerifier) check(data []byte) *ChainProblem {
+	record, seq, sum, ok := splitRecord(data)
+	r := &v.report
+	if !ok {
+		if r.Records == 0 {
+			r.Legacy++
+			return nil
+		}
+		return &ChainProblem{Kind: CHAIN_UNSEALED, Detail: "record has no chain hash"}
+	}
+	if r.Records == 0 {
+		// the chain starts at the genesis, or at the checkpoint of files removed by retention
+		r.FirstSeq = seq
+		switch {
+		case seq == 1:
+			v.last = chainGenesis
+		case v.start == nil:
+			return &ChainProblem{Kind: CHAIN_NO_START, Detail: fmt.Sprintf("chain starts at record %d, there is no checkpoint", seq)}
+		case seq <= v.start.Seq:
+			return &ChainProblem{Kind: CHAIN_REORDERED, Detail: fmt.Sprintf("record %d, checkpoint %d", seq, v.start.Seq)}
+		case seq > v.start.Seq+1:
+			return &ChainProblem{Kind: CHAIN_MISSING, Detail: fmt.Sprintf("records %d..%d", v.start.Seq+1, seq-1)}
+		default:
+			last, err := hex.DecodeString(v.start.Hash)
+			if err != nil {
+				return &ChainProblem{Kind: CHAIN_NO_START, Detail: fmt.Sprintf("checkpoint: %v", err)}
+			}
+			v.last = last
+		}
+	} else if seq <= r.LastSeq {
+		return &ChainProblem{Kind: CHAIN_REORDERED, Detail: fmt.Sprintf("record %d after %d", seq, r.LastSeq)}
+	} else if seq > r.LastSeq+1 {
+		return &ChainProblem{Kind: CHAIN_MISSING, Detail: fmt.Sprintf("records %d..%d", r.LastSeq+1, seq-1)}
+	}
+	if !hmac.Equal(chainHash(v.key, v.last, seq, record), sum) {
+		return &ChainProblem{Kind: CHAIN_BROKEN, Detail: fmt.Sprintf("record %d", seq)}
+	}
+	r.Records++
+	r.LastSeq, v.last = seq, sum
+	return nil
+}
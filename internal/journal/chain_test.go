@@ -0,0 +1,88 @@
+package journal
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// writeRotatedChain writes records into 3 files, retention keeps only the last rotated one
+func writeRotatedChain(t *testing.T, key []byte) (files []string, anchor, checkpoint *ChainAnchor) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	f, err := OpenRotatingFile(path, RotateOptions{MaxBackups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewChainWriter(f, key, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.SetRemoveFunc(func(name string) error {
+		return RemoveChainedFile(name, path+CHAIN_CHECKPOINT_EXT, nil)
+	})
+	seq := 0
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			seq++
+			if _, err := fmt.Fprintf(w, "record %d\n", seq); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if i < 2 {
+			if err := f.Rotate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files, err = LogFiles(path); err != nil {
+		t.Fatal(err)
+	}
+	if anchor, err = ReadChainAnchor(path + CHAIN_ANCHOR_EXT); err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint, err = ReadChainAnchor(path + CHAIN_CHECKPOINT_EXT); err != nil {
+		t.Fatal(err)
+	}
+	return files, anchor, checkpoint
+}
+
+func TestChainCheckpoint(t *testing.T) {
+	key := []byte("chain test key")
+	files, anchor, checkpoint := writeRotatedChain(t, key)
+	if len(files) != 2 {
+		t.Fatalf("files %v, 2 expected after retention", files)
+	}
+	if checkpoint.Seq != 3 || anchor.Seq != 9 {
+		t.Fatalf("checkpoint %d, anchor %d, want 3 and 9", checkpoint.Seq, anchor.Seq)
+	}
+	report, err := VerifyChain(files, key, anchor, checkpoint, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Problem != nil || report.FirstSeq != 4 || report.LastSeq != 9 || report.Records != 6 {
+		t.Errorf("report %+v, problem %v", report, report.Problem)
+	}
+
+	tests := []struct {
+		name       string
+		checkpoint *ChainAnchor
+		kind       string
+	}{
+		{"no checkpoint", nil, CHAIN_NO_START},
+		{"first record changed", &ChainAnchor{3, anchor.Hash}, CHAIN_BROKEN},
+		{"first file removed", &ChainAnchor{2, checkpoint.Hash}, CHAIN_MISSING},
+		{"checkpoint ahead", &ChainAnchor{4, checkpoint.Hash}, CHAIN_REORDERED},
+	}
+	for _, test := range tests {
+		report, err := VerifyChain(files, key, anchor, test.checkpoint, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Problem == nil || report.Problem.Kind != test.kind {
+			t.Errorf("%v: problem %v, want %v", test.name, report.Problem, test.kind)
+		}
+	}
+}
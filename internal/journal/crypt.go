@@ -0,0 +1,446 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	KEY_PROVIDER_DPAPI = "dpapi" // Windows only: key file protected by DPAPI for the current user
+	KEY_PROVIDER_FILE  = "file"  // plain key file (hex), it must be protected by file permissions
+	KEY_PROVIDER_ENV   = "env"   // key in an environment variable (hex or base64 of 32 bytes)
+
+	DEFAULT_KEY_ENV = "PROXYMON_LOG_KEY"
+
+	// encrypted records are "enc:v2:<seq>:" + base64(nonce || AES-256-GCM ciphertext), the sequence
+	// number is bound into the additional data, so records can't be removed, reordered or copied unnoticed.
+	// v1 records ("enc:v1:" + base64, constant additional data) are only decrypted
+	encryptedPrefix   = "enc:v2:"
+	encryptionAAD     = "proxyMon log record v2:"
+	encryptedPrefixV1 = "enc:v1:"
+	encryptionAADV1   = "proxyMon log record v1"
+	logKeySize        = 32
+
+	// records of other stores (history, state, webhook queue) are "enc:s1:" + base64(nonce || ciphertext),
+	// the name of the store is bound into the additional data
+	sealedPrefix = "enc:s1:"
+	sealedAAD    = "proxyMon stored record v1:"
+)
+
+type EncryptionOptions struct {
+	Enabled  bool   `json:"enabled,omitempty"`
+	Provider string `json:"provider,omitempty"` // dpapi (default on Windows), file (default elsewhere) or env
+	KeyFile  string `json:"keyFile,omitempty"`  // dpapi and file, default - next to the log
+	KeyEnv   string `json:"keyEnv,omitempty"`   // env, default PROXYMON_LOG_KEY
+}
+
+// KeyProvider returns the AES-256 key of log records
+type KeyProvider interface {
+	Key() ([]byte, error)
+}
+
+// key providers are registered by name, DPAPI is added on Windows. With create a missing key file
+// is created with a new random key, otherwise (decryption) it is an error
+var keyProviders = map[string]func(opts EncryptionOptions, create bool) KeyProvider{
+	KEY_PROVIDER_FILE: func(opts EncryptionOptions, create bool) KeyProvider { return &FileKeyProvider{opts.KeyFile, create} },
+	KEY_PROVIDER_ENV:  func(opts EncryptionOptions, create bool) KeyProvider { return &EnvKeyProvider{opts.KeyEnv} },
+}
+
+func defaultKeyProvider() string {
+	if _, ok := keyProviders[KEY_PROVIDER_DPAPI]; ok {
+		return KEY_PROVIDER_DPAPI
+	}
+	return KEY_PROVIDER_FILE
+}
+
+// NewKeyProvider creates the provider of options, defaultKeyFile is used if KeyFile is not set.
+// Only the writer of the log creates the key, readers use create = false
+func NewKeyProvider(opts EncryptionOptions, defaultKeyFile string, create bool) (KeyProvider, error) {
+	if opts.Provider == "" {
+		opts.Provider = defaultKeyProvider()
+	}
+	if opts.KeyFile == "" {
+		opts.KeyFile = defaultKeyFile
+	}
+	if opts.KeyEnv == "" {
+		opts.KeyEnv = DEFAULT_KEY_ENV
+	}
+	newProvider, ok := keyProviders[opts.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unsupported key provider %q", opts.Provider)
+	}
+	return newProvider(opts, create), nil
+}
+
+// checkKey accepts only raw 32-byte keys: passphrases are not supported, because
+// a fast hash of a passphrase without salt is open to dictionary attacks
+func checkKey(key []byte) ([]byte, error) {
+	if len(key) != logKeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", logKeySize, len(key))
+	}
+	return key, nil
+}
+
+// decodeKeyText accepts hex or base64 of a 32-byte key
+func decodeKeyText(text string) ([]byte, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("key is empty")
+	}
+	if key, err := hex.DecodeString(text); err == nil {
+		return checkKey(key)
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil {
+		return checkKey(key)
+	}
+	return nil, fmt.Errorf("key must be hex or base64 of %d bytes", logKeySize)
+}
+
+func newLogKey() ([]byte, error) {
+	key := make([]byte, logKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// loadOrCreateKey reads the key file by decode, with create a missing file is created with a new random key
+func loadOrCreateKey(name string, create bool, decode, encode func([]byte) ([]byte, error)) ([]byte, error) {
+	data, err := os.ReadFile(name)
+	if err == nil {
+		return decode(data)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if !create {
+		return nil, fmt.Errorf("key file %v not found", name)
+	}
+	key, err := newLogKey()
+	if err != nil {
+		return nil, err
+	}
+	if data, err = encode(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return nil, err
+	}
+	// O_EXCL: another process may create the key at the same time
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, fs.ErrExist) {
+		return loadOrCreateKey(name, create, decode, encode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return key, f.Close()
+}
+
+type FileKeyProvider struct {
+	Path   string
+	Create bool
+}
+
+func (v *FileKeyProvider) Key() ([]byte, error) {
+	return loadOrCreateKey(v.Path, v.Create,
+		func(data []byte) ([]byte, error) { return decodeKeyText(string(data)) },
+		func(key []byte) ([]byte, error) { return []byte(hex.EncodeToString(key)), nil })
+}
+
+type EnvKeyProvider struct {
+	Name string
+}
+
+func (v *EnvKeyProvider) Key() ([]byte, error) {
+	text, ok := os.LookupEnv(v.Name)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %v is not set", v.Name)
+	}
+	return decodeKeyText(text)
+}
+
+func newRecordCipher(key []byte) (cipher.AEAD, error) {
+	if _, err := checkKey(key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func recordAAD(seq uint64) []byte {
+	return strconv.AppendUint([]byte(encryptionAAD), seq, 10)
+}
+
+// EncryptWriter encrypts every record written into it, so each line of the file
+// can be decrypted separately and rotation may split files at any record
+type EncryptWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	aead   cipher.AEAD
+	seq    uint64
+}
+
+// NewEncryptWriter continues the sequence of records from the last encrypted record of the log files
+func NewEncryptWriter(writer io.Writer, key []byte, logPath string) (*EncryptWriter, error) {
+	aead, err := newRecordCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	res := &EncryptWriter{writer: writer, aead: aead}
+	files, err := LogFiles(logPath)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(files) - 1; i >= 0 && res.seq == 0; i-- {
+		if res.seq, err = lastEncryptedSeq(files[i]); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// lastEncryptedSeq returns the sequence number of the last v2 record of the file, it is not authenticated here
+func lastEncryptedSeq(name string) (uint64, error) {
+	f, err := OpenRecordFile(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var res uint64
+	err = scanLines(f, func(line int, data []byte) error {
+		if seq, _, ok := splitEncrypted(data); ok {
+			res = seq
+		}
+		return nil
+	})
+	return res, err
+}
+
+// splitEncrypted parses the v2 record
+func splitEncrypted(line []byte) (seq uint64, sealed string, ok bool) {
+	if !bytes.HasPrefix(line, []byte(encryptedPrefix)) {
+		return 0, "", false
+	}
+	text, sealed, found := strings.Cut(string(line[len(encryptedPrefix):]), ":")
+	if !found {
+		return 0, "", false
+	}
+	seq, err := strconv.ParseUint(text, 10, 64)
+	return seq, sealed, err == nil && seq > 0
+}
+
+func (v *EncryptWriter) Write(p []byte) (int, error) {
+	record := bytes.TrimRight(p, "\r\n")
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return 0, err
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	seq := v.seq + 1
+	sealed := v.aead.Seal(nonce, nonce, record, recordAAD(seq))
+	line := make([]byte, 0, len(encryptedPrefix)+24+base64.StdEncoding.EncodedLen(len(sealed)))
+	line = append(line, encryptedPrefix...)
+	line = strconv.AppendUint(line, seq, 10)
+	line = append(line, ':')
+	line = base64.StdEncoding.AppendEncode(line, sealed)
+	line = append(line, '\n')
+	if _, err := v.writer.Write(line); err != nil {
+		return 0, err
+	}
+	v.seq = seq
+	return len(p), nil
+}
+
+func (v *EncryptWriter) Close() error {
+	if c, ok := v.writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// IsEncryptedLine checks the record prefix, plain records may precede encrypted ones
+func IsEncryptedLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte(encryptedPrefix)) || bytes.HasPrefix(line, []byte(encryptedPrefixV1))
+}
+
+// LineDecryptor creates decoders of encrypted lines
+type LineDecryptor struct {
+	aead cipher.AEAD
+}
+
+func NewLineDecryptor(key []byte) (*LineDecryptor, error) {
+	aead, err := newRecordCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &LineDecryptor{aead}, nil
+}
+
+// Decoder returns a LineDecoder of one pass over files in order (oldest first). Plain lines are kept
+// until the first encrypted one, then plain lines and gaps in the sequence are errors. The first
+// record may have any number, older files could be removed by retention
+func (v *LineDecryptor) Decoder() LineDecoder {
+	var (
+		encrypted bool
+		last      uint64
+	)
+	return func(line []byte) ([]byte, error) {
+		line = bytes.TrimRight(line, "\r\n")
+		if !IsEncryptedLine(line) {
+			if encrypted {
+				return nil, fmt.Errorf("plain record after encrypted ones")
+			}
+			return line, nil
+		}
+		encrypted = true
+		if bytes.HasPrefix(line, []byte(encryptedPrefixV1)) {
+			if last != 0 {
+				return nil, fmt.Errorf("encrypted record v1 after record %d", last)
+			}
+			return v.open(string(line[len(encryptedPrefixV1):]), []byte(encryptionAADV1))
+		}
+		seq, sealed, ok := splitEncrypted(line)
+		if !ok {
+			return nil, fmt.Errorf("encrypted record: invalid sequence number")
+		}
+		if last != 0 && seq != last+1 {
+			return nil, fmt.Errorf("encrypted record %d after record %d", seq, last)
+		}
+		record, err := v.open(sealed, recordAAD(seq))
+		if err != nil {
+			return nil, err
+		}
+		last = seq
+		return record, nil
+	}
+}
+
+func (v *LineDecryptor) open(text string, aad []byte) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted record: %w", err)
+	}
+	if len(sealed) < v.aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted record is too short")
+	}
+	record, err := v.aead.Open(nil, sealed[:v.aead.NonceSize()], sealed[v.aead.NonceSize():], aad)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted record: wrong key or record was changed")
+	}
+	return record, nil
+}
+
+// Sealer encrypts records of the stores next to the log by the log key, so with log
+// encryption no proxy settings are kept on disk as plain text. A nil Sealer keeps records as is
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+func NewSealer(key []byte) (*Sealer, error) {
+	aead, err := newRecordCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead}, nil
+}
+
+// Seal returns one line without line breaks
+func (v *Sealer) Seal(store string, data []byte) ([]byte, error) {
+	if v == nil {
+		return data, nil
+	}
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := v.aead.Seal(nonce, nonce, data, []byte(sealedAAD+store))
+	return base64.StdEncoding.AppendEncode([]byte(sealedPrefix), sealed), nil
+}
+
+// Open decrypts the sealed record, plain records (written before encryption was enabled) are returned as is
+func (v *Sealer) Open(store string, data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	if !bytes.HasPrefix(data, []byte(sealedPrefix)) {
+		return data, nil
+	}
+	if v == nil {
+		return nil, fmt.Errorf("%v record is encrypted, but log encryption is disabled", store)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(data[len(sealedPrefix):]))
+	if err != nil {
+		return nil, fmt.Errorf("encrypted %v record: %w", store, err)
+	}
+	if len(sealed) < v.aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted %v record is too short", store)
+	}
+	res, err := v.aead.Open(nil, sealed[:v.aead.NonceSize()], sealed[v.aead.NonceSize():], []byte(sealedAAD+store))
+	if err != nil {
+		return nil, fmt.Errorf("encrypted %v record: wrong key or record was changed", store)
+	}
+	return res, nil
+}
+
+// scanLines calls fn for every non-empty line
+func scanLines(r io.Reader, fn func(line int, data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if err := fn(line, scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// DecryptRecords copies files to w with decrypted records, returns the number of records
+func DecryptRecords(w io.Writer, files []string, decode LineDecoder) (int, error) {
+	count := 0
+	for _, name := range files {
+		f, err := OpenRecordFile(name)
+		if err != nil {
+			return count, err
+		}
+		err = scanLines(f, func(line int, data []byte) error {
+			record, err := decode(data)
+			if err != nil {
+				return fmt.Errorf("%v:%d: %w", name, line, err)
+			}
+			count++
+			_, err = w.Write(append(record, '\n'))
+			return err
+		})
+		f.Close()
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,139 @@
+package journal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeEncrypted writes records through a new writer, so the sequence is restored from the file
+func writeEncrypted(t *testing.T, path string, key []byte, records ...string) {
+	f, err := OpenRotatingFile(path, RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewEncryptWriter(f, key, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if _, err := fmt.Fprintln(w, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func decryptLines(key []byte, lines []string) (string, error) {
+	d, err := NewLineDecryptor(key)
+	if err != nil {
+		return "", err
+	}
+	decode := d.Decoder()
+	var res []string
+	for _, line := range lines {
+		record, err := decode([]byte(line))
+		if err != nil {
+			return strings.Join(res, ","), err
+		}
+		res = append(res, string(record))
+	}
+	return strings.Join(res, ","), nil
+}
+
+// sealV1 is the record format of the previous version
+func sealV1(t *testing.T, key []byte, record string) string {
+	aead, err := newRecordCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	return encryptedPrefixV1 + base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(record), []byte(encryptionAADV1)))
+}
+
+func TestEncryptedRecords(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, logKeySize)
+	path := filepath.Join(t.TempDir(), "test.log")
+	writeEncrypted(t, path, key, "a", "b")
+	writeEncrypted(t, path, key, "c", "d")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[3], encryptedPrefix+"4:") {
+		t.Fatalf("sequence is not continued after reopening: %q", lines)
+	}
+	v1 := sealV1(t, key, "old")
+
+	// the sealed sequence number of another record
+	_, sealed, _ := splitEncrypted([]byte(lines[2]))
+	renumbered := encryptedPrefix + "2:" + sealed
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+		err   string
+	}{
+		{"all", lines, "a,b,c,d", ""},
+		{"retention", lines[2:], "c,d", ""},
+		{"legacy", []string{"plain", v1, lines[0], lines[1]}, "plain,old,a,b", ""},
+		{"removed", []string{lines[0], lines[2]}, "a", "record 3 after record 1"},
+		{"reordered", []string{lines[1], lines[0]}, "b", "record 1 after record 2"},
+		{"renumbered", []string{lines[0], renumbered}, "a", "record was changed"},
+		{"plain inserted", []string{lines[0], "plain", lines[1]}, "a", "plain record after encrypted ones"},
+		{"v1 inserted", []string{lines[0], v1}, "a", "v1 after record 1"},
+	}
+	for _, test := range tests {
+		got, err := decryptLines(key, test.lines)
+		if got != test.want {
+			t.Errorf("%v: records %q, want %q", test.name, got, test.want)
+		}
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%v: error %v, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestKeyFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.key")
+	reader := &FileKeyProvider{Path: name}
+	if _, err := reader.Key(); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("load of missing key: %v", err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("key is created by the reader: %v", err)
+	}
+	key, err := (&FileKeyProvider{Path: name, Create: true}).Key()
+	if err != nil || len(key) != logKeySize {
+		t.Fatalf("created key %x: %v", key, err)
+	}
+	if loaded, err := reader.Key(); err != nil || !bytes.Equal(loaded, key) {
+		t.Errorf("loaded key %x, want %x: %v", loaded, key, err)
+	}
+
+	tests := []struct {
+		text string
+		ok   bool
+	}{
+		{strings.Repeat("ab", logKeySize), true},
+		{base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, logKeySize)), true},
+		{strings.Repeat("ab", logKeySize-1), false},
+		{"correct horse battery staple", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if _, err := decodeKeyText(test.text); (err == nil) != test.ok {
+			t.Errorf("key %q: %v", test.text, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package journal
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+func init() {
+	keyProviders[KEY_PROVIDER_DPAPI] = func(opts EncryptionOptions, create bool) KeyProvider {
+		return &DPAPIKeyProvider{opts.KeyFile, create}
+	}
+}
+
+// DPAPIKeyProvider keeps the key in a file protected by DPAPI, so only the same
+// Windows user can decrypt it
+type DPAPIKeyProvider struct {
+	Path   string
+	Create bool
+}
+
+func (v *DPAPIKeyProvider) Key() ([]byte, error) {
+	return loadOrCreateKey(v.Path, v.Create, dpapiUnprotect, dpapiProtect)
+}
+
+func dataBlob(data []byte) *windows.DataBlob {
+	if len(data) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+}
+
+// blobBytes copies the output of DPAPI and frees it
+func blobBytes(blob *windows.DataBlob) []byte {
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(blob.Data)))
+	return append([]byte{}, unsafe.Slice(blob.Data, blob.Size)...)
+}
+
+func dpapiProtect(data []byte) ([]byte, error) {
+	var out windows.DataBlob
+	name, err := windows.UTF16PtrFromString(EVENTLOG_SOURCE + " log key")
+	if err != nil {
+		return nil, err
+	}
+	if err := windows.CryptProtectData(dataBlob(data), name, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	return blobBytes(&out), nil
+}
+
+func dpapiUnprotect(data []byte) ([]byte, error) {
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(dataBlob(data), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	return checkKey(blobBytes(&out))
+}
@@ -0,0 +1,133 @@
+package journal
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DEFAULT_SINK_BUFFER = 256
+
+	dispatcherCloseTimeout = 5 * time.Second
+)
+
+type SinkErrorHandler = func(name string, err error)
+
+type route struct {
+	name    string
+	sink    Sink
+	filter  Filter
+	queue   chan *Event
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+	done    chan struct{}
+}
+
+// Dispatcher fans events out to sinks. Every sink has its own goroutine and
+// bounded queue: Dispatch never blocks, events for a stuck sink are dropped
+type Dispatcher struct {
+	mutex   sync.RWMutex
+	routes  []*route
+	closed  bool
+	onError SinkErrorHandler
+}
+
+func NewDispatcher(onError SinkErrorHandler) *Dispatcher {
+	if onError == nil {
+		onError = func(name string, err error) {
+			fmt.Printf("Sink %v error: %v\n", name, err)
+		}
+	}
+	return &Dispatcher{onError: onError}
+}
+
+func (v *Dispatcher) Add(name string, sink Sink, filter Filter, buffer int) {
+	if buffer <= 0 {
+		buffer = DEFAULT_SINK_BUFFER
+	}
+	r := &route{name: name, sink: sink, filter: filter, queue: make(chan *Event, buffer), done: make(chan struct{})}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.closed {
+		sink.Close()
+		return
+	}
+	v.routes = append(v.routes, r)
+	go v.run(r)
+}
+
+func (v *Dispatcher) run(r *route) {
+	defer close(r.done)
+	for e := range r.queue {
+		if err := r.sink.Write(e); err != nil {
+			r.failed.Add(1)
+			v.onError(r.name, err)
+		}
+	}
+	if err := r.sink.Close(); err != nil {
+		v.onError(r.name, err)
+	}
+}
+
+func (v *Dispatcher) Dispatch(e *Event) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	if v.closed {
+		return
+	}
+	for _, r := range v.routes {
+		if !r.filter.Match(e) {
+			continue
+		}
+		select {
+		case r.queue <- e:
+		default:
+			if r.dropped.Add(1) == 1 {
+				v.onError(r.name, fmt.Errorf("sink queue is full, events are dropped"))
+			}
+		}
+	}
+}
+
+type SinkStats struct {
+	Name    string
+	Pending int
+	Dropped uint64
+	Failed  uint64
+}
+
+func (v *Dispatcher) Stats() []SinkStats {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	res := make([]SinkStats, len(v.routes))
+	for i, r := range v.routes {
+		res[i] = SinkStats{r.name, len(r.queue), r.dropped.Load(), r.failed.Load()}
+	}
+	return res
+}
+
+// Close delivers queued events and closes sinks, sinks which do not finish in time are abandoned
+func (v *Dispatcher) Close() {
+	v.mutex.Lock()
+	if v.closed {
+		v.mutex.Unlock()
+		return
+	}
+	v.closed = true
+	routes := v.routes
+	for _, r := range routes {
+		close(r.queue)
+	}
+	v.mutex.Unlock()
+	timeout := time.After(dispatcherCloseTimeout)
+	for _, r := range routes {
+		select {
+		case <-r.done:
+		case <-timeout:
+			v.onError(r.name, fmt.Errorf("sink is not closed in time"))
+			return
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package journal
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSink collects events, Write blocks while release is not closed
+type testSink struct {
+	mutex   sync.Mutex
+	events  []*Event
+	closed  bool
+	err     error
+	writing chan struct{} // gets a value on every Write
+	release chan struct{}
+}
+
+func newTestSink(blocked bool) *testSink {
+	res := &testSink{writing: make(chan struct{}, 100), release: make(chan struct{})}
+	if !blocked {
+		close(res.release)
+	}
+	return res
+}
+
+func (v *testSink) Write(e *Event) error {
+	select {
+	case v.writing <- struct{}{}:
+	default:
+	}
+	<-v.release
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.events = append(v.events, e)
+	return v.err
+}
+
+func (v *testSink) Close() error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.closed = true
+	return nil
+}
+
+// messages lists messages of received events
+func (v *testSink) messages() string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	var res []string
+	for _, e := range v.events {
+		res = append(res, e.Message)
+	}
+	return strings.Join(res, ",")
+}
+
+func (v *testSink) isClosed() bool {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.closed
+}
+
+type sinkErrors struct {
+	mutex  sync.Mutex
+	errors []string
+}
+
+func (v *sinkErrors) handle(name string, err error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.errors = append(v.errors, name+": "+err.Error())
+}
+
+func (v *sinkErrors) String() string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return strings.Join(v.errors, "; ")
+}
+
+func dispatchTestEvent(t EventType, severity Severity, source, message string) *Event {
+	e := NewEvent(t, severity, message)
+	e.Source = source
+	return e
+}
+
+func TestDispatcherIsolation(t *testing.T) {
+	var errors sinkErrors
+	d := NewDispatcher(errors.handle)
+	blocked, fast, filtered := newTestSink(true), newTestSink(false), newTestSink(false)
+	d.Add("blocked", blocked, Filter{}, 2)
+	d.Add("fast", fast, Filter{}, 0)
+	d.Add("filtered", filtered, Filter{MinSeverity: SEVERITY_ERROR}, 0)
+
+	d.Dispatch(NewEvent(EVENT_INTERNAL_ERROR, SEVERITY_ERROR, "0"))
+	select {
+	case <-blocked.writing:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first event is not written")
+	}
+	// the blocked sink holds event 0 and queues 1 and 2, the others are dropped
+	var all []string
+	all = append(all, "0")
+	for i := 1; i <= 10; i++ {
+		d.Dispatch(NewEvent(EVENT_MONITOR_STARTED, SEVERITY_INFO, fmt.Sprint(i)))
+		all = append(all, fmt.Sprint(i))
+	}
+	stats := d.Stats()
+	if fmt.Sprint(stats[0]) != "{blocked 2 8 0}" {
+		t.Errorf("blocked sink stats %v", stats[0])
+	}
+	if stats[1].Dropped != 0 || stats[2].Dropped != 0 {
+		t.Errorf("stats %v", stats)
+	}
+	if errors.String() != "blocked: sink queue is full, events are dropped" {
+		t.Errorf("errors %q", errors.String())
+	}
+
+	close(blocked.release)
+	d.Close()
+	if got := blocked.messages(); got != "0,1,2" {
+		t.Errorf("blocked sink events %v", got)
+	}
+	if got := fast.messages(); got != strings.Join(all, ",") {
+		t.Errorf("fast sink events %v", got)
+	}
+	if got := filtered.messages(); got != "0" {
+		t.Errorf("filtered sink events %v", got)
+	}
+	for _, s := range []*testSink{blocked, fast, filtered} {
+		if !s.isClosed() {
+			t.Errorf("sink is not closed")
+		}
+	}
+	if errors.String() != "blocked: sink queue is full, events are dropped" {
+		t.Errorf("errors %q", errors.String())
+	}
+}
+
+func TestDispatcherFailures(t *testing.T) {
+	var errors sinkErrors
+	d := NewDispatcher(errors.handle)
+	failing := newTestSink(false)
+	failing.err = fmt.Errorf("disk is full")
+	d.Add("failing", failing, Filter{}, 0)
+	d.Dispatch(NewEvent(EVENT_MONITOR_STARTED, SEVERITY_INFO, "1"))
+	d.Dispatch(NewEvent(EVENT_MONITOR_STOPPED, SEVERITY_INFO, "2"))
+	d.Close()
+	if stats := d.Stats(); stats[0].Failed != 2 || stats[0].Dropped != 0 {
+		t.Errorf("stats %v", stats)
+	}
+	if errors.String() != "failing: disk is full; failing: disk is full" {
+		t.Errorf("errors %q", errors.String())
+	}
+
+	// after Close events are ignored and new sinks are closed at once
+	d.Dispatch(NewEvent(EVENT_MONITOR_STARTED, SEVERITY_INFO, "3"))
+	late := newTestSink(false)
+	d.Add("late", late, Filter{}, 0)
+	if !late.isClosed() || late.messages() != "" || len(d.Stats()) != 1 {
+		t.Errorf("sink added after Close: closed %v, events %q", late.isClosed(), late.messages())
+	}
+	d.Close()
+}
+
+func TestFilter(t *testing.T) {
+	changed := dispatchTestEvent(EVENT_PROXY_CHANGED, SEVERITY_INFO, "user", "")
+	stopped := dispatchTestEvent(EVENT_MONITOR_STOPPED, SEVERITY_WARNING, "machine", "")
+	failure := dispatchTestEvent(EVENT_INTERNAL_ERROR, SEVERITY_ERROR, "", "")
+	tests := []struct {
+		name   string
+		filter Filter
+		match  string // of changed, stopped, failure
+	}{
+		{"empty", Filter{}, "+++"},
+		{"warnings", Filter{MinSeverity: SEVERITY_WARNING}, "-++"},
+		{"errors", Filter{MinSeverity: SEVERITY_ERROR}, "--+"},
+		{"types", Filter{Types: []EventType{EVENT_PROXY_CHANGED, EVENT_MONITOR_STOPPED}}, "++-"},
+		{"sources", Filter{Sources: []string{"user"}}, "+-+"}, // events without source pass
+		{"all", Filter{Types: []EventType{EVENT_MONITOR_STOPPED, EVENT_INTERNAL_ERROR}, MinSeverity: SEVERITY_WARNING, Sources: []string{"user"}}, "--+"},
+	}
+	for _, test := range tests {
+		got := ""
+		for _, e := range []*Event{changed, stopped, failure} {
+			if test.filter.Match(e) {
+				got += "+"
+			} else {
+				got += "-"
+			}
+		}
+		if got != test.match {
+			t.Errorf("%v: %v, want %v", test.name, got, test.match)
+		}
+	}
+}
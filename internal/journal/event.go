@@ -0,0 +1,239 @@
+package journal
+
+import (
+	"fmt"
+	"time"
+)
+
+type EventType int
+
+const (
+	EVENT_PROXY_CHANGED EventType = iota
+	EVENT_MONITOR_STARTED
+	EVENT_MONITOR_STOPPED
+	EVENT_INTERNAL_ERROR
+	EVENT_MONITOR_QUIT
+	EVENT_CONTROL_ACTION // action which has not changed the monitor state
+	EVENT_OFFLINE_CHANGE // settings differ from the saved ones on start
+	EVENT_PROXY_UNCHANGED
+	EVENT_MONITOR_PAUSED // stopped until the given time
+	EVENT_PROXY_SNAPSHOT // settings read on request, it is not a change
+)
+
+var eventTypeNames = map[EventType]string{
+	EVENT_PROXY_CHANGED:   "proxy-changed",
+	EVENT_MONITOR_STARTED: "monitor-started",
+	EVENT_MONITOR_STOPPED: "monitor-stopped",
+	EVENT_INTERNAL_ERROR:  "internal-error",
+	EVENT_MONITOR_QUIT:    "monitor-quit",
+	EVENT_CONTROL_ACTION:  "control-action",
+	EVENT_OFFLINE_CHANGE:  "offline-change",
+	EVENT_PROXY_UNCHANGED: "proxy-unchanged",
+	EVENT_MONITOR_PAUSED:  "monitor-paused",
+	EVENT_PROXY_SNAPSHOT:  "proxy-snapshot",
+}
+
+// texts of lifecycle events in the text format
+var lifecycleTexts = map[EventType]string{
+	EVENT_MONITOR_STARTED: "monitor started",
+	EVENT_MONITOR_STOPPED: "monitor stopped",
+	EVENT_INTERNAL_ERROR:  "internal error",
+	EVENT_MONITOR_QUIT:    "monitor quit",
+	EVENT_CONTROL_ACTION:  "control action",
+	EVENT_MONITOR_PAUSED:  "monitor paused",
+}
+
+func IsLifecycleEvent(t EventType) bool {
+	_, ok := lifecycleTexts[t]
+	return ok
+}
+
+func (v EventType) String() string {
+	if name, ok := eventTypeNames[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("event-%d", int(v))
+}
+
+func ParseEventType(name string) (EventType, error) {
+	for k, v := range eventTypeNames {
+		if v == name {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown event type %q", name)
+}
+
+func (v EventType) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *EventType) UnmarshalText(data []byte) error {
+	t, err := ParseEventType(string(data))
+	if err == nil {
+		*v = t
+	}
+	return err
+}
+
+type Severity int
+
+const (
+	SEVERITY_INFO Severity = iota
+	SEVERITY_WARNING
+	SEVERITY_ERROR
+)
+
+var severityNames = map[Severity]string{
+	SEVERITY_INFO:    "info",
+	SEVERITY_WARNING: "warning",
+	SEVERITY_ERROR:   "error",
+}
+
+func (v Severity) String() string {
+	if name, ok := severityNames[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("severity-%d", int(v))
+}
+
+func ParseSeverity(name string) (Severity, error) {
+	for k, v := range severityNames {
+		if v == name {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %q", name)
+}
+
+func (v Severity) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *Severity) UnmarshalText(data []byte) error {
+	s, err := ParseSeverity(string(data))
+	if err == nil {
+		*v = s
+	}
+	return err
+}
+
+// IsStateEvent returns true for events which set the current proxy settings of a source
+func IsStateEvent(t EventType) bool {
+	return t == EVENT_PROXY_CHANGED || t == EVENT_OFFLINE_CHANGE
+}
+
+const (
+	offlineChangeText = "changed while not monitored"
+	unchangedText     = "unchanged since"
+	snapshotText      = "snapshot"
+)
+
+// settings are read from HKEY_CURRENT_USER\...\Internet Settings
+const SOURCE_USER = "HKCU"
+
+type Snapshot struct {
+	Enabled bool   `json:"enabled"`
+	Server  string `json:"server,omitempty"`
+}
+
+func (v Snapshot) String() string {
+	if v.Enabled {
+		return "proxy on, " + v.Server
+	}
+	return "proxy off"
+}
+
+type Event struct {
+	Time     time.Time  `json:"time"`
+	Type     EventType  `json:"type"`
+	Severity Severity   `json:"severity"`
+	Source   string     `json:"source,omitempty"`
+	Snapshot *Snapshot  `json:"snapshot,omitempty"`
+	Previous *Snapshot  `json:"previous,omitempty"`
+	Origin   string     `json:"origin,omitempty"` // who has initiated a lifecycle event: tray, remote, startup, ...
+	Since    *time.Time `json:"since,omitempty"`  // proxy-unchanged: when the settings were observed first
+	Message  string     `json:"message,omitempty"`
+}
+
+func NewEvent(eventType EventType, severity Severity, message string) *Event {
+	return &Event{Time: time.Now(), Type: eventType, Severity: severity, Message: message}
+}
+
+func NewLifecycleEvent(eventType EventType, origin, message string) *Event {
+	e := NewEvent(eventType, SEVERITY_INFO, message)
+	e.Origin = origin
+	return e
+}
+
+// NewProxyEvent creates a change record, previous is nil for the first record after start
+func NewProxyEvent(source string, current Snapshot, previous *Snapshot) *Event {
+	e := NewEvent(EVENT_PROXY_CHANGED, SEVERITY_INFO, "")
+	e.Source, e.Snapshot = source, &current
+	if previous != nil {
+		p := *previous
+		e.Previous = &p
+	}
+	return e
+}
+
+// NewOfflineChangeEvent is written on start when the settings differ from the
+// saved ones, window is the time without monitoring
+func NewOfflineChangeEvent(source string, current, previous Snapshot, window time.Duration) *Event {
+	e := NewProxyEvent(source, current, &previous)
+	e.Type, e.Severity, e.Message = EVENT_OFFLINE_CHANGE, SEVERITY_WARNING, unmonitoredMessage(window)
+	return e
+}
+
+// NewUnchangedEvent is written on start when the settings are the same as the saved ones
+func NewUnchangedEvent(source string, current Snapshot, since time.Time, window time.Duration) *Event {
+	e := NewProxyEvent(source, current, nil)
+	e.Type, e.Since, e.Message = EVENT_PROXY_UNCHANGED, &since, unmonitoredMessage(window)
+	return e
+}
+
+// NewSnapshotEvent is the checkpoint of the current settings requested by origin
+func NewSnapshotEvent(source string, current Snapshot, origin string) *Event {
+	e := NewProxyEvent(source, current, nil)
+	e.Type, e.Origin = EVENT_PROXY_SNAPSHOT, origin
+	return e
+}
+
+func unmonitoredMessage(window time.Duration) string {
+	return "not monitored for " + window.Round(time.Second).String()
+}
+
+// Text returns a short human readable description of the event
+func (v *Event) Text() string {
+	if v.Type == EVENT_PROXY_CHANGED && v.Snapshot != nil {
+		return v.Snapshot.String()
+	}
+	if v.Type == EVENT_OFFLINE_CHANGE && v.Snapshot != nil && v.Previous != nil {
+		return offlineChangeText + ": " + v.Previous.String() + " -> " + v.Snapshot.String() + " (" + v.Message + ")"
+	}
+	if v.Type == EVENT_PROXY_UNCHANGED && v.Snapshot != nil && v.Since != nil {
+		return unchangedText + " " + v.Since.Format(TIME_FORMAT) + ": " + v.Snapshot.String() + " (" + v.Message + ")"
+	}
+	if v.Type == EVENT_PROXY_SNAPSHOT && v.Snapshot != nil {
+		return withOrigin(snapshotText, v.Origin) + ": " + v.Snapshot.String()
+	}
+	text, ok := lifecycleTexts[v.Type]
+	if !ok {
+		text = v.Type.String()
+	}
+	return joinMessage(withOrigin(text, v.Origin), v.Message)
+}
+
+func withOrigin(text, origin string) string {
+	if origin == "" {
+		return text
+	}
+	return text + " [" + origin + "]"
+}
+
+func joinMessage(text, message string) string {
+	if message == "" {
+		return text
+	}
+	return text + ": " + message
+}
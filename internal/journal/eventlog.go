@@ -0,0 +1,106 @@
+package journal
+
+import (
+	"strings"
+	"time"
+)
+
+const EVENTLOG_SOURCE = "proxyMon"
+
+// Event IDs are part of the SOC contract and must never be renumbered.
+// The source is registered with EventCreate.exe as message file, which allows ids 1..1000 only
+const (
+	EVENT_ID_PROXY_CHANGED   uint32 = 100
+	EVENT_ID_OFFLINE_CHANGE  uint32 = 101
+	EVENT_ID_PROXY_UNCHANGED uint32 = 102
+	EVENT_ID_PROXY_SNAPSHOT  uint32 = 103
+	EVENT_ID_MONITOR_STARTED uint32 = 200
+	EVENT_ID_MONITOR_STOPPED uint32 = 201
+	EVENT_ID_MONITOR_QUIT    uint32 = 202
+	EVENT_ID_MONITOR_PAUSED  uint32 = 203
+	EVENT_ID_CONTROL_ACTION  uint32 = 300
+	EVENT_ID_INTERNAL_ERROR  uint32 = 900
+	EVENT_ID_UNKNOWN         uint32 = 999
+)
+
+var eventIDs = map[EventType]uint32{
+	EVENT_PROXY_CHANGED:   EVENT_ID_PROXY_CHANGED,
+	EVENT_MONITOR_STARTED: EVENT_ID_MONITOR_STARTED,
+	EVENT_MONITOR_STOPPED: EVENT_ID_MONITOR_STOPPED,
+	EVENT_INTERNAL_ERROR:  EVENT_ID_INTERNAL_ERROR,
+	EVENT_MONITOR_QUIT:    EVENT_ID_MONITOR_QUIT,
+	EVENT_CONTROL_ACTION:  EVENT_ID_CONTROL_ACTION,
+	EVENT_OFFLINE_CHANGE:  EVENT_ID_OFFLINE_CHANGE,
+	EVENT_PROXY_UNCHANGED: EVENT_ID_PROXY_UNCHANGED,
+	EVENT_MONITOR_PAUSED:  EVENT_ID_MONITOR_PAUSED,
+	EVENT_PROXY_SNAPSHOT:  EVENT_ID_PROXY_SNAPSHOT,
+}
+
+func EventID(t EventType) uint32 {
+	if id, ok := eventIDs[t]; ok {
+		return id
+	}
+	return EVENT_ID_UNKNOWN
+}
+
+// EventLogWriter is implemented by *eventlog.Log on Windows
+type EventLogWriter interface {
+	Info(id uint32, msg string) error
+	Warning(id uint32, msg string) error
+	Error(id uint32, msg string) error
+	Close() error
+}
+
+type EventLogSink struct {
+	writer EventLogWriter
+}
+
+func NewEventLogSink(writer EventLogWriter) *EventLogSink {
+	return &EventLogSink{writer}
+}
+
+func (v *EventLogSink) Write(e *Event) error {
+	id, msg := EventID(e.Type), FormatEventLogMessage(e)
+	switch e.Severity {
+	case SEVERITY_ERROR:
+		return v.writer.Error(id, msg)
+	case SEVERITY_WARNING:
+		return v.writer.Warning(id, msg)
+	}
+	return v.writer.Info(id, msg)
+}
+
+func (v *EventLogSink) Close() error {
+	return v.writer.Close()
+}
+
+func FormatEventLogMessage(e *Event) string {
+	lines := []string{e.Text()}
+	if e.Source != "" {
+		lines = append(lines, "Source: "+e.Source)
+	}
+	if e.Snapshot != nil {
+		lines = append(lines, "Proxy enabled: "+onOff(e.Snapshot.Enabled))
+		if e.Snapshot.Server != "" {
+			lines = append(lines, "Proxy server: "+e.Snapshot.Server)
+		}
+	}
+	if e.Previous != nil {
+		lines = append(lines, "Previous: "+e.Previous.String())
+	}
+	if e.Since != nil {
+		lines = append(lines, "Since: "+e.Since.Format(time.RFC3339Nano))
+	}
+	if e.Origin != "" {
+		lines = append(lines, "Origin: "+e.Origin)
+	}
+	lines = append(lines, "Time: "+e.Time.Format(time.RFC3339Nano))
+	return strings.Join(lines, "\r\n")
+}
+
+func onOff(value bool) string {
+	if value {
+		return "on"
+	}
+	return "off"
+}
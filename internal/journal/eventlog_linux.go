@@ -0,0 +1,17 @@
+package journal
+
+import "errors"
+
+var errEventLogUnsupported = errors.New("Windows Event Log is not supported on this system")
+
+func OpenEventLog(source string) (*EventLogSink, error) {
+	return nil, errEventLogUnsupported
+}
+
+func InstallEventSource(source string) error {
+	return errEventLogUnsupported
+}
+
+func RemoveEventSource(source string) error {
+	return errEventLogUnsupported
+}
@@ -0,0 +1,108 @@
+package journal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeEventLog records entries instead of the Windows Event Log
+type fakeEventLog struct {
+	entries []string
+	closed  bool
+}
+
+func (v *fakeEventLog) add(level string, id uint32, msg string) error {
+	v.entries = append(v.entries, fmt.Sprintf("%v %d %v", level, id, msg))
+	return nil
+}
+
+func (v *fakeEventLog) Info(id uint32, msg string) error    { return v.add("info", id, msg) }
+func (v *fakeEventLog) Warning(id uint32, msg string) error { return v.add("warning", id, msg) }
+func (v *fakeEventLog) Error(id uint32, msg string) error   { return v.add("error", id, msg) }
+
+func (v *fakeEventLog) Close() error {
+	v.closed = true
+	return nil
+}
+
+func TestEventIDs(t *testing.T) {
+	// the ids are the SOC contract, the table must be changed only by adding rows
+	tests := []struct {
+		eventType EventType
+		id        uint32
+	}{
+		{EVENT_PROXY_CHANGED, 100},
+		{EVENT_OFFLINE_CHANGE, 101},
+		{EVENT_PROXY_UNCHANGED, 102},
+		{EVENT_PROXY_SNAPSHOT, 103},
+		{EVENT_MONITOR_STARTED, 200},
+		{EVENT_MONITOR_STOPPED, 201},
+		{EVENT_MONITOR_QUIT, 202},
+		{EVENT_MONITOR_PAUSED, 203},
+		{EVENT_CONTROL_ACTION, 300},
+		{EVENT_INTERNAL_ERROR, 900},
+		{EventType(1000), EVENT_ID_UNKNOWN},
+	}
+	for _, test := range tests {
+		if id := EventID(test.eventType); id != test.id {
+			t.Errorf("EventID(%v) = %d, want %d", test.eventType, id, test.id)
+		}
+	}
+	for eventType := range eventTypeNames {
+		if id := EventID(eventType); id == EVENT_ID_UNKNOWN || id < 1 || id > 1000 {
+			t.Errorf("%v has no valid id: %d", eventType, id)
+		}
+	}
+}
+
+func TestEventLogSink(t *testing.T) {
+	at := time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)
+	since := at.Add(-time.Hour)
+	changed := NewProxyEvent(SOURCE_USER, Snapshot{Enabled: true, Server: "10.0.0.1:3128"}, &Snapshot{})
+	offline := NewOfflineChangeEvent(SOURCE_USER, Snapshot{}, Snapshot{Enabled: true, Server: "p:8080"}, 2*time.Hour)
+	unchanged := NewUnchangedEvent(SOURCE_USER, Snapshot{}, since, time.Minute)
+	snapshot := NewSnapshotEvent(SOURCE_USER, Snapshot{Enabled: true, Server: "10.0.0.1:3128"}, "remote")
+	started := NewLifecycleEvent(EVENT_MONITOR_STARTED, "tray", "")
+	failed := NewEvent(EVENT_INTERNAL_ERROR, SEVERITY_ERROR, "access denied")
+	for _, e := range []*Event{changed, offline, unchanged, snapshot, started, failed} {
+		e.Time = at
+	}
+	tests := []struct {
+		event *Event
+		want  string
+	}{
+		{changed, "info 100 proxy on, 10.0.0.1:3128\r\nSource: HKCU\r\nProxy enabled: on\r\nProxy server: 10.0.0.1:3128\r\n" +
+			"Previous: proxy off\r\nTime: 2026-10-19T09:30:00Z"},
+		{offline, "warning 101 changed while not monitored: proxy on, p:8080 -> proxy off (not monitored for 2h0m0s)\r\n" +
+			"Source: HKCU\r\nProxy enabled: off\r\nPrevious: proxy on, p:8080\r\nTime: 2026-10-19T09:30:00Z"},
+		{unchanged, "info 102 unchanged since " + since.Format(TIME_FORMAT) + ": proxy off (not monitored for 1m0s)\r\n" +
+			"Source: HKCU\r\nProxy enabled: off\r\nSince: 2026-10-19T08:30:00Z\r\nTime: 2026-10-19T09:30:00Z"},
+		{snapshot, "info 103 snapshot [remote]: proxy on, 10.0.0.1:3128\r\nSource: HKCU\r\nProxy enabled: on\r\n" +
+			"Proxy server: 10.0.0.1:3128\r\nOrigin: remote\r\nTime: 2026-10-19T09:30:00Z"},
+		{started, "info 200 monitor started [tray]\r\nOrigin: tray\r\nTime: 2026-10-19T09:30:00Z"},
+		{failed, "error 900 internal error: access denied\r\nTime: 2026-10-19T09:30:00Z"},
+	}
+	log := &fakeEventLog{}
+	sink := NewEventLogSink(log)
+	for _, test := range tests {
+		if err := sink.Write(test.event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil || !log.closed {
+		t.Errorf("sink is not closed: %v", err)
+	}
+	if len(log.entries) != len(tests) {
+		t.Fatalf("%d entries, want %d", len(log.entries), len(tests))
+	}
+	for i, test := range tests {
+		if log.entries[i] != test.want {
+			t.Errorf("entry %d:\n%q\nwant\n%q", i, log.entries[i], test.want)
+		}
+		if strings.Contains(strings.ReplaceAll(log.entries[i], "\r\n", ""), "\n") {
+			t.Errorf("entry %d has bare new lines", i)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package journal
+
+import (
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+func OpenEventLog(source string) (*EventLogSink, error) {
+	if source == "" {
+		source = EVENTLOG_SOURCE
+	}
+	l, err := eventlog.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	return NewEventLogSink(l), nil
+}
+
+// InstallEventSource registers the source in the Application log (requires administrator rights)
+func InstallEventSource(source string) error {
+	if source == "" {
+		source = EVENTLOG_SOURCE
+	}
+	return eventlog.InstallAsEventCreate(source, eventlog.Error|eventlog.Warning|eventlog.Info)
+}
+
+func RemoveEventSource(source string) error {
+	if source == "" {
+		source = EVENTLOG_SOURCE
+	}
+	return eventlog.Remove(source)
+}
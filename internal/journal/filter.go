@@ -0,0 +1,38 @@
+package journal
+
+type Filter struct {
+	Types       []EventType `json:"types,omitempty"` // empty - all types
+	MinSeverity Severity    `json:"minSeverity"`
+	Sources     []string    `json:"sources,omitempty"` // empty - all sources, events without source always pass
+}
+
+func (v *Filter) Match(e *Event) bool {
+	if e.Severity < v.MinSeverity {
+		return false
+	}
+	if len(v.Types) > 0 && !containsType(v.Types, e.Type) {
+		return false
+	}
+	if len(v.Sources) > 0 && e.Source != "" && !containsString(v.Sources, e.Source) {
+		return false
+	}
+	return true
+}
+
+func containsType(list []EventType, value EventType) bool {
+	for _, t := range list {
+		if t == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, value string) bool {
+	for _, s := range list {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+)
+
+// TIME_FORMAT is the timestamp of appname.log text records
+const TIME_FORMAT = "2006-01-02T15:04:05.000"
+
+// Formatter returns one record without line separator
+type Formatter interface {
+	Format(e *Event) ([]byte, error)
+}
+
+type TextFormatter struct{}
+
+// Format keeps the original appname.log layout: "<time>        proxy on, <server>"
+func (TextFormatter) Format(e *Event) ([]byte, error) {
+	return []byte(e.Time.Format(TIME_FORMAT) + "        " + e.Text()), nil
+}
+
+type JSONFormatter struct{}
+
+func (JSONFormatter) Format(e *Event) ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func NewFormatter(name string) (Formatter, error) {
+	switch name {
+	case "", FORMAT_TEXT:
+		return TextFormatter{}, nil
+	case FORMAT_JSON:
+		return JSONFormatter{}, nil
+	case FORMAT_CEF:
+		return CEFFormatter{}, nil
+	case FORMAT_LEEF:
+		return LEEFFormatter{}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", name)
+}
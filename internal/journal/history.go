@@ -0,0 +1,331 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	HISTORY_DATA_EXT  = ".dat"
+	HISTORY_INDEX_EXT = ".idx"
+	HISTORY_STORE     = "history"
+
+	indexEntrySize = 24
+)
+
+// index record: time (unix nano), data offset, record size, fnv32a of source
+type indexEntry struct {
+	time   int64
+	offset int64
+	size   uint32
+	source uint32
+}
+
+func (v *indexEntry) marshal() []byte {
+	b := make([]byte, indexEntrySize)
+	binary.LittleEndian.PutUint64(b[0:], uint64(v.time))
+	binary.LittleEndian.PutUint64(b[8:], uint64(v.offset))
+	binary.LittleEndian.PutUint32(b[16:], v.size)
+	binary.LittleEndian.PutUint32(b[20:], v.source)
+	return b
+}
+
+func unmarshalIndexEntry(b []byte) indexEntry {
+	return indexEntry{
+		time:   int64(binary.LittleEndian.Uint64(b[0:])),
+		offset: int64(binary.LittleEndian.Uint64(b[8:])),
+		size:   binary.LittleEndian.Uint32(b[16:]),
+		source: binary.LittleEndian.Uint32(b[20:]),
+	}
+}
+
+func sourceHash(source string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(source))
+	return h.Sum32()
+}
+
+// History is an append-only store of events: JSON lines in <path>.dat and
+// a fixed size record index in <path>.idx, which is rebuilt from data if it
+// is missing or damaged. The index is kept in memory sorted by time. With sealer
+// records are encrypted, the index has only times, offsets and hashes of sources
+type History struct {
+	mutex    sync.RWMutex
+	path     string
+	readOnly bool
+	sealer   *Sealer
+	data     *os.File
+	index    *os.File
+	size     int64
+	entries  []indexEntry
+}
+
+func OpenHistory(path string, readOnly bool, sealer *Sealer) (*History, error) {
+	res := &History{path: path, readOnly: readOnly, sealer: sealer}
+	var err error
+	if readOnly {
+		res.data, err = os.Open(path + HISTORY_DATA_EXT)
+	} else {
+		res.data, err = os.OpenFile(path+HISTORY_DATA_EXT, os.O_RDWR|os.O_CREATE, 0600)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := res.load(); err != nil {
+		res.Close()
+		return nil, err
+	}
+	return res, nil
+}
+
+func (v *History) load() error {
+	info, err := v.data.Stat()
+	if err != nil {
+		return err
+	}
+	v.size = info.Size()
+	indexData, err := os.ReadFile(v.path + HISTORY_INDEX_EXT)
+	valid := err == nil && len(indexData)%indexEntrySize == 0
+	v.entries = make([]indexEntry, 0, len(indexData)/indexEntrySize)
+	var end int64
+	for i := 0; valid && i < len(indexData); i += indexEntrySize {
+		e := unmarshalIndexEntry(indexData[i:])
+		if e.offset != end {
+			valid = false
+			break
+		}
+		end = e.offset + int64(e.size)
+		v.entries = append(v.entries, e)
+	}
+	if !valid || end != v.size {
+		if err := v.rebuild(); err != nil {
+			return err
+		}
+	}
+	sort.SliceStable(v.entries, func(i, j int) bool {
+		return v.entries[i].time < v.entries[j].time
+	})
+	if v.readOnly {
+		return nil
+	}
+	v.index, err = os.OpenFile(v.path+HISTORY_INDEX_EXT, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	return err
+}
+
+// rebuild scans data file, a partial record at the end (interrupted write) is cut off
+func (v *History) rebuild() error {
+	v.entries = v.entries[:0]
+	if _, err := v.data.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(v.data)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var e Event
+		if record, err := v.sealer.Open(HISTORY_STORE, line); err == nil && json.Unmarshal(record, &e) == nil {
+			v.entries = append(v.entries, indexEntry{e.Time.UnixNano(), offset, uint32(len(line)), sourceHash(e.Source)})
+		}
+		offset += int64(len(line))
+	}
+	if v.readOnly {
+		return nil
+	}
+	if offset != v.size {
+		if err := v.data.Truncate(offset); err != nil {
+			return err
+		}
+		v.size = offset
+	}
+	var b bytes.Buffer
+	for i := range v.entries {
+		b.Write(v.entries[i].marshal())
+	}
+	return os.WriteFile(v.path+HISTORY_INDEX_EXT, b.Bytes(), 0600)
+}
+
+func (v *History) Append(e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if data, err = v.sealer.Seal(HISTORY_STORE, data); err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.readOnly {
+		return fmt.Errorf("history is opened read-only")
+	}
+	if _, err := v.data.WriteAt(data, v.size); err != nil {
+		return err
+	}
+	entry := indexEntry{e.Time.UnixNano(), v.size, uint32(len(data)), sourceHash(e.Source)}
+	v.size += int64(len(data))
+	if _, err := v.index.Write(entry.marshal()); err != nil {
+		return err
+	}
+	// clock could be changed, so keep entries sorted
+	i := sort.Search(len(v.entries), func(i int) bool { return v.entries[i].time > entry.time })
+	v.entries = append(v.entries, indexEntry{})
+	copy(v.entries[i+1:], v.entries[i:])
+	v.entries[i] = entry
+	return nil
+}
+
+// Write makes History a sink
+func (v *History) Write(e *Event) error {
+	return v.Append(e)
+}
+
+func (v *History) read(entry indexEntry) (*Event, error) {
+	buf := make([]byte, entry.size)
+	if _, err := v.data.ReadAt(buf, entry.offset); err != nil {
+		return nil, err
+	}
+	record, err := v.sealer.Open(HISTORY_STORE, buf)
+	if err != nil {
+		return nil, fmt.Errorf("history record at %d: %w", entry.offset, err)
+	}
+	e := new(Event)
+	if err := json.Unmarshal(record, e); err != nil {
+		return nil, fmt.Errorf("history record at %d: %w", entry.offset, err)
+	}
+	return e, nil
+}
+
+type HistoryQuery struct {
+	Since  time.Time // inclusive, zero - from the beginning
+	Until  time.Time // exclusive, zero - up to now
+	Source string    // empty - all sources
+	Types  []EventType
+	Limit  int // 0 - no limit, otherwise the latest Limit events
+}
+
+func (v *History) bounds(since, until time.Time) (int, int) {
+	lo, hi := 0, len(v.entries)
+	if !since.IsZero() {
+		t := since.UnixNano()
+		lo = sort.Search(len(v.entries), func(i int) bool { return v.entries[i].time >= t })
+	}
+	if !until.IsZero() {
+		t := until.UnixNano()
+		hi = sort.Search(len(v.entries), func(i int) bool { return v.entries[i].time >= t })
+	}
+	return lo, hi
+}
+
+func (v *History) match(entry indexEntry, q *HistoryQuery, hash uint32) (*Event, error) {
+	if q.Source != "" && entry.source != hash {
+		return nil, nil
+	}
+	e, err := v.read(entry)
+	if err != nil {
+		return nil, err
+	}
+	if q.Source != "" && e.Source != q.Source {
+		return nil, nil
+	}
+	if len(q.Types) > 0 && !containsType(q.Types, e.Type) {
+		return nil, nil
+	}
+	return e, nil
+}
+
+// Query returns events ordered by time
+func (v *History) Query(q HistoryQuery) ([]*Event, error) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	lo, hi := v.bounds(q.Since, q.Until)
+	hash := sourceHash(q.Source)
+	res := make([]*Event, 0)
+	// walk back from the newest event, so Limit keeps the latest ones
+	for i := hi - 1; i >= lo; i-- {
+		e, err := v.match(v.entries[i], &q, hash)
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			continue
+		}
+		res = append(res, e)
+		if q.Limit > 0 && len(res) >= q.Limit {
+			break
+		}
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res, nil
+}
+
+// At returns the last proxy change record of source at the moment t, nil if nothing is known
+func (v *History) At(t time.Time, source string) (*Event, error) {
+	res, err := v.Query(HistoryQuery{Until: t.Add(time.Nanosecond), Source: source, Types: []EventType{EVENT_PROXY_CHANGED, EVENT_OFFLINE_CHANGE}, Limit: 1})
+	if err != nil || len(res) == 0 {
+		return nil, err
+	}
+	return res[0], nil
+}
+
+// Contains checks if the store has an event of the same type and source within the
+// same millisecond (text logs keep milliseconds only), it is used by import
+func (v *History) Contains(e *Event) (bool, error) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	from := e.Time.Truncate(time.Millisecond).UnixNano()
+	to, hash := from+int64(time.Millisecond), sourceHash(e.Source)
+	i := sort.Search(len(v.entries), func(i int) bool { return v.entries[i].time >= from })
+	for ; i < len(v.entries) && v.entries[i].time < to; i++ {
+		if v.entries[i].source != hash {
+			continue
+		}
+		stored, err := v.read(v.entries[i])
+		if err != nil {
+			return false, err
+		}
+		if stored.Type == e.Type && stored.Source == e.Source {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (v *History) Len() int {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	return len(v.entries)
+}
+
+func (v *History) Close() error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	var err error
+	if v.index != nil {
+		err = v.index.Close()
+		v.index = nil
+	}
+	if v.data != nil {
+		if e := v.data.Close(); err == nil {
+			err = e
+		}
+		v.data = nil
+	}
+	return err
+}
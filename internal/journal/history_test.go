@@ -0,0 +1,265 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var historyStart = time.Date(2026, 10, 19, 9, 0, 0, 0, time.Local)
+
+func openTestHistory(t *testing.T, path string, readOnly bool) *History {
+	h, err := OpenHistory(path, readOnly, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// historyEvent makes a proxy change of source at minute of historyStart
+func historyEvent(minute int, source string, server string) *Event {
+	e := NewProxyEvent(source, Snapshot{Enabled: server != "", Server: server}, nil)
+	e.Time = historyStart.Add(time.Duration(minute) * time.Minute)
+	return e
+}
+
+// fillHistory appends events at minutes 0..9: proxy changes of "a" and "b" and a lifecycle event
+func fillHistory(t *testing.T, path string) {
+	h := openTestHistory(t, path, false)
+	defer h.Close()
+	for i := 0; i < 10; i++ {
+		var e *Event
+		switch i % 3 {
+		case 0:
+			e = historyEvent(i, "a", fmt.Sprintf("a%d:8080", i))
+		case 1:
+			e = historyEvent(i, "b", fmt.Sprintf("b%d:8080", i))
+		default:
+			e = NewEvent(EVENT_MONITOR_STARTED, SEVERITY_INFO, "")
+			e.Time = historyStart.Add(time.Duration(i) * time.Minute)
+		}
+		if err := h.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// minutes lists minutes of events from historyStart
+func minutes(events []*Event) string {
+	var res []string
+	for _, e := range events {
+		res = append(res, fmt.Sprint(int(e.Time.Sub(historyStart)/time.Minute)))
+	}
+	return strings.Join(res, ",")
+}
+
+func TestHistoryQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	fillHistory(t, path)
+	h := openTestHistory(t, path, true)
+	defer h.Close()
+	if h.Len() != 10 {
+		t.Fatalf("%d events", h.Len())
+	}
+	at := func(minute int) time.Time {
+		return historyStart.Add(time.Duration(minute) * time.Minute)
+	}
+	tests := []struct {
+		name  string
+		query HistoryQuery
+		want  string
+	}{
+		{"all", HistoryQuery{}, "0,1,2,3,4,5,6,7,8,9"},
+		{"since inclusive", HistoryQuery{Since: at(7)}, "7,8,9"},
+		{"until exclusive", HistoryQuery{Until: at(3)}, "0,1,2"},
+		{"range", HistoryQuery{Since: at(2), Until: at(5)}, "2,3,4"},
+		{"empty range", HistoryQuery{Since: at(5), Until: at(5)}, ""},
+		{"after the end", HistoryQuery{Since: at(10)}, ""},
+		{"before the start", HistoryQuery{Until: at(0)}, ""},
+		{"source", HistoryQuery{Source: "a"}, "0,3,6,9"},
+		{"unknown source", HistoryQuery{Source: "c"}, ""},
+		{"types", HistoryQuery{Types: []EventType{EVENT_MONITOR_STARTED}}, "2,5,8"},
+		{"limit keeps the latest", HistoryQuery{Source: "b", Limit: 2}, "4,7"},
+		{"all filters", HistoryQuery{Since: at(1), Until: at(9), Source: "a", Types: []EventType{EVENT_PROXY_CHANGED}, Limit: 1}, "6"},
+	}
+	for _, test := range tests {
+		events, err := h.Query(test.query)
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if got := minutes(events); got != test.want {
+			t.Errorf("%v: events at %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	atTests := []struct {
+		minute int
+		source string
+		want   string
+	}{
+		{0, "a", "a0:8080"},
+		{2, "a", "a0:8080"},
+		{3, "a", "a3:8080"}, // t is inclusive
+		{20, "a", "a9:8080"},
+		{-1, "a", ""},
+		{0, "b", ""},
+		{5, "b", "b4:8080"},
+		{5, "c", ""},
+	}
+	for _, test := range atTests {
+		e, err := h.At(at(test.minute), test.source)
+		if err != nil {
+			t.Errorf("at %v %v: %v", test.minute, test.source, err)
+			continue
+		}
+		got := ""
+		if e != nil {
+			got = e.Snapshot.Server
+		}
+		if got != test.want {
+			t.Errorf("at %v %v: %q, want %q", test.minute, test.source, got, test.want)
+		}
+	}
+
+	if ok, err := h.Contains(historyEvent(3, "a", "")); !ok || err != nil {
+		t.Errorf("contains: %v %v", ok, err)
+	}
+	if ok, err := h.Contains(historyEvent(3, "b", "")); ok || err != nil {
+		t.Errorf("contains other source: %v %v", ok, err)
+	}
+	if err := h.Append(historyEvent(10, "a", "")); err == nil {
+		t.Errorf("append to read-only history")
+	}
+}
+
+func TestHistoryOutOfOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h := openTestHistory(t, path, false)
+	// the clock is set back
+	for _, m := range []int{5, 6, 1, 7, 3} {
+		if err := h.Append(historyEvent(m, "a", fmt.Sprintf("a%d:8080", m))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := h.Query(HistoryQuery{})
+	if err != nil || minutes(events) != "1,3,5,6,7" {
+		t.Errorf("events at %v: %v", minutes(events), err)
+	}
+	h.Close()
+	h = openTestHistory(t, path, true)
+	defer h.Close()
+	events, err = h.Query(HistoryQuery{Until: historyStart.Add(6 * time.Minute)})
+	if err != nil || minutes(events) != "1,3,5" {
+		t.Errorf("reopened, events at %v: %v", minutes(events), err)
+	}
+}
+
+func TestHistoryIndexRebuild(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(path string) error
+	}{
+		{"missing index", func(path string) error {
+			return os.Remove(path + HISTORY_INDEX_EXT)
+		}},
+		{"empty index", func(path string) error {
+			return os.WriteFile(path+HISTORY_INDEX_EXT, nil, 0600)
+		}},
+		{"stale index", func(path string) error {
+			// the last entries were not written
+			return os.Truncate(path+HISTORY_INDEX_EXT, 7*indexEntrySize)
+		}},
+		{"partial entry", func(path string) error {
+			return os.Truncate(path+HISTORY_INDEX_EXT, 7*indexEntrySize+5)
+		}},
+		{"wrong offset", func(path string) error {
+			f, err := os.OpenFile(path+HISTORY_INDEX_EXT, os.O_WRONLY, 0)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.WriteAt([]byte{1}, 3*indexEntrySize+8)
+			return err
+		}},
+		{"index of other data", func(path string) error {
+			data, err := os.ReadFile(path + HISTORY_DATA_EXT)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(path+HISTORY_DATA_EXT, append([]byte("\n"), data...), 0600)
+		}},
+	}
+	for _, test := range tests {
+		for _, readOnly := range []bool{true, false} {
+			name := fmt.Sprintf("%v (read-only %v)", test.name, readOnly)
+			path := filepath.Join(t.TempDir(), "history")
+			fillHistory(t, path)
+			if err := test.damage(path); err != nil {
+				t.Fatal(err)
+			}
+			h := openTestHistory(t, path, readOnly)
+			events, err := h.Query(HistoryQuery{})
+			if err != nil || minutes(events) != "0,1,2,3,4,5,6,7,8,9" {
+				t.Errorf("%v: events at %v: %v", name, minutes(events), err)
+			}
+			h.Close()
+			index, _ := os.ReadFile(path + HISTORY_INDEX_EXT)
+			if !readOnly && len(index) != 10*indexEntrySize {
+				t.Errorf("%v: index is not rewritten, %d bytes", name, len(index))
+			}
+		}
+	}
+}
+
+func TestHistoryTruncatedRecord(t *testing.T) {
+	for _, readOnly := range []bool{true, false} {
+		path := filepath.Join(t.TempDir(), "history")
+		fillHistory(t, path)
+		// the write of the last record was interrupted
+		info, err := os.Stat(path + HISTORY_DATA_EXT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.OpenFile(path+HISTORY_DATA_EXT, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(`{"time":"2026-10-19T09:10:00+03:00","type":"proxy-ch`)
+		f.Close()
+
+		h := openTestHistory(t, path, readOnly)
+		events, err := h.Query(HistoryQuery{})
+		if err != nil || minutes(events) != "0,1,2,3,4,5,6,7,8,9" {
+			t.Errorf("read-only %v: events at %v: %v", readOnly, minutes(events), err)
+		}
+		if readOnly {
+			h.Close()
+			continue
+		}
+		// the partial record is cut off, so the next one is written in its place
+		if err := h.Append(historyEvent(10, "a", "a10:8080")); err != nil {
+			t.Fatal(err)
+		}
+		h.Close()
+		data, _ := os.ReadFile(path + HISTORY_DATA_EXT)
+		for _, line := range strings.SplitAfter(string(data), "\n") {
+			if line != "" && (!strings.HasSuffix(line, "\n") || !json.Valid([]byte(line))) {
+				t.Errorf("partial record is kept: %q", line)
+			}
+		}
+		if info.Size() >= int64(len(data)) {
+			t.Errorf("data size %d, was %d", len(data), info.Size())
+		}
+		h = openTestHistory(t, path, true)
+		events, err = h.Query(HistoryQuery{})
+		if err != nil || minutes(events) != "0,1,2,3,4,5,6,7,8,9,10" {
+			t.Errorf("events after append at %v: %v", minutes(events), err)
+		}
+		h.Close()
+	}
+}
@@ -0,0 +1,78 @@
+package journal
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Hub is a sink which fans events out to subscribers (e.g. -follow clients),
+// a slow subscriber loses events instead of blocking the others
+type Hub struct {
+	mutex sync.Mutex
+	subs  map[*Subscription]struct{}
+}
+
+type Subscription struct {
+	C       <-chan *Event // closed by Close of the subscription or the hub
+	ch      chan *Event
+	filter  Filter
+	hub     *Hub
+	dropped atomic.Uint64
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+func (v *Hub) Subscribe(filter Filter, buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = DEFAULT_SINK_BUFFER
+	}
+	ch := make(chan *Event, buffer)
+	s := &Subscription{C: ch, ch: ch, filter: filter, hub: v}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.subs[s] = struct{}{}
+	return s
+}
+
+// Dropped returns the number of events lost because the subscriber was slow
+func (v *Subscription) Dropped() uint64 {
+	return v.dropped.Load()
+}
+
+func (v *Subscription) Close() {
+	v.hub.mutex.Lock()
+	defer v.hub.mutex.Unlock()
+	if _, ok := v.hub.subs[v]; ok {
+		delete(v.hub.subs, v)
+		close(v.ch)
+	}
+}
+
+func (v *Hub) Write(e *Event) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	for s := range v.subs {
+		if !s.filter.Match(e) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+	return nil
+}
+
+// Close ends the current subscriptions, the hub can be added to a new dispatcher
+func (v *Hub) Close() error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	for s := range v.subs {
+		delete(v.subs, s)
+		close(s.ch)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package journal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// drain reads buffered events of the subscription, up to the end if it is closed
+func drain(s *Subscription) (messages string, closed bool) {
+	var res []string
+	for {
+		select {
+		case e, ok := <-s.C:
+			if !ok {
+				return strings.Join(res, ","), true
+			}
+			res = append(res, e.Message)
+		default:
+			return strings.Join(res, ","), false
+		}
+	}
+}
+
+func TestHub(t *testing.T) {
+	h := NewHub()
+	all := h.Subscribe(Filter{}, 0)
+	slow := h.Subscribe(Filter{}, 2)
+	errors := h.Subscribe(Filter{MinSeverity: SEVERITY_ERROR}, 0)
+	for i := 1; i <= 5; i++ {
+		severity := SEVERITY_INFO
+		if i%2 == 0 {
+			severity = SEVERITY_ERROR
+		}
+		if err := h.Write(NewEvent(EVENT_INTERNAL_ERROR, severity, fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := drain(all); got != "1,2,3,4,5" || all.Dropped() != 0 {
+		t.Errorf("all: %v, dropped %v", got, all.Dropped())
+	}
+	// the slow subscriber loses events without blocking the others
+	if got, _ := drain(slow); got != "1,2" || slow.Dropped() != 3 {
+		t.Errorf("slow: %v, dropped %v", got, slow.Dropped())
+	}
+	if got, _ := drain(errors); got != "2,4" || errors.Dropped() != 0 {
+		t.Errorf("errors: %v, dropped %v", got, errors.Dropped())
+	}
+
+	errors.Close()
+	errors.Close()
+	if _, closed := drain(errors); !closed {
+		t.Errorf("subscription is not closed")
+	}
+	h.Write(NewEvent(EVENT_INTERNAL_ERROR, SEVERITY_ERROR, "6"))
+	if got, _ := drain(slow); got != "6" {
+		t.Errorf("slow after drain: %v", got)
+	}
+	if got, _ := drain(all); got != "6" {
+		t.Errorf("all: %v", got)
+	}
+
+	// Close ends subscriptions, but the hub keeps working for new ones
+	h.Close()
+	for _, s := range []*Subscription{all, slow} {
+		if got, closed := drain(s); !closed || got != "" {
+			t.Errorf("subscription after hub Close: %v, closed %v", got, closed)
+		}
+		s.Close()
+	}
+	next := h.Subscribe(Filter{}, 0)
+	h.Write(NewEvent(EVENT_MONITOR_STARTED, SEVERITY_INFO, "7"))
+	if got, _ := drain(next); got != "7" {
+		t.Errorf("new subscription: %v", got)
+	}
+	next.Close()
+}
@@ -0,0 +1,270 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ParseTextRecord parses one line of the text format (appname.log), it is the
+// reverse of TextFormatter. Times are local, as they were written
+func ParseTextRecord(line string) (*Event, error) {
+	line = strings.TrimRight(line, "\r\n")
+	line = strings.TrimLeft(line, "\uFEFF\x00")
+	if record, _, _, ok := splitRecord([]byte(line)); ok {
+		line = string(record)
+	}
+	if len(line) < len(TIME_FORMAT) {
+		return nil, fmt.Errorf("record is too short")
+	}
+	t, err := time.ParseInLocation(TIME_FORMAT, line[:len(TIME_FORMAT)], time.Local)
+	if err != nil {
+		return nil, err
+	}
+	text := line[len(TIME_FORMAT):]
+	if text == "" || (text[0] != ' ' && text[0] != '\t') {
+		return nil, fmt.Errorf("no separator after time")
+	}
+	text = strings.TrimSpace(text)
+	e := &Event{Time: t}
+	if s, ok := parseSnapshotText(text); ok {
+		e.Type, e.Source, e.Snapshot = EVENT_PROXY_CHANGED, SOURCE_USER, s
+		return e, nil
+	}
+	switch {
+	case strings.HasPrefix(text, offlineChangeText+": "):
+		if !parseOfflineChange(e, strings.TrimPrefix(text, offlineChangeText+": ")) {
+			return nil, fmt.Errorf("invalid record %q", text)
+		}
+	case strings.HasPrefix(text, unchangedText+" "):
+		if !parseUnchanged(e, strings.TrimPrefix(text, unchangedText+" ")) {
+			return nil, fmt.Errorf("invalid record %q", text)
+		}
+	case strings.HasPrefix(text, snapshotText+" ["), strings.HasPrefix(text, snapshotText+": "):
+		if !parseSnapshotRecord(e, strings.TrimPrefix(text, snapshotText)) {
+			return nil, fmt.Errorf("invalid record %q", text)
+		}
+	default:
+		e.Type, e.Origin, e.Message = parseLifecycleText(text)
+		if e.Type < 0 {
+			return nil, fmt.Errorf("unknown record %q", text)
+		}
+		if e.Type == EVENT_INTERNAL_ERROR {
+			e.Severity = SEVERITY_ERROR
+		}
+	}
+	return e, nil
+}
+
+func parseSnapshotText(text string) (*Snapshot, bool) {
+	if text == "proxy off" {
+		return &Snapshot{}, true
+	}
+	if strings.HasPrefix(text, "proxy on,") {
+		return &Snapshot{Enabled: true, Server: strings.TrimSpace(strings.TrimPrefix(text, "proxy on,"))}, true
+	}
+	return nil, false
+}
+
+// cutMessage splits "<text> (<message>)"
+func cutMessage(text string) (string, string, bool) {
+	i := strings.LastIndex(text, " (")
+	if i < 0 || !strings.HasSuffix(text, ")") {
+		return text, "", false
+	}
+	return text[:i], text[i+2 : len(text)-1], true
+}
+
+// parseOfflineChange parses "<previous> -> <current> (<message>)"
+func parseOfflineChange(e *Event, text string) bool {
+	text, message, ok := cutMessage(text)
+	if !ok {
+		return false
+	}
+	before, after, ok := strings.Cut(text, " -> ")
+	if !ok {
+		return false
+	}
+	previous, ok1 := parseSnapshotText(before)
+	current, ok2 := parseSnapshotText(after)
+	if !ok1 || !ok2 {
+		return false
+	}
+	e.Type, e.Severity, e.Source, e.Snapshot, e.Previous, e.Message = EVENT_OFFLINE_CHANGE, SEVERITY_WARNING, SOURCE_USER, current, previous, message
+	return true
+}
+
+// parseUnchanged parses "<time>: <current> (<message>)"
+func parseUnchanged(e *Event, text string) bool {
+	if len(text) < len(TIME_FORMAT)+2 || text[len(TIME_FORMAT):len(TIME_FORMAT)+2] != ": " {
+		return false
+	}
+	since, err := time.ParseInLocation(TIME_FORMAT, text[:len(TIME_FORMAT)], time.Local)
+	if err != nil {
+		return false
+	}
+	text, message, ok := cutMessage(text[len(TIME_FORMAT)+2:])
+	if !ok {
+		return false
+	}
+	current, ok := parseSnapshotText(text)
+	if !ok {
+		return false
+	}
+	e.Type, e.Source, e.Snapshot, e.Since, e.Message = EVENT_PROXY_UNCHANGED, SOURCE_USER, current, &since, message
+	return true
+}
+
+// parseSnapshotRecord parses "[ [<origin>]]: <current>"
+func parseSnapshotRecord(e *Event, text string) bool {
+	if strings.HasPrefix(text, " [") {
+		end := strings.Index(text, "]")
+		if end < 0 {
+			return false
+		}
+		e.Origin, text = text[2:end], text[end+1:]
+	}
+	current, ok := parseSnapshotText(strings.TrimPrefix(text, ": "))
+	if !ok || !strings.HasPrefix(text, ": ") {
+		return false
+	}
+	e.Type, e.Source, e.Snapshot = EVENT_PROXY_SNAPSHOT, SOURCE_USER, current
+	return true
+}
+
+// parseLifecycleText parses "<text>[ [<origin>]][: <message>]"
+func parseLifecycleText(text string) (eventType EventType, origin, message string) {
+	for t, prefix := range lifecycleTexts {
+		if !strings.HasPrefix(text, prefix) {
+			continue
+		}
+		rest := text[len(prefix):]
+		if strings.HasPrefix(rest, " [") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				continue
+			}
+			origin, rest = rest[2:end], rest[end+1:]
+		}
+		if rest == "" {
+			return t, origin, ""
+		}
+		if strings.HasPrefix(rest, ": ") {
+			return t, origin, rest[2:]
+		}
+		origin = ""
+	}
+	return -1, "", ""
+}
+
+type LegacyParseError struct {
+	Line int
+	Text string
+	Err  error
+}
+
+func (v *LegacyParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", v.Line, v.Err)
+}
+
+// LegacyReader reads events from appname.log written in the text format.
+// Broken lines (partial writes, zero filled tails after crash, foreign text)
+// are skipped and collected in Skipped
+type LegacyReader struct {
+	reader   *bufio.Reader
+	line     int
+	previous map[string]Snapshot
+	Skipped  []*LegacyParseError
+	Decode   LineDecoder // optional, e.g. decryption of records
+}
+
+func NewLegacyReader(r io.Reader) *LegacyReader {
+	return &LegacyReader{reader: bufio.NewReader(r), previous: make(map[string]Snapshot)}
+}
+
+// Next returns io.EOF after the last event
+func (v *LegacyReader) Next() (*Event, error) {
+	for {
+		line, err := v.reader.ReadString('\n')
+		if line == "" && err != nil {
+			return nil, err
+		}
+		v.line++
+		if strings.Trim(line, " \t\r\n\x00") == "" {
+			continue
+		}
+		if v.Decode != nil {
+			record, err := v.Decode([]byte(line))
+			if err != nil {
+				v.Skipped = append(v.Skipped, &LegacyParseError{v.line, line, err})
+				continue
+			}
+			line = string(record)
+		}
+		e, perr := ParseTextRecord(line)
+		if perr != nil {
+			v.Skipped = append(v.Skipped, &LegacyParseError{v.line, line, perr})
+			continue
+		}
+		if e.Snapshot != nil {
+			if p, ok := v.previous[e.Source]; ok && e.Type == EVENT_PROXY_CHANGED {
+				e.Previous = &p
+			}
+			v.previous[e.Source] = *e.Snapshot
+		}
+		return e, nil
+	}
+}
+
+func ReadLegacyLog(r io.Reader) ([]*Event, []*LegacyParseError, error) {
+	reader := NewLegacyReader(r)
+	res := make([]*Event, 0)
+	for {
+		e, err := reader.Next()
+		if err == io.EOF {
+			return res, reader.Skipped, nil
+		}
+		if err != nil {
+			return res, reader.Skipped, err
+		}
+		res = append(res, e)
+	}
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (v *gzipFile) Close() error {
+	v.Reader.Close()
+	return v.file.Close()
+}
+
+// OpenRecordFile opens a log file, rotated files compressed by gzip are detected by signature
+func OpenRecordFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, 2)
+	n, _ := io.ReadFull(f, magic)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if n == 2 && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &gzipFile{zr, f}, nil
+	}
+	return f, nil
+}
@@ -0,0 +1,160 @@
+package journal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// legacyEvent is a short form of an event for comparison
+func legacyEvent(e *Event) string {
+	res := e.Time.Format(TIME_FORMAT) + " " + e.Type.String()
+	if e.Snapshot != nil {
+		res += " " + e.Snapshot.String()
+	}
+	if e.Previous != nil {
+		res += " after " + e.Previous.String()
+	}
+	if e.Message != "" {
+		res += " (" + e.Message + ")"
+	}
+	if e.Severity != SEVERITY_INFO {
+		res += " " + e.Severity.String()
+	}
+	return res
+}
+
+func TestReadLegacyLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		events  []string
+		skipped []int // lines
+	}{
+		{"empty", "", nil, nil},
+		{"blank lines", "\r\n\n   \n", nil, nil},
+		{
+			"original format",
+			"\uFEFF2024-03-01T08:15:02.117        proxy on, 10.0.0.1:3128\r\n" +
+				"2024-03-01T12:40:55.003        proxy off\r\n" +
+				"2024-03-02T09:01:13.450        proxy on, proxy.corp.local:8080\r\n",
+			[]string{
+				"2024-03-01T08:15:02.117 proxy-changed proxy on, 10.0.0.1:3128",
+				"2024-03-01T12:40:55.003 proxy-changed proxy off after proxy on, 10.0.0.1:3128",
+				"2024-03-02T09:01:13.450 proxy-changed proxy on, proxy.corp.local:8080 after proxy off",
+			},
+			nil,
+		},
+		{
+			"lifecycle records",
+			"2026-10-19T09:30:00.000\tmonitor started\n" +
+				"2026-10-19T09:30:01.500        internal error: access denied\n" +
+				"2026-10-19T18:00:00.000        monitor stopped\n",
+			[]string{
+				"2026-10-19T09:30:00.000 monitor-started",
+				"2026-10-19T09:30:01.500 internal-error (access denied) error",
+				"2026-10-19T18:00:00.000 monitor-stopped",
+			},
+			nil,
+		},
+		{
+			"garbage",
+			"proxyMon log\n" +
+				"2024-03-01T08:15:02.117        proxy on, 10.0.0.1:3128\n" +
+				"2024-13-45T08:15:02.117        proxy off\n" +
+				"2024-03-01T08:15:02.117proxy off\n" +
+				"2024-03-01T08:15:03.000        something else\n" +
+				"2024-03-01T08:15:04.000        proxy off\n",
+			[]string{
+				"2024-03-01T08:15:02.117 proxy-changed proxy on, 10.0.0.1:3128",
+				"2024-03-01T08:15:04.000 proxy-changed proxy off after proxy on, 10.0.0.1:3128",
+			},
+			[]int{1, 3, 4, 5},
+		},
+		{
+			"truncated last line",
+			"2024-03-01T08:15:02.117        proxy off\n" +
+				"2024-03-01T08:1",
+			[]string{"2024-03-01T08:15:02.117 proxy-changed proxy off"},
+			[]int{2},
+		},
+		{
+			"last line without new line",
+			"2024-03-01T08:15:02.117        proxy on, 10.0.0.1:3128",
+			[]string{"2024-03-01T08:15:02.117 proxy-changed proxy on, 10.0.0.1:3128"},
+			nil,
+		},
+		{
+			"zero filled tail after crash",
+			"2024-03-01T08:15:02.117        proxy off\n\x00\x00\x00\x00\x00\x00\x00\x00\n\x00\x00\x00",
+			[]string{"2024-03-01T08:15:02.117 proxy-changed proxy off"},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		events, skipped, err := ReadLegacyLog(strings.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		var got []string
+		for _, e := range events {
+			if e.Time.Location() != time.Local {
+				t.Errorf("%v: time %v is not local", test.name, e.Time)
+			}
+			got = append(got, legacyEvent(e))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.events) {
+			t.Errorf("%v: events\n%q\nwant\n%q", test.name, got, test.events)
+		}
+		var lines []int
+		for _, s := range skipped {
+			lines = append(lines, s.Line)
+		}
+		if fmt.Sprint(lines) != fmt.Sprint(test.skipped) {
+			t.Errorf("%v: skipped lines %v, want %v", test.name, lines, test.skipped)
+		}
+	}
+}
+
+func TestParseTextRecordRoundTrip(t *testing.T) {
+	at := time.Date(2026, 10, 19, 9, 30, 0, 123000000, time.Local)
+	events := []*Event{
+		NewProxyEvent(SOURCE_USER, Snapshot{Enabled: true, Server: "http://10.0.0.1:3128"}, nil),
+		NewProxyEvent(SOURCE_USER, Snapshot{}, nil),
+		NewEvent(EVENT_INTERNAL_ERROR, SEVERITY_ERROR, "access denied: key"),
+	}
+	for _, e := range events {
+		e.Time = at
+		line, err := TextFormatter{}.Format(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseTextRecord(string(line))
+		if err != nil {
+			t.Errorf("%q: %v", line, err)
+			continue
+		}
+		if legacyEvent(parsed) != legacyEvent(e) || !parsed.Time.Equal(at) {
+			t.Errorf("%q: parsed %v, want %v", line, legacyEvent(parsed), legacyEvent(e))
+		}
+	}
+}
+
+func TestParseSnapshotRecord(t *testing.T) {
+	e := NewSnapshotEvent(SOURCE_USER, Snapshot{Enabled: true, Server: "p:3128"}, "remote")
+	line, _ := TextFormatter{}.Format(e)
+	parsed, err := ParseTextRecord(string(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Type != EVENT_PROXY_SNAPSHOT || parsed.Origin != "remote" || parsed.Snapshot == nil || *parsed.Snapshot != *e.Snapshot {
+		t.Errorf("%q: parsed %+v", line, parsed)
+	}
+	// a snapshot is not a change, but it tells the settings before the next one
+	events, _, err := ReadLegacyLog(strings.NewReader(string(line) + "\n" + e.Time.Format(TIME_FORMAT) + "        proxy off\n"))
+	if err != nil || len(events) != 2 || events[1].Previous == nil || *events[1].Previous != *e.Snapshot {
+		t.Errorf("events %v: %v", events, err)
+	}
+}
@@ -0,0 +1,230 @@
+package journal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const METRICS_PREFIX = "proxymon_"
+
+type MetricKind int
+
+const (
+	METRIC_GAUGE MetricKind = iota
+	METRIC_COUNTER
+)
+
+func (v MetricKind) String() string {
+	if v == METRIC_COUNTER {
+		return "counter"
+	}
+	return "gauge"
+}
+
+type Label struct {
+	Name, Value string
+}
+
+type MetricPoint struct {
+	Labels []Label
+	Value  float64
+}
+
+type Metric struct {
+	Name   string
+	Help   string
+	Kind   MetricKind
+	Points []MetricPoint
+}
+
+type changeKey struct {
+	source, field string
+}
+
+// Metrics counts monitor events; it is added to the dispatcher as a sink and
+// the monitoring goroutine reports its checks directly
+type Metrics struct {
+	mutex        sync.Mutex
+	started      time.Time
+	enabled      map[string]bool
+	changes      map[changeKey]uint64
+	checks       uint64
+	checkSeconds float64
+	lastCheck    float64
+	running      bool
+	errors       uint64
+	monitoring   time.Time // start of the monitoring goroutine, zero if it is not running
+
+	// SinkStats is optional, it adds delivery counters of sinks
+	SinkStats func() []SinkStats
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{started: time.Now(), enabled: make(map[string]bool), changes: make(map[changeKey]uint64)}
+}
+
+// Started returns the start time of counters
+func (v *Metrics) Started() time.Time {
+	return v.started
+}
+
+func (v *Metrics) Write(e *Event) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	switch e.Type {
+	case EVENT_PROXY_CHANGED, EVENT_OFFLINE_CHANGE:
+		if e.Snapshot == nil {
+			break
+		}
+		v.enabled[e.Source] = e.Snapshot.Enabled
+		if e.Previous == nil {
+			break
+		}
+		if e.Previous.Enabled != e.Snapshot.Enabled {
+			v.changes[changeKey{e.Source, "enabled"}]++
+		}
+		if e.Previous.Server != e.Snapshot.Server {
+			v.changes[changeKey{e.Source, "server"}]++
+		}
+	case EVENT_PROXY_UNCHANGED, EVENT_PROXY_SNAPSHOT:
+		if e.Snapshot != nil {
+			v.enabled[e.Source] = e.Snapshot.Enabled
+		}
+	case EVENT_MONITOR_STARTED:
+		v.running = true
+	case EVENT_MONITOR_STOPPED, EVENT_MONITOR_PAUSED:
+		v.running = false
+	case EVENT_INTERNAL_ERROR:
+		v.errors++
+	}
+	return nil
+}
+
+func (v *Metrics) Close() error {
+	return nil
+}
+
+// ObserveCheck records the duration of one read of the proxy settings
+func (v *Metrics) ObserveCheck(d time.Duration) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.checks++
+	v.lastCheck = d.Seconds()
+	v.checkSeconds += v.lastCheck
+}
+
+// SetMonitoring is called by the monitoring goroutine when it starts and exits
+func (v *Metrics) SetMonitoring(running bool) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if running {
+		v.monitoring = time.Now()
+	} else {
+		v.monitoring = time.Time{}
+	}
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// Collect returns the current values, metric names are without METRICS_PREFIX
+func (v *Metrics) Collect() []Metric {
+	v.mutex.Lock()
+	enabled := Metric{Name: "proxy_enabled", Help: "Proxy is enabled (1) or disabled (0).", Kind: METRIC_GAUGE}
+	for source, value := range v.enabled {
+		enabled.Points = append(enabled.Points, MetricPoint{[]Label{{"source", source}}, boolValue(value)})
+	}
+	changes := Metric{Name: "proxy_changes_total", Help: "Changes of proxy settings by field.", Kind: METRIC_COUNTER}
+	for k, value := range v.changes {
+		changes.Points = append(changes.Points, MetricPoint{[]Label{{"source", k.source}, {"field", k.field}}, float64(value)})
+	}
+	uptime := 0.0
+	if !v.monitoring.IsZero() {
+		uptime = time.Since(v.monitoring).Seconds()
+	}
+	res := []Metric{
+		enabled,
+		changes,
+		{"registry_checks_total", "Reads of proxy settings.", METRIC_COUNTER, []MetricPoint{{nil, float64(v.checks)}}},
+		{"registry_check_seconds_total", "Total duration of reads of proxy settings.", METRIC_COUNTER, []MetricPoint{{nil, v.checkSeconds}}},
+		{"registry_check_last_seconds", "Duration of the last read of proxy settings.", METRIC_GAUGE, []MetricPoint{{nil, v.lastCheck}}},
+		{"monitor_running", "Monitor is started (1) or stopped (0).", METRIC_GAUGE, []MetricPoint{{nil, boolValue(v.running)}}},
+		{"internal_errors_total", "Internal errors.", METRIC_COUNTER, []MetricPoint{{nil, float64(v.errors)}}},
+		{"monitoring_uptime_seconds", "Time since the monitoring goroutine has started, 0 if it is not running.", METRIC_GAUGE, []MetricPoint{{nil, uptime}}},
+		{"process_uptime_seconds", "Time since the program has started.", METRIC_GAUGE, []MetricPoint{{nil, time.Since(v.started).Seconds()}}},
+	}
+	v.mutex.Unlock()
+	if v.SinkStats != nil {
+		dropped := Metric{Name: "sink_dropped_total", Help: "Events dropped because the sink queue was full.", Kind: METRIC_COUNTER}
+		failed := Metric{Name: "sink_failed_total", Help: "Events the sink has failed to write.", Kind: METRIC_COUNTER}
+		for _, s := range v.SinkStats() {
+			labels := []Label{{"sink", s.Name}}
+			dropped.Points = append(dropped.Points, MetricPoint{labels, float64(s.Dropped)})
+			failed.Points = append(failed.Points, MetricPoint{labels, float64(s.Failed)})
+		}
+		res = append(res, dropped, failed)
+	}
+	for _, m := range res {
+		sort.Slice(m.Points, func(i, j int) bool { return labelsKey(m.Points[i].Labels) < labelsKey(m.Points[j].Labels) })
+	}
+	return res
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelsKey(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = l.Name + `="` + labelEscaper.Replace(l.Value) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatMetricValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// WritePrometheus writes metrics in the Prometheus text exposition format 0.0.4
+func WritePrometheus(w io.Writer, metrics []Metric) error {
+	b := bufio.NewWriter(w)
+	for _, m := range metrics {
+		name := METRICS_PREFIX + m.Name
+		fmt.Fprintf(b, "# HELP %v %v\n# TYPE %v %v\n", name, m.Help, name, m.Kind)
+		for _, p := range m.Points {
+			fmt.Fprintf(b, "%v%v %v\n", name, labelsKey(p.Labels), formatMetricValue(p.Value))
+		}
+	}
+	return b.Flush()
+}
+
+func (v *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	WritePrometheus(w, v.Collect())
+}
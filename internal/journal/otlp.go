@@ -0,0 +1,393 @@
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OTLP_ENCODING_PROTOBUF = "protobuf"
+	OTLP_ENCODING_JSON     = "json"
+
+	OTLP_DEFAULT_ENDPOINT = "http://127.0.0.1:4318"
+	OTLP_LOGS_PATH        = "/v1/logs"
+	OTLP_METRICS_PATH     = "/v1/metrics"
+
+	otlpScopeName       = "proxyMon"
+	otlpMetricsInterval = time.Minute
+	otlpTimeout         = 10 * time.Second
+)
+
+type OTLPOptions struct {
+	Endpoint        string            `json:"endpoint,omitempty"` // collector base URL, default http://127.0.0.1:4318
+	Encoding        string            `json:"encoding,omitempty"` // protobuf (default) or json
+	Headers         map[string]string `json:"headers,omitempty"`  // e.g. authorization of the collector
+	ServiceName     string            `json:"serviceName,omitempty"`
+	Resource        map[string]string `json:"resource,omitempty"`        // additional resource attributes
+	MetricsInterval Duration          `json:"metricsInterval,omitempty"` // default 1m, negative - metrics are not exported
+}
+
+// OpenTelemetry severity numbers
+var otlpSeverities = map[Severity]int{
+	SEVERITY_INFO:    9,
+	SEVERITY_WARNING: 13,
+	SEVERITY_ERROR:   17,
+}
+
+// AggregationTemporality CUMULATIVE
+const otlpCumulative = 2
+
+type otlpAttr struct {
+	key   string
+	value any // string, bool, int64 or float64
+}
+
+func otlpResource(opts OTLPOptions) []otlpAttr {
+	service := opts.ServiceName
+	if service == "" {
+		service = EVENTLOG_SOURCE
+	}
+	res := []otlpAttr{{"service.name", service}, {"component", EVENTLOG_SOURCE}}
+	host, user := localIdentity()
+	if host != "" {
+		res = append(res, otlpAttr{"host.name", host})
+	}
+	if user != "" {
+		res = append(res, otlpAttr{"user.name", user})
+	}
+	for k, v := range opts.Resource {
+		res = append(res, otlpAttr{k, v})
+	}
+	return res
+}
+
+func eventAttrs(e *Event) []otlpAttr {
+	res := []otlpAttr{{"event.type", e.Type.String()}}
+	if e.Source != "" {
+		res = append(res, otlpAttr{"proxy.source", e.Source})
+	}
+	if e.Snapshot != nil {
+		res = append(res, otlpAttr{"proxy.enabled", e.Snapshot.Enabled}, otlpAttr{"proxy.server", e.Snapshot.Server})
+	}
+	if e.Previous != nil {
+		res = append(res, otlpAttr{"proxy.previous.enabled", e.Previous.Enabled}, otlpAttr{"proxy.previous.server", e.Previous.Server})
+	}
+	if e.Since != nil {
+		res = append(res, otlpAttr{"proxy.since", e.Since.Format(time.RFC3339Nano)})
+	}
+	if e.Origin != "" {
+		res = append(res, otlpAttr{"proxymon.origin", e.Origin})
+	}
+	if e.Message != "" {
+		res = append(res, otlpAttr{"proxymon.message", e.Message})
+	}
+	return res
+}
+
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+// JSON encoding (OTLP/HTTP JSON: lowerCamelCase names, 64-bit integers as strings)
+
+type jsonObject = map[string]any
+
+func jsonAttrs(attrs []otlpAttr) []jsonObject {
+	res := make([]jsonObject, 0, len(attrs))
+	for _, a := range attrs {
+		var value jsonObject
+		switch x := a.value.(type) {
+		case bool:
+			value = jsonObject{"boolValue": x}
+		case int64:
+			value = jsonObject{"intValue": strconv.FormatInt(x, 10)}
+		case float64:
+			value = jsonObject{"doubleValue": x}
+		default:
+			value = jsonObject{"stringValue": fmt.Sprint(x)}
+		}
+		res = append(res, jsonObject{"key": a.key, "value": value})
+	}
+	return res
+}
+
+func jsonLogs(resource []otlpAttr, events []*Event) ([]byte, error) {
+	records := make([]jsonObject, 0, len(events))
+	for _, e := range events {
+		records = append(records, jsonObject{
+			"timeUnixNano":         strconv.FormatUint(unixNano(e.Time), 10),
+			"observedTimeUnixNano": strconv.FormatUint(unixNano(e.Time), 10),
+			"severityNumber":       otlpSeverities[e.Severity],
+			"severityText":         e.Severity.String(),
+			"body":                 jsonObject{"stringValue": e.Text()},
+			"attributes":           jsonAttrs(eventAttrs(e)),
+			"eventName":            e.Type.String(),
+		})
+	}
+	return json.Marshal(jsonObject{"resourceLogs": []jsonObject{{
+		"resource":  jsonObject{"attributes": jsonAttrs(resource)},
+		"scopeLogs": []jsonObject{{"scope": jsonObject{"name": otlpScopeName}, "logRecords": records}},
+	}}})
+}
+
+func otlpMetricName(m Metric) string {
+	return strings.TrimSuffix(METRICS_PREFIX, "_") + "." + m.Name
+}
+
+func jsonMetrics(resource []otlpAttr, metrics []Metric, start, now time.Time) ([]byte, error) {
+	res := make([]jsonObject, 0, len(metrics))
+	for _, m := range metrics {
+		points := make([]jsonObject, 0, len(m.Points))
+		for _, p := range m.Points {
+			point := jsonObject{"timeUnixNano": strconv.FormatUint(unixNano(now), 10), "asDouble": p.Value}
+			if len(p.Labels) > 0 {
+				point["attributes"] = jsonAttrs(labelAttrs(p.Labels))
+			}
+			if m.Kind == METRIC_COUNTER {
+				point["startTimeUnixNano"] = strconv.FormatUint(unixNano(start), 10)
+			}
+			points = append(points, point)
+		}
+		metric := jsonObject{"name": otlpMetricName(m), "description": m.Help}
+		if m.Kind == METRIC_COUNTER {
+			metric["sum"] = jsonObject{"dataPoints": points, "aggregationTemporality": otlpCumulative, "isMonotonic": true}
+		} else {
+			metric["gauge"] = jsonObject{"dataPoints": points}
+		}
+		res = append(res, metric)
+	}
+	return json.Marshal(jsonObject{"resourceMetrics": []jsonObject{{
+		"resource":     jsonObject{"attributes": jsonAttrs(resource)},
+		"scopeMetrics": []jsonObject{{"scope": jsonObject{"name": otlpScopeName}, "metrics": res}},
+	}}})
+}
+
+func labelAttrs(labels []Label) []otlpAttr {
+	res := make([]otlpAttr, len(labels))
+	for i, l := range labels {
+		res[i] = otlpAttr{l.Name, l.Value}
+	}
+	return res
+}
+
+// protobuf encoding, field numbers are from opentelemetry-proto v1
+
+func pbAttrs(w *pbWriter, field int, attrs []otlpAttr) {
+	for _, a := range attrs {
+		w.message(field, func(kv *pbWriter) {
+			kv.str(1, a.key)
+			kv.message(2, func(value *pbWriter) {
+				switch x := a.value.(type) {
+				case bool:
+					value.boolean(2, x)
+				case int64:
+					value.tag(3, pbVarint)
+					value.buf = binary.AppendUvarint(value.buf, uint64(x))
+				case float64:
+					value.double(4, x)
+				default:
+					value.bytes(1, []byte(fmt.Sprint(x)))
+				}
+			})
+		})
+	}
+}
+
+func pbScope(w *pbWriter) {
+	w.str(1, otlpScopeName)
+}
+
+func pbLogs(resource []otlpAttr, events []*Event) []byte {
+	var w pbWriter
+	// ExportLogsServiceRequest.resource_logs
+	w.message(1, func(rl *pbWriter) {
+		rl.message(1, func(r *pbWriter) { pbAttrs(r, 1, resource) })
+		// ResourceLogs.scope_logs
+		rl.message(2, func(sl *pbWriter) {
+			sl.message(1, pbScope)
+			for _, e := range events {
+				// ScopeLogs.log_records
+				sl.message(2, func(lr *pbWriter) {
+					lr.fixed64(1, unixNano(e.Time))
+					lr.varint(2, uint64(otlpSeverities[e.Severity]))
+					lr.str(3, e.Severity.String())
+					lr.message(5, func(body *pbWriter) { body.bytes(1, []byte(e.Text())) })
+					pbAttrs(lr, 6, eventAttrs(e))
+					lr.fixed64(11, unixNano(e.Time))
+					lr.str(12, e.Type.String())
+				})
+			}
+		})
+	})
+	return w.buf
+}
+
+func pbMetrics(resource []otlpAttr, metrics []Metric, start, now time.Time) []byte {
+	var w pbWriter
+	// ExportMetricsServiceRequest.resource_metrics
+	w.message(1, func(rm *pbWriter) {
+		rm.message(1, func(r *pbWriter) { pbAttrs(r, 1, resource) })
+		// ResourceMetrics.scope_metrics
+		rm.message(2, func(sm *pbWriter) {
+			sm.message(1, pbScope)
+			for _, m := range metrics {
+				sm.message(2, func(mw *pbWriter) {
+					mw.str(1, otlpMetricName(m))
+					mw.str(2, m.Help)
+					points := func(data *pbWriter) {
+						for _, p := range m.Points {
+							// NumberDataPoint
+							data.message(1, func(dp *pbWriter) {
+								if m.Kind == METRIC_COUNTER {
+									dp.fixed64(2, unixNano(start))
+								}
+								dp.fixed64(3, unixNano(now))
+								dp.double(4, p.Value)
+								pbAttrs(dp, 7, labelAttrs(p.Labels))
+							})
+						}
+					}
+					if m.Kind == METRIC_COUNTER {
+						// Metric.sum
+						mw.message(7, func(sum *pbWriter) {
+							points(sum)
+							sum.varint(2, otlpCumulative)
+							sum.boolean(3, true)
+						})
+					} else {
+						// Metric.gauge
+						mw.message(5, points)
+					}
+				})
+			}
+		})
+	})
+	return w.buf
+}
+
+// OTLPSink exports events as OTLP log records and, if metrics are set, exports them periodically
+type OTLPSink struct {
+	opts     OTLPOptions
+	resource []otlpAttr
+	client   *http.Client
+	metrics  *Metrics
+	stop     chan struct{}
+	done     sync.WaitGroup
+}
+
+func NewOTLPSink(opts OTLPOptions, metrics *Metrics) (*OTLPSink, error) {
+	if opts.Endpoint == "" {
+		opts.Endpoint = OTLP_DEFAULT_ENDPOINT
+	}
+	opts.Endpoint = strings.TrimRight(opts.Endpoint, "/")
+	switch opts.Encoding {
+	case "":
+		opts.Encoding = OTLP_ENCODING_PROTOBUF
+	case OTLP_ENCODING_PROTOBUF, OTLP_ENCODING_JSON:
+	default:
+		return nil, fmt.Errorf("unsupported OTLP encoding %q", opts.Encoding)
+	}
+	if opts.MetricsInterval == 0 {
+		opts.MetricsInterval = Duration(otlpMetricsInterval)
+	}
+	res := &OTLPSink{
+		opts:     opts,
+		resource: otlpResource(opts),
+		client:   &http.Client{Timeout: otlpTimeout},
+		stop:     make(chan struct{}),
+	}
+	if metrics != nil && opts.MetricsInterval > 0 {
+		res.metrics = metrics
+		res.done.Add(1)
+		go res.exportMetrics()
+	}
+	return res, nil
+}
+
+func (v *OTLPSink) post(path string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, v.opts.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if v.opts.Encoding == OTLP_ENCODING_JSON {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	}
+	for k, value := range v.opts.Headers {
+		req.Header.Set(k, value)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("OTLP collector %v: %v", path, resp.Status)
+	}
+	return nil
+}
+
+// Write exports the event at once. A failed export is not retried and the record is lost, the error is
+// reported by the dispatcher as a failure of the sink: use webhook for delivery with a disk queue
+func (v *OTLPSink) Write(e *Event) error {
+	events := []*Event{e}
+	if v.opts.Encoding == OTLP_ENCODING_JSON {
+		body, err := jsonLogs(v.resource, events)
+		if err != nil {
+			return err
+		}
+		return v.post(OTLP_LOGS_PATH, body)
+	}
+	return v.post(OTLP_LOGS_PATH, pbLogs(v.resource, events))
+}
+
+// ExportMetrics sends the current values of metrics
+func (v *OTLPSink) ExportMetrics() error {
+	if v.metrics == nil {
+		return nil
+	}
+	metrics, now := v.metrics.Collect(), time.Now()
+	if v.opts.Encoding == OTLP_ENCODING_JSON {
+		body, err := jsonMetrics(v.resource, metrics, v.metrics.Started(), now)
+		if err != nil {
+			return err
+		}
+		return v.post(OTLP_METRICS_PATH, body)
+	}
+	return v.post(OTLP_METRICS_PATH, pbMetrics(v.resource, metrics, v.metrics.Started(), now))
+}
+
+func (v *OTLPSink) exportMetrics() {
+	defer v.done.Done()
+	ticker := time.NewTicker(v.opts.MetricsInterval.Get())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-v.stop:
+			return
+		case <-ticker.C:
+			// failures are not retried, the next export has newer values
+			v.ExportMetrics()
+		}
+	}
+}
+
+// Close exports the final values of metrics
+func (v *OTLPSink) Close() error {
+	close(v.stop)
+	v.done.Wait()
+	return v.ExportMetrics()
+}
@@ -0,0 +1,488 @@
+package journal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// the requests are decoded into the same structures for both encodings
+
+type otlpTestRecord struct {
+	time, observed uint64
+	severity       int
+	severityText   string
+	body           string
+	eventName      string
+	attrs          map[string]any
+}
+
+type otlpTestPoint struct {
+	start, time uint64
+	value       float64
+	attrs       map[string]any
+}
+
+type otlpTestMetric struct {
+	kind        string // sum or gauge
+	temporality int
+	monotonic   bool
+	points      []otlpTestPoint
+}
+
+type otlpTestRequest struct {
+	resource map[string]any
+	scope    string
+	records  []otlpTestRecord
+	metrics  map[string]otlpTestMetric
+}
+
+// pbField is a decoded protobuf field, value is varint or fixed64, data - length delimited
+type pbField struct {
+	num   int
+	value uint64
+	data  []byte
+}
+
+func pbDecode(t *testing.T, data []byte) []pbField {
+	t.Helper()
+	var res []pbField
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatalf("invalid tag")
+		}
+		data = data[n:]
+		f := pbField{num: int(key >> 3)}
+		switch key & 7 {
+		case pbVarint:
+			if f.value, n = binary.Uvarint(data); n <= 0 {
+				t.Fatalf("invalid varint of field %d", f.num)
+			}
+			data = data[n:]
+		case pbFixed64:
+			f.value, data = binary.LittleEndian.Uint64(data), data[8:]
+		case pbBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				t.Fatalf("invalid length of field %d", f.num)
+			}
+			f.data, data = data[n:n+int(size)], data[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d of field %d", key&7, f.num)
+		}
+		res = append(res, f)
+	}
+	return res
+}
+
+func pbTestAttrs(t *testing.T, fields []pbField, num int) map[string]any {
+	res := make(map[string]any)
+	for _, f := range fields {
+		if f.num != num {
+			continue
+		}
+		var key string
+		var value any
+		for _, kv := range pbDecode(t, f.data) {
+			if kv.num == 1 {
+				key = string(kv.data)
+				continue
+			}
+			for _, v := range pbDecode(t, kv.data) {
+				switch v.num {
+				case 1:
+					value = string(v.data)
+				case 2:
+					value = v.value != 0
+				case 3:
+					value = int64(v.value)
+				case 4:
+					value = math.Float64frombits(v.value)
+				}
+			}
+		}
+		res[key] = value
+	}
+	return res
+}
+
+func pbTestRequest(t *testing.T, body []byte) *otlpTestRequest {
+	res := &otlpTestRequest{metrics: make(map[string]otlpTestMetric)}
+	top := pbDecode(t, body)
+	if len(top) != 1 || top[0].num != 1 {
+		t.Fatalf("request has %d fields, one resource expected", len(top))
+	}
+	for _, f := range pbDecode(t, top[0].data) {
+		switch f.num {
+		case 1:
+			res.resource = pbTestAttrs(t, pbDecode(t, f.data), 1)
+		case 2:
+			for _, s := range pbDecode(t, f.data) {
+				switch s.num {
+				case 1:
+					res.scope = string(pbDecode(t, s.data)[0].data)
+				case 2:
+					pbTestItem(t, res, s.data)
+				}
+			}
+		}
+	}
+	return res
+}
+
+// pbTestItem decodes a log record or a metric, they are told by the fields of their scope message
+func pbTestItem(t *testing.T, res *otlpTestRequest, data []byte) {
+	fields := pbDecode(t, data)
+	var name string
+	var m otlpTestMetric
+	r := otlpTestRecord{attrs: pbTestAttrs(t, fields, 6)}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			if f.data != nil {
+				name = string(f.data)
+			} else {
+				r.time = f.value
+			}
+		case 2:
+			r.severity = int(f.value)
+		case 3:
+			r.severityText = string(f.data)
+		case 5:
+			if name == "" {
+				r.body = string(pbDecode(t, f.data)[0].data)
+				continue
+			}
+			m.kind = "gauge"
+			m.points = pbTestPoints(t, f.data)
+		case 7:
+			m.kind = "sum"
+			m.points = pbTestPoints(t, f.data)
+			for _, s := range pbDecode(t, f.data) {
+				switch s.num {
+				case 2:
+					m.temporality = int(s.value)
+				case 3:
+					m.monotonic = s.value != 0
+				}
+			}
+		case 11:
+			r.observed = f.value
+		case 12:
+			r.eventName = string(f.data)
+		}
+	}
+	if name != "" {
+		res.metrics[name] = m
+	} else {
+		res.records = append(res.records, r)
+	}
+}
+
+func pbTestPoints(t *testing.T, data []byte) []otlpTestPoint {
+	var res []otlpTestPoint
+	for _, f := range pbDecode(t, data) {
+		if f.num != 1 {
+			continue
+		}
+		fields := pbDecode(t, f.data)
+		p := otlpTestPoint{attrs: pbTestAttrs(t, fields, 7)}
+		for _, v := range fields {
+			switch v.num {
+			case 2:
+				p.start = v.value
+			case 3:
+				p.time = v.value
+			case 4:
+				p.value = math.Float64frombits(v.value)
+			}
+		}
+		res = append(res, p)
+	}
+	return res
+}
+
+type jsonTestValue struct {
+	StringValue *string  `json:"stringValue"`
+	BoolValue   *bool    `json:"boolValue"`
+	IntValue    *string  `json:"intValue"`
+	DoubleValue *float64 `json:"doubleValue"`
+}
+
+type jsonTestAttr struct {
+	Key   string        `json:"key"`
+	Value jsonTestValue `json:"value"`
+}
+
+type jsonTestPoint struct {
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsDouble          float64        `json:"asDouble"`
+	Attributes        []jsonTestAttr `json:"attributes"`
+}
+
+type jsonTestData struct {
+	DataPoints             []jsonTestPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type jsonTestScope struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	LogRecords []struct {
+		TimeUnixNano         string         `json:"timeUnixNano"`
+		ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+		SeverityNumber       int            `json:"severityNumber"`
+		SeverityText         string         `json:"severityText"`
+		Body                 jsonTestValue  `json:"body"`
+		Attributes           []jsonTestAttr `json:"attributes"`
+		EventName            string         `json:"eventName"`
+	} `json:"logRecords"`
+	Metrics []struct {
+		Name  string        `json:"name"`
+		Gauge *jsonTestData `json:"gauge"`
+		Sum   *jsonTestData `json:"sum"`
+	} `json:"metrics"`
+}
+
+type jsonTestResource struct {
+	Resource struct {
+		Attributes []jsonTestAttr `json:"attributes"`
+	} `json:"resource"`
+	ScopeLogs    []jsonTestScope `json:"scopeLogs"`
+	ScopeMetrics []jsonTestScope `json:"scopeMetrics"`
+}
+
+func jsonTestAttrs(t *testing.T, attrs []jsonTestAttr) map[string]any {
+	res := make(map[string]any)
+	for _, a := range attrs {
+		switch v := a.Value; {
+		case v.StringValue != nil:
+			res[a.Key] = *v.StringValue
+		case v.BoolValue != nil:
+			res[a.Key] = *v.BoolValue
+		case v.IntValue != nil:
+			n, err := strconv.ParseInt(*v.IntValue, 10, 64)
+			if err != nil {
+				t.Errorf("attribute %v: %v", a.Key, err)
+			}
+			res[a.Key] = n
+		case v.DoubleValue != nil:
+			res[a.Key] = *v.DoubleValue
+		}
+	}
+	return res
+}
+
+func jsonTestUint(t *testing.T, text string) uint64 {
+	if text == "" {
+		return 0
+	}
+	n, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		t.Errorf("64-bit integer is not a decimal string: %q", text)
+	}
+	return n
+}
+
+func jsonTestRequest(t *testing.T, body []byte) *otlpTestRequest {
+	var req struct {
+		ResourceLogs    []jsonTestResource `json:"resourceLogs"`
+		ResourceMetrics []jsonTestResource `json:"resourceMetrics"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatal(err)
+	}
+	resources := append(req.ResourceLogs, req.ResourceMetrics...)
+	if len(resources) != 1 {
+		t.Fatalf("request has %d resources, one expected", len(resources))
+	}
+	r := resources[0]
+	scopes := append(r.ScopeLogs, r.ScopeMetrics...)
+	res := &otlpTestRequest{resource: jsonTestAttrs(t, r.Resource.Attributes), metrics: make(map[string]otlpTestMetric)}
+	for _, s := range scopes {
+		res.scope = s.Scope.Name
+		for _, l := range s.LogRecords {
+			res.records = append(res.records, otlpTestRecord{
+				time:         jsonTestUint(t, l.TimeUnixNano),
+				observed:     jsonTestUint(t, l.ObservedTimeUnixNano),
+				severity:     l.SeverityNumber,
+				severityText: l.SeverityText,
+				body:         *l.Body.StringValue,
+				eventName:    l.EventName,
+				attrs:        jsonTestAttrs(t, l.Attributes),
+			})
+		}
+		for _, m := range s.Metrics {
+			data, kind := m.Sum, "sum"
+			if m.Gauge != nil {
+				data, kind = m.Gauge, "gauge"
+			}
+			metric := otlpTestMetric{kind: kind, temporality: data.AggregationTemporality, monotonic: data.IsMonotonic}
+			for _, p := range data.DataPoints {
+				metric.points = append(metric.points, otlpTestPoint{
+					start: jsonTestUint(t, p.StartTimeUnixNano),
+					time:  jsonTestUint(t, p.TimeUnixNano),
+					value: p.AsDouble,
+					attrs: jsonTestAttrs(t, p.Attributes),
+				})
+			}
+			res.metrics[m.Name] = metric
+		}
+	}
+	return res
+}
+
+type collectedRequest struct {
+	path, contentType, auth string
+	body                    []byte
+}
+
+// startCollector records requests, it answers with status until it is changed
+func startCollector(t *testing.T) (*httptest.Server, func() []collectedRequest, func(int)) {
+	var mutex sync.Mutex
+	var requests []collectedRequest
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests = append(requests, collectedRequest{r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Authorization"), body})
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	received := func() []collectedRequest {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]collectedRequest{}, requests...)
+	}
+	setStatus := func(s int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		status = s
+	}
+	return srv, received, setStatus
+}
+
+func TestOTLPExport(t *testing.T) {
+	at := time.Date(2026, 10, 19, 9, 30, 0, 123456789, time.UTC)
+	e := NewProxyEvent(SOURCE_USER, Snapshot{Enabled: true, Server: "p:3128"}, &Snapshot{})
+	e.Time = at
+	for _, encoding := range []string{OTLP_ENCODING_PROTOBUF, OTLP_ENCODING_JSON} {
+		srv, received, setStatus := startCollector(t)
+		metrics := NewMetrics()
+		metrics.Write(e)
+		sink, err := NewOTLPSink(OTLPOptions{
+			Endpoint:        srv.URL + "/",
+			Encoding:        encoding,
+			Headers:         map[string]string{"Authorization": "Bearer token"},
+			ServiceName:     "svc",
+			Resource:        map[string]string{"deployment.environment": "test"},
+			MetricsInterval: Duration(time.Hour),
+		}, metrics)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Write(e); err != nil {
+			t.Fatalf("%v: %v", encoding, err)
+		}
+		// a failed export is not retried, the error is reported to the dispatcher
+		setStatus(http.StatusServiceUnavailable)
+		if err := sink.Write(e); err == nil {
+			t.Errorf("%v: error of the collector is not returned", encoding)
+		}
+		setStatus(http.StatusOK)
+		if err := sink.Close(); err != nil {
+			t.Fatalf("%v: %v", encoding, err)
+		}
+
+		requests := received()
+		if len(requests) != 3 || requests[0].path != OTLP_LOGS_PATH || requests[2].path != OTLP_METRICS_PATH {
+			t.Fatalf("%v: requests %+v, logs twice and metrics on close expected", encoding, requests)
+		}
+		decode, contentType := pbTestRequest, "application/x-protobuf"
+		if encoding == OTLP_ENCODING_JSON {
+			decode, contentType = jsonTestRequest, "application/json"
+		}
+		for _, r := range requests {
+			if r.contentType != contentType || r.auth != "Bearer token" {
+				t.Errorf("%v: content type %q, authorization %q", encoding, r.contentType, r.auth)
+			}
+		}
+
+		logs := decode(t, requests[0].body)
+		checkOTLPResource(t, encoding, logs)
+		if len(logs.records) != 1 {
+			t.Fatalf("%v: %d log records", encoding, len(logs.records))
+		}
+		record := logs.records[0]
+		want := otlpTestRecord{
+			time:         uint64(at.UnixNano()),
+			observed:     uint64(at.UnixNano()),
+			severity:     9,
+			severityText: "info",
+			body:         "proxy on, p:3128",
+			eventName:    "proxy-changed",
+		}
+		attrs := record.attrs
+		record.attrs = nil
+		if fmt.Sprint(record) != fmt.Sprint(want) {
+			t.Errorf("%v: log record\n%+v\nwant\n%+v", encoding, record, want)
+		}
+		wantAttrs := map[string]any{"event.type": "proxy-changed", "proxy.source": SOURCE_USER, "proxy.enabled": true,
+			"proxy.server": "p:3128", "proxy.previous.enabled": false, "proxy.previous.server": ""}
+		if fmt.Sprint(attrs) != fmt.Sprint(wantAttrs) {
+			t.Errorf("%v: log attributes %v, want %v", encoding, attrs, wantAttrs)
+		}
+
+		exported := decode(t, requests[2].body)
+		checkOTLPResource(t, encoding, exported)
+		enabled := exported.metrics["proxymon.proxy_enabled"]
+		if enabled.kind != "gauge" || len(enabled.points) != 1 || enabled.points[0].value != 1 ||
+			enabled.points[0].attrs["source"] != SOURCE_USER || enabled.points[0].start != 0 || enabled.points[0].time == 0 {
+			t.Errorf("%v: proxy_enabled %+v", encoding, enabled)
+		}
+		changes := exported.metrics["proxymon.proxy_changes_total"]
+		if changes.kind != "sum" || changes.temporality != otlpCumulative || !changes.monotonic || len(changes.points) != 2 {
+			t.Fatalf("%v: proxy_changes_total %+v", encoding, changes)
+		}
+		for i, field := range []string{"enabled", "server"} {
+			p := changes.points[i]
+			if p.value != 1 || p.attrs["field"] != field || p.start != uint64(metrics.Started().UnixNano()) {
+				t.Errorf("%v: change point %d %+v", encoding, i, p)
+			}
+		}
+		if checks, ok := exported.metrics["proxymon.registry_checks_total"]; !ok || len(checks.points) != 1 || checks.points[0].value != 0 {
+			t.Errorf("%v: zero value is not exported: %+v", encoding, checks)
+		}
+	}
+}
+
+func checkOTLPResource(t *testing.T, encoding string, req *otlpTestRequest) {
+	t.Helper()
+	if req.scope != otlpScopeName {
+		t.Errorf("%v: scope %q", encoding, req.scope)
+	}
+	for k, v := range map[string]string{"service.name": "svc", "component": EVENTLOG_SOURCE, "deployment.environment": "test"} {
+		if req.resource[k] != v {
+			t.Errorf("%v: resource %v = %v, want %v", encoding, k, req.resource[k], v)
+		}
+	}
+}
+
+func TestOTLPEncoding(t *testing.T) {
+	if _, err := NewOTLPSink(OTLPOptions{Encoding: "xml"}, nil); err == nil {
+		t.Error("unsupported encoding is accepted")
+	}
+}
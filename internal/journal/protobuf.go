@@ -0,0 +1,74 @@
+package journal
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// protobuf wire types
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+	pbFixed32 = 5
+)
+
+// pbWriter is a minimal protobuf encoder, enough for OTLP export requests
+type pbWriter struct {
+	buf []byte
+}
+
+func (v *pbWriter) tag(field, wireType int) {
+	v.buf = binary.AppendUvarint(v.buf, uint64(field)<<3|uint64(wireType))
+}
+
+func (v *pbWriter) varint(field int, value uint64) {
+	if value == 0 {
+		return
+	}
+	v.tag(field, pbVarint)
+	v.buf = binary.AppendUvarint(v.buf, value)
+}
+
+// boolean is written even when false, it is used inside oneof
+func (v *pbWriter) boolean(field int, value bool) {
+	v.tag(field, pbVarint)
+	if value {
+		v.buf = append(v.buf, 1)
+	} else {
+		v.buf = append(v.buf, 0)
+	}
+}
+
+func (v *pbWriter) fixed64(field int, value uint64) {
+	if value == 0 {
+		return
+	}
+	v.tag(field, pbFixed64)
+	v.buf = binary.LittleEndian.AppendUint64(v.buf, value)
+}
+
+// double is written even when 0, it is used inside oneof
+func (v *pbWriter) double(field int, value float64) {
+	v.tag(field, pbFixed64)
+	v.buf = binary.LittleEndian.AppendUint64(v.buf, math.Float64bits(value))
+}
+
+func (v *pbWriter) bytes(field int, value []byte) {
+	v.tag(field, pbBytes)
+	v.buf = binary.AppendUvarint(v.buf, uint64(len(value)))
+	v.buf = append(v.buf, value...)
+}
+
+func (v *pbWriter) str(field int, value string) {
+	if value == "" {
+		return
+	}
+	v.bytes(field, []byte(value))
+}
+
+func (v *pbWriter) message(field int, fill func(w *pbWriter)) {
+	var w pbWriter
+	fill(&w)
+	v.bytes(field, w.buf)
+}
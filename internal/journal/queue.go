@@ -0,0 +1,145 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const queueFileExt = ".msg"
+
+// DiskQueue is a FIFO of messages stored as separate files, so pending
+// messages survive restarts of the program. If a limit is exceeded, the oldest messages are dropped
+type DiskQueue struct {
+	dir      string
+	mutex    sync.Mutex
+	next     uint64
+	maxItems int   // 0 - no limit
+	maxBytes int64 // 0 - no limit
+}
+
+func OpenDiskQueue(dir string, maxItems int, maxBytes int64) (*DiskQueue, error) {
+	if err := os.MkdirAll(dir, 00770); err != nil {
+		return nil, err
+	}
+	res := &DiskQueue{dir: dir, maxItems: maxItems, maxBytes: maxBytes}
+	items, err := res.items()
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > 0 {
+		last, _ := strconv.ParseUint(strings.TrimSuffix(items[len(items)-1], queueFileExt), 10, 64)
+		res.next = last + 1
+	}
+	return res, nil
+}
+
+func (v *DiskQueue) items() ([]string, error) {
+	entries, err := os.ReadDir(v.dir)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), queueFileExt) {
+			res = append(res, e.Name())
+		}
+	}
+	sort.Strings(res) // names are zero padded sequence numbers
+	return res, nil
+}
+
+// Push returns the number of the oldest messages dropped because of the limits, the new one is always kept
+func (v *DiskQueue) Push(data []byte) (dropped int, err error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	name := filepath.Join(v.dir, fmt.Sprintf("%020d%v", v.next, queueFileExt))
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	v.next++
+	return v.trim()
+}
+
+// trim removes the oldest messages while the queue exceeds the limits
+func (v *DiskQueue) trim() (int, error) {
+	if v.maxItems <= 0 && v.maxBytes <= 0 {
+		return 0, nil
+	}
+	items, err := v.items()
+	if err != nil {
+		return 0, err
+	}
+	sizes := make([]int64, len(items))
+	var total int64
+	for i, name := range items {
+		if info, err := os.Stat(filepath.Join(v.dir, name)); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	dropped := 0
+	for n := len(items); n-dropped > 1; dropped++ {
+		if (v.maxItems <= 0 || n-dropped <= v.maxItems) && (v.maxBytes <= 0 || total <= v.maxBytes) {
+			break
+		}
+		if err := os.Remove(filepath.Join(v.dir, items[dropped])); err != nil && !os.IsNotExist(err) {
+			return dropped, err
+		}
+		total -= sizes[dropped]
+	}
+	return dropped, nil
+}
+
+// Peek returns the oldest message, id is empty if the queue is empty
+func (v *DiskQueue) Peek() (id string, data []byte, err error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	items, err := v.items()
+	if err != nil || len(items) == 0 {
+		return "", nil, err
+	}
+	data, err = os.ReadFile(filepath.Join(v.dir, items[0]))
+	if err != nil {
+		return "", nil, err
+	}
+	return items[0], data, nil
+}
+
+// Remove ignores messages which are already dropped by the limits
+func (v *DiskQueue) Remove(id string) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if err := os.Remove(filepath.Join(v.dir, id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (v *DiskQueue) Len() int {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	items, _ := v.items()
+	return len(items)
+}
+
+// Reject keeps an undeliverable message on disk (as *.failed) for manual inspection
+func (v *DiskQueue) Reject(id string) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	name := filepath.Join(v.dir, id)
+	if err := os.Rename(name, strings.TrimSuffix(name, queueFileExt)+".failed"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,397 @@
+package journal
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	REPORT_DAY  = "day"
+	REPORT_WEEK = "week"
+
+	reportTopGaps = 5
+)
+
+type SegmentKind int
+
+const (
+	SEGMENT_UNMONITORED SegmentKind = iota
+	SEGMENT_ON
+	SEGMENT_OFF
+)
+
+var segmentNames = map[SegmentKind]string{
+	SEGMENT_UNMONITORED: "unmonitored",
+	SEGMENT_ON:          "on",
+	SEGMENT_OFF:         "off",
+}
+
+func (v SegmentKind) String() string {
+	return segmentNames[v]
+}
+
+// Segment is a part of the timeline with the same proxy state
+type Segment struct {
+	Start, End time.Time
+	Kind       SegmentKind
+	Server     string
+}
+
+func (v Segment) Duration() time.Duration {
+	return v.End.Sub(v.Start)
+}
+
+// BuildTimeline converts events (sorted by time) of source into segments up to end.
+// The monitor is considered stopped before the first event and after stop, pause and quit events,
+// settings are known from the first state record after start
+func BuildTimeline(events []*Event, source string, end time.Time) []Segment {
+	res := make([]Segment, 0)
+	current := Segment{Kind: SEGMENT_UNMONITORED}
+	monitored := false
+	var snapshot *Snapshot
+	change := func(t time.Time) {
+		next := Segment{Start: t, Kind: SEGMENT_UNMONITORED}
+		if monitored && snapshot != nil {
+			next.Kind, next.Server = SEGMENT_OFF, ""
+			if snapshot.Enabled {
+				next.Kind, next.Server = SEGMENT_ON, snapshot.Server
+			}
+		}
+		if next.Kind == current.Kind && next.Server == current.Server {
+			return
+		}
+		if !current.Start.IsZero() && t.After(current.Start) {
+			current.End = t
+			res = append(res, current)
+		}
+		current = next
+	}
+	for _, e := range events {
+		if !e.Time.Before(end) {
+			break
+		}
+		switch {
+		case e.Type == EVENT_MONITOR_STARTED:
+			monitored, snapshot = true, nil
+		case e.Type == EVENT_MONITOR_STOPPED || e.Type == EVENT_MONITOR_QUIT || e.Type == EVENT_MONITOR_PAUSED:
+			monitored = false
+		case e.Snapshot != nil && e.Source == source:
+			// a state record without start event (filtered out or written by older versions)
+			monitored = true
+			s := *e.Snapshot
+			snapshot = &s
+		default:
+			continue
+		}
+		change(e.Time)
+	}
+	if !current.Start.IsZero() && end.After(current.Start) {
+		current.End = end
+		res = append(res, current)
+	}
+	return res
+}
+
+// ReportPeriod is one row of the report
+type ReportPeriod struct {
+	Start, End  time.Time
+	On          time.Duration
+	Off         time.Duration
+	Unmonitored time.Duration
+	Servers     []string
+	Changes     int
+	Violations  int
+	LongestGap  *Segment
+	Segments    []Segment // clipped by the period
+}
+
+type Report struct {
+	Source  string
+	Period  string
+	Since   time.Time
+	Until   time.Time
+	Periods []*ReportPeriod
+	TopGaps []Segment // the longest unmonitored gaps of the whole range
+	Total   ReportPeriod
+}
+
+// periodStart returns the local midnight of the day, or of Monday for weeks
+func periodStart(t time.Time, period string) time.Time {
+	y, m, d := t.Date()
+	res := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	if period == REPORT_WEEK {
+		res = res.AddDate(0, 0, -((int(res.Weekday()) + 6) % 7))
+	}
+	return res
+}
+
+func nextPeriod(t time.Time, period string) time.Time {
+	if period == REPORT_WEEK {
+		return t.AddDate(0, 0, 7)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+func clip(s Segment, start, end time.Time) (Segment, bool) {
+	if !s.End.After(start) || !s.Start.Before(end) {
+		return s, false
+	}
+	if s.Start.Before(start) {
+		s.Start = start
+	}
+	if s.End.After(end) {
+		s.End = end
+	}
+	return s, true
+}
+
+// isViolation: there are no policy rules, so records which need attention are counted,
+// i.e. warnings and errors (changes while the monitor was stopped, internal errors, ...)
+func isViolation(e *Event) bool {
+	return e.Severity >= SEVERITY_WARNING
+}
+
+func isChange(e *Event, source string) bool {
+	if e.Source != source || e.Snapshot == nil || e.Previous == nil {
+		return false
+	}
+	return IsStateEvent(e.Type) && *e.Snapshot != *e.Previous
+}
+
+func (v *ReportPeriod) add(s Segment) {
+	v.Segments = append(v.Segments, s)
+	switch s.Kind {
+	case SEGMENT_ON:
+		v.On += s.Duration()
+		if !containsString(v.Servers, s.Server) && s.Server != "" {
+			v.Servers = append(v.Servers, s.Server)
+		}
+	case SEGMENT_OFF:
+		v.Off += s.Duration()
+	default:
+		v.Unmonitored += s.Duration()
+		if v.LongestGap == nil || s.Duration() > v.LongestGap.Duration() {
+			gap := s
+			v.LongestGap = &gap
+		}
+	}
+}
+
+// BuildReport summarizes events of source (all events up to until, sorted by time) per period
+func BuildReport(events []*Event, source, period string, since, until time.Time) (*Report, error) {
+	if period == "" {
+		period = REPORT_DAY
+	}
+	if period != REPORT_DAY && period != REPORT_WEEK {
+		return nil, fmt.Errorf("unknown report period %q", period)
+	}
+	if !since.Before(until) {
+		return nil, fmt.Errorf("empty report range")
+	}
+	timeline := BuildTimeline(events, source, until)
+	res := &Report{Source: source, Period: period, Since: since, Until: until}
+	res.Total.Start, res.Total.End = since, until
+	for start := periodStart(since, period); start.Before(until); start = nextPeriod(start, period) {
+		p := &ReportPeriod{Start: start, End: nextPeriod(start, period)}
+		from, to := p.Start, p.End
+		if from.Before(since) {
+			from = since
+		}
+		if to.After(until) {
+			to = until
+		}
+		covered := from
+		for _, s := range timeline {
+			if c, ok := clip(s, from, to); ok {
+				if c.Start.After(covered) {
+					p.add(Segment{Start: covered, End: c.Start, Kind: SEGMENT_UNMONITORED})
+				}
+				p.add(c)
+				covered = c.End
+			}
+		}
+		if to.After(covered) {
+			p.add(Segment{Start: covered, End: to, Kind: SEGMENT_UNMONITORED})
+		}
+		for _, e := range events {
+			if e.Time.Before(from) || !e.Time.Before(to) || (e.Source != "" && e.Source != source) {
+				continue
+			}
+			if isChange(e, source) {
+				p.Changes++
+			}
+			if isViolation(e) {
+				p.Violations++
+			}
+		}
+		res.Periods = append(res.Periods, p)
+		res.Total.On += p.On
+		res.Total.Off += p.Off
+		res.Total.Unmonitored += p.Unmonitored
+		res.Total.Changes += p.Changes
+		res.Total.Violations += p.Violations
+		for _, server := range p.Servers {
+			if !containsString(res.Total.Servers, server) {
+				res.Total.Servers = append(res.Total.Servers, server)
+			}
+		}
+	}
+	// gaps are merged across period borders
+	for _, p := range res.Periods {
+		for _, s := range p.Segments {
+			if s.Kind != SEGMENT_UNMONITORED {
+				continue
+			}
+			if n := len(res.TopGaps); n > 0 && res.TopGaps[n-1].End.Equal(s.Start) {
+				res.TopGaps[n-1].End = s.End
+			} else {
+				res.TopGaps = append(res.TopGaps, s)
+			}
+		}
+	}
+	sort.SliceStable(res.TopGaps, func(i, j int) bool { return res.TopGaps[i].Duration() > res.TopGaps[j].Duration() })
+	if len(res.TopGaps) > reportTopGaps {
+		res.TopGaps = res.TopGaps[:reportTopGaps]
+	}
+	return res, nil
+}
+
+func formatReportDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	h, m := int(d.Hours()), int(d.Minutes())%60
+	if h >= 24 {
+		return fmt.Sprintf("%dd %02dh %02dm", h/24, h%24, m)
+	}
+	return fmt.Sprintf("%dh %02dm", h, m)
+}
+
+const reportTimeFormat = "2006-01-02 15:04"
+
+func (v *ReportPeriod) title(period string) string {
+	if period == REPORT_WEEK {
+		return v.Start.Format("2006-01-02") + " .. " + v.End.AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	return v.Start.Format("2006-01-02 Mon")
+}
+
+func (v *ReportPeriod) gapText() string {
+	if v.LongestGap == nil || v.LongestGap.Duration() == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%v (%v)", formatReportDuration(v.LongestGap.Duration()), v.LongestGap.Start.Format("15:04"))
+}
+
+// WriteText writes the report as a plain text table
+func (v *Report) WriteText(w io.Writer) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "Proxy report for %v, %v .. %v, per %v\n\n", v.Source, v.Since.Format(reportTimeFormat), v.Until.Format(reportTimeFormat), v.Period)
+	row := "%-25v %13v %13v %13v %8v %10v %8v  %v\n"
+	fmt.Fprintf(b, row, "Period", "Proxy on", "Proxy off", "Unmonitored", "Changes", "Violations", "Servers", "Longest gap")
+	for _, p := range v.Periods {
+		fmt.Fprintf(b, row, p.title(v.Period), formatReportDuration(p.On), formatReportDuration(p.Off), formatReportDuration(p.Unmonitored),
+			p.Changes, p.Violations, len(p.Servers), p.gapText())
+	}
+	fmt.Fprintf(b, row, "Total", formatReportDuration(v.Total.On), formatReportDuration(v.Total.Off), formatReportDuration(v.Total.Unmonitored),
+		v.Total.Changes, v.Total.Violations, len(v.Total.Servers), "")
+	b.WriteString("\nServers:\n")
+	if len(v.Total.Servers) == 0 {
+		b.WriteString("  -\n")
+	}
+	for _, s := range v.Total.Servers {
+		fmt.Fprintf(b, "  %v\n", s)
+	}
+	b.WriteString("\nLongest unmonitored gaps:\n")
+	if len(v.TopGaps) == 0 {
+		b.WriteString("  -\n")
+	}
+	for _, g := range v.TopGaps {
+		fmt.Fprintf(b, "  %v .. %v  %v\n", g.Start.Format(reportTimeFormat), g.End.Format(reportTimeFormat), formatReportDuration(g.Duration()))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+const timelineWidth = 720
+
+type timelineRect struct {
+	X, Width float64
+	Class    string
+	Title    string
+}
+
+func (v *ReportPeriod) timeline() []timelineRect {
+	total := v.End.Sub(v.Start).Seconds()
+	res := make([]timelineRect, 0, len(v.Segments))
+	for _, s := range v.Segments {
+		title := fmt.Sprintf("%v .. %v %v", s.Start.Format(reportTimeFormat), s.End.Format(reportTimeFormat), s.Kind)
+		if s.Server != "" {
+			title += ", " + s.Server
+		}
+		res = append(res, timelineRect{
+			X:     s.Start.Sub(v.Start).Seconds() / total * timelineWidth,
+			Width: s.Duration().Seconds() / total * timelineWidth,
+			Class: s.Kind.String(),
+			Title: title,
+		})
+	}
+	return res
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"duration": formatReportDuration,
+	"time":     func(t time.Time) string { return t.Format(reportTimeFormat) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Proxy report {{.Report.Source}}</title>
+<style>
+body { font-family: Segoe UI, Arial, sans-serif; font-size: 14px; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 3px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.on { fill: #e8a33d; } .off { fill: #5cb85c; } .unmonitored { fill: #c9302c; }
+.legend span { display: inline-block; width: 12px; height: 12px; margin: 0 4px 0 12px; }
+</style>
+</head>
+<body>
+<h2>Proxy report for {{.Report.Source}}</h2>
+<p>{{time .Report.Since}} .. {{time .Report.Until}}, per {{.Report.Period}}</p>
+<p class="legend"><span style="background:#e8a33d"></span>proxy on<span style="background:#5cb85c"></span>proxy off<span style="background:#c9302c"></span>unmonitored</p>
+<table>
+<tr><th>Period</th><th>Timeline</th><th>Proxy on</th><th>Proxy off</th><th>Unmonitored</th><th>Changes</th><th>Violations</th><th>Servers</th><th>Longest gap</th></tr>
+{{range .Rows}}<tr><td>{{.Title}}</td><td><svg width="{{$.Width}}" height="14">{{range .Timeline}}<rect x="{{printf "%.2f" .X}}" y="0" width="{{printf "%.2f" .Width}}" height="14" class="{{.Class}}"><title>{{.Title}}</title></rect>{{end}}</svg></td><td>{{duration .Period.On}}</td><td>{{duration .Period.Off}}</td><td>{{duration .Period.Unmonitored}}</td><td>{{.Period.Changes}}</td><td>{{.Period.Violations}}</td><td>{{len .Period.Servers}}</td><td>{{.Gap}}</td></tr>
+{{end}}<tr><th>Total</th><th></th><th>{{duration .Report.Total.On}}</th><th>{{duration .Report.Total.Off}}</th><th>{{duration .Report.Total.Unmonitored}}</th><th>{{.Report.Total.Changes}}</th><th>{{.Report.Total.Violations}}</th><th>{{len .Report.Total.Servers}}</th><th></th></tr>
+</table>
+<h3>Servers</h3>
+<ul>{{range .Report.Total.Servers}}<li>{{.}}</li>{{else}}<li>-</li>{{end}}</ul>
+<h3>Longest unmonitored gaps</h3>
+<ul>{{range .Report.TopGaps}}<li>{{time .Start}} .. {{time .End}}: {{duration .Duration}}</li>{{else}}<li>-</li>{{end}}</ul>
+<p><small>Violations are records with warning or error severity (e.g. changes while the monitor was stopped, internal errors).</small></p>
+</body>
+</html>
+`))
+
+type reportRow struct {
+	Title    string
+	Period   *ReportPeriod
+	Timeline []timelineRect
+	Gap      string
+}
+
+// WriteHTML writes the report as a standalone HTML page with SVG timelines
+func (v *Report) WriteHTML(w io.Writer) error {
+	rows := make([]reportRow, len(v.Periods))
+	for i, p := range v.Periods {
+		rows[i] = reportRow{p.title(v.Period), p, p.timeline(), p.gapText()}
+	}
+	return reportTemplate.Execute(w, struct {
+		Report *Report
+		Rows   []reportRow
+		Width  int
+	}{v, rows, timelineWidth})
+}
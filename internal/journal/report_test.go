@@ -0,0 +1,174 @@
+package journal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 2026-06-01 is Monday
+func reportTime(day, hour int) time.Time {
+	return time.Date(2026, 6, day, hour, 0, 0, 0, time.Local)
+}
+
+// reportTestEvents: monitored on Monday 08:00-18:00 and Tuesday 09:00-20:00
+func reportTestEvents() []*Event {
+	off, p1, p2 := Snapshot{}, Snapshot{Enabled: true, Server: "p1:8080"}, Snapshot{Enabled: true, Server: "<p2>:3128"}
+	at := func(e *Event, day, hour int) *Event {
+		e.Time = reportTime(day, hour)
+		return e
+	}
+	other := NewProxyEvent("HKLM", p1, &off)
+	return []*Event{
+		at(NewLifecycleEvent(EVENT_MONITOR_STARTED, "", ""), 1, 8),
+		at(NewProxyEvent(SOURCE_USER, off, nil), 1, 8),
+		at(NewProxyEvent(SOURCE_USER, p1, &off), 1, 9),
+		at(other, 1, 10), // other source
+		at(NewProxyEvent(SOURCE_USER, p2, &p1), 1, 12),
+		at(NewLifecycleEvent(EVENT_MONITOR_STOPPED, "", ""), 1, 18),
+		at(NewLifecycleEvent(EVENT_MONITOR_STARTED, "", ""), 2, 9),
+		at(NewOfflineChangeEvent(SOURCE_USER, p2, off, 15*time.Hour), 2, 9),
+		at(NewEvent(EVENT_INTERNAL_ERROR, SEVERITY_ERROR, "access denied"), 2, 17),
+		at(NewLifecycleEvent(EVENT_MONITOR_PAUSED, "", ""), 2, 20),
+	}
+}
+
+// periodText is a short form of a report row for comparison
+func periodText(p *ReportPeriod) string {
+	gap := "-"
+	if p.LongestGap != nil {
+		gap = p.LongestGap.Start.Format("Mon 15:04") + "+" + formatReportDuration(p.LongestGap.Duration())
+	}
+	return fmt.Sprintf("%v on %v off %v unmonitored %v changes %d violations %d servers %v gap %v",
+		p.Start.Format("Mon 02"), formatReportDuration(p.On), formatReportDuration(p.Off), formatReportDuration(p.Unmonitored),
+		p.Changes, p.Violations, p.Servers, gap)
+}
+
+func gapsText(gaps []Segment) string {
+	var res []string
+	for _, g := range gaps {
+		res = append(res, g.Start.Format("Mon 15:04")+".."+g.End.Format("Mon 15:04"))
+	}
+	return strings.Join(res, ", ")
+}
+
+func TestBuildReport(t *testing.T) {
+	tests := []struct {
+		name         string
+		period       string
+		since, until time.Time
+		periods      []string
+		total        string
+		gaps         string
+	}{
+		{
+			"days", REPORT_DAY, reportTime(1, 0), reportTime(3, 12),
+			[]string{
+				"Mon 01 on 9h 00m off 1h 00m unmonitored 14h 00m changes 2 violations 0 servers [p1:8080 <p2>:3128] gap Mon 00:00+8h 00m",
+				"Tue 02 on 11h 00m off 0h 00m unmonitored 13h 00m changes 1 violations 2 servers [<p2>:3128] gap Tue 00:00+9h 00m",
+				// the last state lasts up to the end of the range
+				"Wed 03 on 0h 00m off 0h 00m unmonitored 12h 00m changes 0 violations 0 servers [] gap Wed 00:00+12h 00m",
+			},
+			"Mon 01 on 20h 00m off 1h 00m unmonitored 1d 15h 00m changes 3 violations 2 servers [p1:8080 <p2>:3128] gap -",
+			// gaps are merged across days
+			"Tue 20:00..Wed 12:00, Mon 18:00..Tue 09:00, Mon 00:00..Mon 08:00",
+		},
+		{
+			"range ends while proxy is on", REPORT_DAY, reportTime(2, 0), reportTime(2, 15),
+			[]string{"Tue 02 on 6h 00m off 0h 00m unmonitored 9h 00m changes 1 violations 1 servers [<p2>:3128] gap Tue 00:00+9h 00m"},
+			"Tue 02 on 6h 00m off 0h 00m unmonitored 9h 00m changes 1 violations 1 servers [<p2>:3128] gap -",
+			"Tue 00:00..Tue 09:00",
+		},
+		{
+			"state from before the range", REPORT_DAY, reportTime(1, 10), reportTime(1, 11),
+			[]string{"Mon 01 on 1h 00m off 0h 00m unmonitored 0h 00m changes 0 violations 0 servers [p1:8080] gap -"},
+			"Mon 01 on 1h 00m off 0h 00m unmonitored 0h 00m changes 0 violations 0 servers [p1:8080] gap -",
+			"",
+		},
+		{
+			"no events in the range", REPORT_DAY, reportTime(5, 0), reportTime(7, 0),
+			[]string{
+				"Fri 05 on 0h 00m off 0h 00m unmonitored 1d 00h 00m changes 0 violations 0 servers [] gap Fri 00:00+1d 00h 00m",
+				"Sat 06 on 0h 00m off 0h 00m unmonitored 1d 00h 00m changes 0 violations 0 servers [] gap Sat 00:00+1d 00h 00m",
+			},
+			"Fri 05 on 0h 00m off 0h 00m unmonitored 2d 00h 00m changes 0 violations 0 servers [] gap -",
+			"Fri 00:00..Sun 00:00",
+		},
+		{
+			"week", REPORT_WEEK, reportTime(2, 6), reportTime(4, 0),
+			[]string{"Mon 01 on 11h 00m off 0h 00m unmonitored 1d 07h 00m changes 1 violations 2 servers [<p2>:3128] gap Tue 20:00+1d 04h 00m"},
+			"Tue 02 on 11h 00m off 0h 00m unmonitored 1d 07h 00m changes 1 violations 2 servers [<p2>:3128] gap -",
+			"Tue 20:00..Thu 00:00, Tue 06:00..Tue 09:00",
+		},
+	}
+	for _, test := range tests {
+		r, err := BuildReport(reportTestEvents(), SOURCE_USER, test.period, test.since, test.until)
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		var periods []string
+		for _, p := range r.Periods {
+			periods = append(periods, periodText(p))
+		}
+		if fmt.Sprint(periods) != fmt.Sprint(test.periods) {
+			t.Errorf("%v: periods\n%v\nwant\n%v", test.name, strings.Join(periods, "\n"), strings.Join(test.periods, "\n"))
+		}
+		if got := periodText(&r.Total); got != test.total {
+			t.Errorf("%v: total\n%v\nwant\n%v", test.name, got, test.total)
+		}
+		if got := gapsText(r.TopGaps); got != test.gaps {
+			t.Errorf("%v: gaps %v, want %v", test.name, got, test.gaps)
+		}
+	}
+}
+
+func TestBuildReportErrors(t *testing.T) {
+	if _, err := BuildReport(nil, SOURCE_USER, REPORT_DAY, reportTime(1, 0), reportTime(1, 0)); err == nil {
+		t.Errorf("empty range: no error")
+	}
+	if _, err := BuildReport(nil, SOURCE_USER, REPORT_DAY, reportTime(2, 0), reportTime(1, 0)); err == nil {
+		t.Errorf("reversed range: no error")
+	}
+	if _, err := BuildReport(nil, SOURCE_USER, "month", reportTime(1, 0), reportTime(2, 0)); err == nil {
+		t.Errorf("unknown period: no error")
+	}
+	r, err := BuildReport(nil, SOURCE_USER, "", reportTime(1, 0), reportTime(1, 1))
+	if err != nil || r.Period != REPORT_DAY || len(r.Periods) != 1 {
+		t.Errorf("default period: %+v, %v", r, err)
+	}
+}
+
+func TestReportOutput(t *testing.T) {
+	r, err := BuildReport(reportTestEvents(), SOURCE_USER, REPORT_DAY, reportTime(1, 0), reportTime(3, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text strings.Builder
+	if err := r.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Proxy report for HKCU, 2026-06-01 00:00 .. 2026-06-03 00:00, per day\n",
+		"2026-06-01 Mon                   9h 00m        1h 00m       14h 00m        2          0        2  8h 00m (00:00)\n",
+		"Total                           20h 00m        1h 00m    1d 03h 00m        3          2        2  \n",
+		"Servers:\n  p1:8080\n  <p2>:3128\n",
+		"  2026-06-01 18:00 .. 2026-06-02 09:00  15h 00m\n",
+	} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text report has no %q:\n%v", want, text.String())
+		}
+	}
+	var html strings.Builder
+	if err := r.WriteHTML(&html); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(html.String(), "<p2>") || !strings.Contains(html.String(), "<li>&lt;p2&gt;:3128</li>") {
+		t.Errorf("server names are not escaped:\n%v", html.String())
+	}
+	// Monday: 8h unmonitored, 1h off, 9h on, 6h unmonitored
+	if !strings.Contains(html.String(), `<rect x="240.00" y="0" width="30.00" height="14" class="off">`) {
+		t.Errorf("timeline:\n%v", html.String())
+	}
+}
@@ -0,0 +1,370 @@
+package journal
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Duration is a time.Duration that is read from config as "30m", "12h" or "7d"
+type Duration time.Duration
+
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func (v Duration) Get() time.Duration {
+	return time.Duration(v)
+}
+
+func (v Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(v).String())
+}
+
+func (v *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var seconds int64
+		if err := json.Unmarshal(data, &seconds); err != nil {
+			return fmt.Errorf("duration must be a string or a number of seconds")
+		}
+		*v = Duration(time.Duration(seconds) * time.Second)
+		return nil
+	}
+	d, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*v = Duration(d)
+	return nil
+}
+
+type RotateOptions struct {
+	MaxSize    int64    `json:"maxSize"`    // bytes, 0 - no size limit
+	Interval   Duration `json:"interval"`   // rotate every interval (aligned to local midnight), 0 - disabled
+	MaxBackups int      `json:"maxBackups"` // rotated files to keep, 0 - keep all
+	MaxAge     Duration `json:"maxAge"`     // remove rotated files older than MaxAge, 0 - keep all
+	Compress   bool     `json:"compress"`   // gzip rotated files
+}
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+var errFileClosed = fmt.Errorf("rotating file is closed")
+
+// RotatingFile is an append-only file which is safe for concurrent use,
+// so it can be rotated while the monitor is writing into it
+type RotatingFile struct {
+	path   string
+	opts   RotateOptions
+	mutex  sync.Mutex
+	file   *os.File
+	size   int64
+	period time.Time
+	closed bool
+	remove func(name string) error // removal of expired files, os.Remove by default
+
+	maintenance sync.Mutex
+	background  sync.WaitGroup
+}
+
+func OpenRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	// periods longer than a day are counted in days from midnight
+	if day := 24 * time.Hour; opts.Interval.Get() > day && opts.Interval.Get()%day != 0 {
+		return nil, fmt.Errorf("rotation interval %v is longer than a day, but not a whole number of days", opts.Interval.Get())
+	}
+	res := &RotatingFile{path: path, opts: opts, remove: os.Remove}
+	if err := res.open(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (v *RotatingFile) Path() string {
+	return v.path
+}
+
+// SetRemoveFunc replaces removal of expired files, e.g. to save something from them before
+func (v *RotatingFile) SetRemoveFunc(remove func(name string) error) {
+	v.maintenance.Lock()
+	v.remove = remove
+	v.maintenance.Unlock()
+}
+
+func (v *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(v.path), 00770); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(v.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	v.file, v.size = f, info.Size()
+	if v.size > 0 {
+		v.period = v.periodStart(info.ModTime())
+	} else {
+		v.period = v.periodStart(time.Now())
+	}
+	return nil
+}
+
+func (v *RotatingFile) Write(p []byte) (int, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.closed {
+		return 0, errFileClosed
+	}
+	if v.file == nil {
+		if err := v.open(); err != nil {
+			return 0, err
+		}
+	}
+	if v.needRotate(int64(len(p)), time.Now()) {
+		if err := v.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := v.file.Write(p)
+	v.size += int64(n)
+	return n, err
+}
+
+func (v *RotatingFile) needRotate(size int64, now time.Time) bool {
+	if v.size == 0 {
+		return false
+	}
+	if v.opts.MaxSize > 0 && v.size+size > v.opts.MaxSize {
+		return true
+	}
+	return v.opts.Interval > 0 && v.periodStart(now).After(v.period)
+}
+
+func (v *RotatingFile) periodStart(t time.Time) time.Time {
+	interval := v.opts.Interval.Get()
+	if interval <= 0 {
+		return time.Time{}
+	}
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	if interval < 24*time.Hour {
+		return day.Add(t.Sub(day) / interval * interval)
+	}
+	// whole days, counted from Monday 2000-01-03 so weekly rotation starts on Monday
+	epoch := time.Date(2000, 1, 3, 0, 0, 0, 0, t.Location())
+	days := int(day.Sub(epoch).Hours()/24 + 0.5)
+	n := int(interval / (24 * time.Hour))
+	return epoch.AddDate(0, 0, days-days%n)
+}
+
+// Rotate forces rotation of the current file
+func (v *RotatingFile) Rotate() error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.closed {
+		return errFileClosed
+	}
+	if v.file == nil {
+		return v.open()
+	}
+	return v.rotate()
+}
+
+func (v *RotatingFile) rotate() error {
+	if err := v.file.Close(); err != nil {
+		return err
+	}
+	v.file = nil
+	backup := v.backupName(time.Now())
+	if err := os.Rename(v.path, backup); err != nil {
+		return err
+	}
+	if err := v.open(); err != nil {
+		return err
+	}
+	v.background.Add(1)
+	go v.maintain(backup)
+	return nil
+}
+
+func (v *RotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(v.path)
+	base := strings.TrimSuffix(v.path, ext) + "-" + t.Format(backupTimeFormat)
+	name := base + ext
+	for i := 1; fileExists(name) || fileExists(name+".gz"); i++ {
+		name = fmt.Sprintf("%v.%v%v", base, i, ext)
+	}
+	return name
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func (v *RotatingFile) maintain(backup string) {
+	defer v.background.Done()
+	v.maintenance.Lock()
+	defer v.maintenance.Unlock()
+	if v.opts.Compress {
+		if err := compressFile(backup); err != nil {
+			fmt.Printf("Log compression error: %v\n", err)
+		}
+	}
+	if err := v.removeExpired(time.Now()); err != nil {
+		fmt.Printf("Log retention error: %v\n", err)
+	}
+}
+
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	tmp := name + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		src.Close()
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	src.Close() // before removing, it is not possible to remove an open file on Windows
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+".gz")
+	}
+	if err != nil {
+		// the source is kept, it is the only copy
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(name)
+}
+
+type backupFile struct {
+	name    string
+	rotated time.Time
+	counter int // files rotated within the same millisecond get ".N" before extension
+}
+
+// LogFiles returns rotated files of the log from the oldest one and the log itself
+func LogFiles(path string) ([]string, error) {
+	files, err := listBackups(path)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(files)+1)
+	for i := len(files) - 1; i >= 0; i-- {
+		res = append(res, files[i].name)
+	}
+	if fileExists(path) {
+		res = append(res, path)
+	}
+	return res, nil
+}
+
+func listBackups(path string) ([]backupFile, error) {
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(filepath.Base(path), ext) + "-"
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]backupFile, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimPrefix(name, prefix)
+		if len(stamp) < len(backupTimeFormat) {
+			continue
+		}
+		t, err := time.ParseInLocation(backupTimeFormat, stamp[:len(backupTimeFormat)], time.Local)
+		if err != nil {
+			continue
+		}
+		rest := strings.TrimSuffix(stamp[len(backupTimeFormat):], ".gz")
+		if !strings.HasSuffix(rest, ext) {
+			continue
+		}
+		counter := 0
+		if rest = strings.TrimSuffix(rest, ext); rest != "" {
+			if counter, err = strconv.Atoi(strings.TrimPrefix(rest, ".")); err != nil || rest[0] != '.' {
+				continue
+			}
+		}
+		res = append(res, backupFile{filepath.Join(filepath.Dir(path), name), t, counter})
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].rotated.Equal(res[j].rotated) {
+			return res[i].counter > res[j].counter
+		}
+		return res[i].rotated.After(res[j].rotated)
+	})
+	return res, nil
+}
+
+func (v *RotatingFile) removeExpired(now time.Time) error {
+	if v.opts.MaxBackups <= 0 && v.opts.MaxAge <= 0 {
+		return nil
+	}
+	files, err := listBackups(v.path)
+	if err != nil {
+		return err
+	}
+	var res error
+	for i, f := range files {
+		expired := v.opts.MaxBackups > 0 && i >= v.opts.MaxBackups
+		if v.opts.MaxAge > 0 && now.Sub(f.rotated) > v.opts.MaxAge.Get() {
+			expired = true
+		}
+		if expired {
+			if err := v.remove(f.name); err != nil && res == nil {
+				res = err
+			}
+		}
+	}
+	return res
+}
+
+func (v *RotatingFile) Close() error {
+	v.mutex.Lock()
+	v.closed = true
+	var err error
+	if v.file != nil {
+		err = v.file.Close()
+		v.file = nil
+	}
+	v.mutex.Unlock()
+	v.background.Wait()
+	return err
+}
@@ -0,0 +1,258 @@
+package journal
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readLogFiles joins the rotated files and the log from the oldest one
+func readLogFiles(t *testing.T, path string) (string, []string) {
+	backups, err := listBackups(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for i := len(backups) - 1; i >= 0; i-- {
+		files = append(files, backups[i].name)
+	}
+	files = append(files, path)
+	var res strings.Builder
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = f
+		if strings.HasSuffix(name, ".gz") {
+			zr, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatalf("%v: %v", name, err)
+			}
+			r = zr
+		}
+		if _, err := io.Copy(&res, r); err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		f.Close()
+	}
+	return res.String(), files
+}
+
+func writeLines(t *testing.T, f *RotatingFile, from, to int) string {
+	var res strings.Builder
+	for i := from; i < to; i++ {
+		line := fmt.Sprintf("record %04d .......................\n", i) // 36 bytes
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		res.WriteString(line)
+	}
+	return res.String()
+}
+
+func TestRotateBySize(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "app.log")
+		f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 100, Compress: compress})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := writeLines(t, f, 0, 10)
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		got, files := readLogFiles(t, path)
+		if got != want {
+			t.Errorf("compress %v: content\n%v", compress, got)
+		}
+		// 2 records of 36 bytes fit into 100 bytes
+		if len(files) != 5 || files[4] != path {
+			t.Errorf("compress %v: files %v", compress, files)
+		}
+		for _, name := range files[:len(files)-1] {
+			if strings.HasSuffix(name, ".gz") != compress {
+				t.Errorf("compress %v: backup %v", compress, name)
+			}
+		}
+		if tmp, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.tmp")); len(tmp) > 0 {
+			t.Errorf("temporary files are left: %v", tmp)
+		}
+	}
+}
+
+func TestRotateLargeRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a record larger than the limit is written into an empty file, no empty backups are made
+	want := writeLines(t, f, 0, 3)
+	f.Close()
+	got, files := readLogFiles(t, path)
+	if got != want || len(files) != 3 {
+		t.Errorf("files %v, content\n%v", files, got)
+	}
+}
+
+func TestRotateByTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := OpenRotatingFile(path, RotateOptions{Interval: Duration(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := writeLines(t, f, 0, 2)
+	// the file was opened in the previous hour
+	f.mutex.Lock()
+	f.period = f.period.Add(-time.Hour)
+	f.mutex.Unlock()
+	want += writeLines(t, f, 2, 4)
+	f.Close()
+	got, files := readLogFiles(t, path)
+	if got != want || len(files) != 2 {
+		t.Errorf("files %v, content\n%v", files, got)
+	}
+
+	// the period of an existing file is taken from its modification time
+	yesterday := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(path, yesterday, yesterday); err != nil {
+		t.Fatal(err)
+	}
+	f, err = OpenRotatingFile(path, RotateOptions{Interval: Duration(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want += writeLines(t, f, 4, 5)
+	f.Close()
+	got, files = readLogFiles(t, path)
+	if got != want || len(files) != 3 {
+		t.Errorf("reopened: files %v, content\n%v", files, got)
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	// 2026-10-21 is Wednesday
+	at := time.Date(2026, 10, 21, 13, 35, 20, 0, time.Local)
+	tests := []struct {
+		interval string
+		want     time.Time
+	}{
+		{"0", time.Time{}},
+		{"30m", time.Date(2026, 10, 21, 13, 30, 0, 0, time.Local)},
+		{"6h", time.Date(2026, 10, 21, 12, 0, 0, 0, time.Local)},
+		{"7h", time.Date(2026, 10, 21, 7, 0, 0, 0, time.Local)}, // the last period of a day is shorter
+		{"24h", time.Date(2026, 10, 21, 0, 0, 0, 0, time.Local)},
+		{"1d", time.Date(2026, 10, 21, 0, 0, 0, 0, time.Local)},
+		{"7d", time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local)}, // Monday
+		{"2d", time.Date(2026, 10, 21, 0, 0, 0, 0, time.Local)}, // even days from 2000-01-03
+	}
+	for _, test := range tests {
+		interval, err := ParseDuration(test.interval)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := &RotatingFile{opts: RotateOptions{Interval: Duration(interval)}}
+		if got := f.periodStart(at); !got.Equal(test.want) {
+			t.Errorf("%v: %v, want %v", test.interval, got, test.want)
+		}
+	}
+}
+
+func TestRotateInterval(t *testing.T) {
+	dir := t.TempDir()
+	for _, interval := range []time.Duration{25 * time.Hour, 36 * time.Hour, 7*24*time.Hour + time.Minute} {
+		if _, err := OpenRotatingFile(filepath.Join(dir, "app.log"), RotateOptions{Interval: Duration(interval)}); err == nil {
+			t.Errorf("%v: no error", interval)
+		}
+	}
+	for _, interval := range []time.Duration{time.Minute, 5 * time.Hour, 24 * time.Hour, 48 * time.Hour, 7 * 24 * time.Hour} {
+		f, err := OpenRotatingFile(filepath.Join(dir, "app.log"), RotateOptions{Interval: Duration(interval)})
+		if err != nil {
+			t.Errorf("%v: %v", interval, err)
+			continue
+		}
+		f.Close()
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	now := time.Date(2026, 10, 21, 12, 0, 0, 0, time.Local)
+	// backups rotated 1..5 days ago, newest first, and unrelated files
+	backups := []string{
+		"app-" + now.AddDate(0, 0, -1).Format(backupTimeFormat) + ".log",
+		"app-" + now.AddDate(0, 0, -2).Format(backupTimeFormat) + ".log.gz",
+		"app-" + now.AddDate(0, 0, -2).Add(-time.Hour).Format(backupTimeFormat) + ".log.gz",
+		"app-" + now.AddDate(0, 0, -4).Format(backupTimeFormat) + ".log",
+		"app-" + now.AddDate(0, 0, -5).Format(backupTimeFormat) + ".log.gz",
+	}
+	others := []string{"app.log", "app-notes.log", "app-" + now.Format(backupTimeFormat) + ".txt", "other-" + now.Format(backupTimeFormat) + ".log"}
+	tests := []struct {
+		name string
+		opts RotateOptions
+		keep int // newest backups
+	}{
+		{"no limits", RotateOptions{}, 5},
+		{"max backups", RotateOptions{MaxBackups: 2}, 2},
+		{"max age", RotateOptions{MaxAge: Duration(3 * 24 * time.Hour)}, 3},
+		{"both", RotateOptions{MaxBackups: 4, MaxAge: Duration(3 * 24 * time.Hour)}, 3},
+		{"max backups first", RotateOptions{MaxBackups: 1, MaxAge: Duration(3 * 24 * time.Hour)}, 1},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		for _, name := range append(append([]string{}, backups...), others...) {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f, err := OpenRotatingFile(filepath.Join(dir, "app.log"), test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = f.removeExpired(now)
+		f.Close()
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		entries, _ := os.ReadDir(dir)
+		var left []string
+		for _, e := range entries {
+			left = append(left, e.Name())
+		}
+		want := append(append([]string{}, backups[:test.keep]...), others...)
+		sort.Strings(want)
+		if fmt.Sprint(left) != fmt.Sprint(want) {
+			t.Errorf("%v: files %v, want %v", test.name, left, want)
+		}
+	}
+}
+
+func TestRotateRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 50, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := writeLines(t, f, 0, 6)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// every record is in its own file, the 3 oldest ones are removed
+	got, files := readLogFiles(t, path)
+	if len(files) != 3 || got != all[3*36:] {
+		t.Errorf("files %v, content\n%v", files, got)
+	}
+	if _, err := f.Write([]byte("x\n")); err != errFileClosed {
+		t.Errorf("write after Close: %v", err)
+	}
+	if err := f.Rotate(); err != errFileClosed {
+		t.Errorf("rotate after Close: %v", err)
+	}
+}
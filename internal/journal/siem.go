@@ -0,0 +1,172 @@
+package journal
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	FORMAT_CEF  = "cef"  // ArcSight Common Event Format
+	FORMAT_LEEF = "leef" // QRadar Log Event Extended Format 1.0
+
+	SIEM_VENDOR  = "AI-Sid"
+	SIEM_PRODUCT = "proxyMon"
+)
+
+// ProductVersion is reported to SIEM and can be set at build time with -ldflags "-X ..."
+var ProductVersion = "1.0"
+
+var (
+	identityOnce sync.Once
+	hostName     string
+	userName     string
+)
+
+// localIdentity returns the host and the user the monitor runs for
+func localIdentity() (host, name string) {
+	identityOnce.Do(func() {
+		hostName, _ = os.Hostname()
+		if u, err := user.Current(); err == nil {
+			userName = u.Username
+		}
+	})
+	return hostName, userName
+}
+
+// SIEM severities 0..10; there is no policy engine, the event severity is used
+var siemSeverities = map[Severity]int{
+	SEVERITY_INFO:    3,
+	SEVERITY_WARNING: 6,
+	SEVERITY_ERROR:   9,
+}
+
+func siemSeverity(e *Event) int {
+	if s, ok := siemSeverities[e.Severity]; ok {
+		return s
+	}
+	return 5
+}
+
+// siemName is the human readable event name of CEF header
+func siemName(e *Event) string {
+	if text, ok := lifecycleTexts[e.Type]; ok {
+		return text
+	}
+	switch e.Type {
+	case EVENT_PROXY_CHANGED:
+		return "proxy changed"
+	case EVENT_OFFLINE_CHANGE:
+		return offlineChangeText
+	case EVENT_PROXY_UNCHANGED:
+		return "proxy unchanged"
+	case EVENT_PROXY_SNAPSHOT:
+		return "proxy snapshot"
+	}
+	return e.Type.String()
+}
+
+type siemField struct {
+	key, value string
+}
+
+// siemFields maps the event onto extension keys, CEF and LEEF share the standard ones
+// and custom strings are labelled in CEF (csN/csNLabel)
+func siemFields(e *Event, cef bool) []siemField {
+	host, user := localIdentity()
+	res := make([]siemField, 0, 16)
+	add := func(key, value string) {
+		if value != "" {
+			res = append(res, siemField{key, value})
+		}
+	}
+	custom := 0
+	addCustom := func(label, value string) {
+		if value == "" {
+			return
+		}
+		if cef {
+			custom++
+			n := strconv.Itoa(custom)
+			add("cs"+n+"Label", label)
+			add("cs"+n, value)
+		} else {
+			add(label, value)
+		}
+	}
+	if cef {
+		add("rt", strconv.FormatInt(e.Time.UnixMilli(), 10))
+		add("dvchost", host)
+		add("suser", user)
+	} else {
+		add("devTime", e.Time.Format("2006-01-02T15:04:05.000-0700"))
+		add("devTimeFormat", "yyyy-MM-dd'T'HH:mm:ss.SSSZ")
+		add("sev", strconv.Itoa(siemSeverity(e)))
+		add("identHostName", host)
+		add("usrName", user)
+	}
+	add("cat", e.Type.String())
+	add("msg", e.Text())
+	if e.Snapshot != nil {
+		addCustom("proxySource", e.Source)
+		addCustom("proxyEnabled", strconv.FormatBool(e.Snapshot.Enabled))
+		addCustom("proxyServer", e.Snapshot.Server)
+	}
+	if e.Previous != nil {
+		addCustom("previousProxyEnabled", strconv.FormatBool(e.Previous.Enabled))
+		addCustom("previousProxyServer", e.Previous.Server)
+	}
+	if e.Origin != "" {
+		addCustom("origin", e.Origin)
+	}
+	return res
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+	leefHeaderEscaper   = strings.NewReplacer(`|`, " ", "\r", " ", "\n", " ")
+	leefValueEscaper    = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+)
+
+type CEFFormatter struct{}
+
+// Format returns "CEF:0|vendor|product|version|event id|name|severity|extension"
+func (CEFFormatter) Format(e *Event) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("CEF:0")
+	for _, h := range []string{SIEM_VENDOR, SIEM_PRODUCT, ProductVersion, strconv.Itoa(int(EventID(e.Type))), siemName(e), strconv.Itoa(siemSeverity(e))} {
+		b.WriteByte('|')
+		b.WriteString(cefHeaderEscaper.Replace(h))
+	}
+	b.WriteByte('|')
+	for i, f := range siemFields(e, true) {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(f.key + "=" + cefExtensionEscaper.Replace(f.value))
+	}
+	return []byte(b.String()), nil
+}
+
+type LEEFFormatter struct{}
+
+// Format returns "LEEF:1.0|vendor|product|version|event id|<tab separated attributes>"
+func (LEEFFormatter) Format(e *Event) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("LEEF:1.0")
+	for _, h := range []string{SIEM_VENDOR, SIEM_PRODUCT, ProductVersion, strconv.Itoa(int(EventID(e.Type)))} {
+		b.WriteByte('|')
+		b.WriteString(leefHeaderEscaper.Replace(h))
+	}
+	b.WriteByte('|')
+	for i, f := range siemFields(e, false) {
+		if i > 0 {
+			b.WriteByte('\t')
+		}
+		b.WriteString(f.key + "=" + leefValueEscaper.Replace(f.value))
+	}
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,68 @@
+package journal
+
+import (
+	"testing"
+	"time"
+)
+
+// withIdentity replaces the local host, user and product version while fn runs
+func withIdentity(host, user, version string, fn func()) {
+	localIdentity()
+	savedHost, savedUser, savedVersion := hostName, userName, ProductVersion
+	hostName, userName, ProductVersion = host, user, version
+	defer func() {
+		hostName, userName, ProductVersion = savedHost, savedUser, savedVersion
+	}()
+	fn()
+}
+
+func siemTestEvents() []*Event {
+	at := time.Date(2026, 10, 19, 9, 30, 0, 123000000, time.FixedZone("", 3*60*60))
+	changed := NewProxyEvent(SOURCE_USER, Snapshot{Enabled: true, Server: `http=a|b\c:8080`}, &Snapshot{})
+	stopped := NewLifecycleEvent(EVENT_MONITOR_STOPPED, "remote", "by pid 42\nuser=x\\y")
+	failure := NewEvent(EVENT_INTERNAL_ERROR, SEVERITY_ERROR, "open\tkey|file\r\n")
+	for _, e := range []*Event{changed, stopped, failure} {
+		e.Time = at
+	}
+	return []*Event{changed, stopped, failure}
+}
+
+func TestCEFFormat(t *testing.T) {
+	want := []string{
+		// "|" and "\" are escaped in the header, "\" and "=" in the extension, new lines are spaces in the header
+		"CEF:0|AI-Sid|proxyMon|2.0\\|rc 1|100|proxy changed|3|rt=1792391400123 dvchost=pc|1\\\\a\\=b suser=DOMAIN\\\\user cat=proxy-changed msg=proxy on, http\\=a|b\\\\c:8080 cs1Label=proxySource cs1=HKCU cs2Label=proxyEnabled cs2=true cs3Label=proxyServer cs3=http\\=a|b\\\\c:8080 cs4Label=previousProxyEnabled cs4=false",
+		"CEF:0|AI-Sid|proxyMon|2.0\\|rc 1|201|monitor stopped|3|rt=1792391400123 dvchost=pc|1\\\\a\\=b suser=DOMAIN\\\\user cat=monitor-stopped msg=monitor stopped [remote]: by pid 42\\nuser\\=x\\\\y cs1Label=origin cs1=remote",
+		"CEF:0|AI-Sid|proxyMon|2.0\\|rc 1|900|internal error|9|rt=1792391400123 dvchost=pc|1\\\\a\\=b suser=DOMAIN\\\\user cat=internal-error msg=internal error: open\tkey|file\\r\\n",
+	}
+	withIdentity(`pc|1\a=b`, `DOMAIN\user`, "2.0|rc\n1", func() {
+		for i, e := range siemTestEvents() {
+			got, err := CEFFormatter{}.Format(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want[i] {
+				t.Errorf("%v:\n%q\nwant\n%q", e.Type, got, want[i])
+			}
+		}
+	})
+}
+
+func TestLEEFFormat(t *testing.T) {
+	want := []string{
+		// LEEF 1.0 has no escaping: "|" is a space in the header, tabs and new lines are spaces in values
+		"LEEF:1.0|AI-Sid|proxyMon|2.0 rc 1|100|devTime=2026-10-19T09:30:00.123+0300\tdevTimeFormat=yyyy-MM-dd'T'HH:mm:ss.SSSZ\tsev=3\tidentHostName=pc|1\\a=b\tusrName=DOMAIN\\user\tcat=proxy-changed\tmsg=proxy on, http=a|b\\c:8080\tproxySource=HKCU\tproxyEnabled=true\tproxyServer=http=a|b\\c:8080\tpreviousProxyEnabled=false",
+		"LEEF:1.0|AI-Sid|proxyMon|2.0 rc 1|201|devTime=2026-10-19T09:30:00.123+0300\tdevTimeFormat=yyyy-MM-dd'T'HH:mm:ss.SSSZ\tsev=3\tidentHostName=pc|1\\a=b\tusrName=DOMAIN\\user\tcat=monitor-stopped\tmsg=monitor stopped [remote]: by pid 42 user=x\\y\torigin=remote",
+		"LEEF:1.0|AI-Sid|proxyMon|2.0 rc 1|900|devTime=2026-10-19T09:30:00.123+0300\tdevTimeFormat=yyyy-MM-dd'T'HH:mm:ss.SSSZ\tsev=9\tidentHostName=pc|1\\a=b\tusrName=DOMAIN\\user\tcat=internal-error\tmsg=internal error: open key|file  ",
+	}
+	withIdentity(`pc|1\a=b`, `DOMAIN\user`, "2.0|rc\n1", func() {
+		for i, e := range siemTestEvents() {
+			got, err := LEEFFormatter{}.Format(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want[i] {
+				t.Errorf("%v:\n%q\nwant\n%q", e.Type, got, want[i])
+			}
+		}
+	})
+}
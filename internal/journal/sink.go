@@ -0,0 +1,7 @@
+package journal
+
+// Sink receives every event written by the monitor
+type Sink interface {
+	Write(e *Event) error
+	Close() error
+}
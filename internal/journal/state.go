@@ -0,0 +1,68 @@
+package journal
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// SavedState is the last observed proxy settings of a source, it is kept between
+// runs to detect changes made while the monitor was stopped
+type SavedState struct {
+	Source   string    `json:"source"`
+	Snapshot Snapshot  `json:"snapshot"`
+	Since    time.Time `json:"since"`   // when the settings were observed first
+	Checked  time.Time `json:"checked"` // the last moment the settings were known to be current
+}
+
+const STATE_STORE = "state"
+
+// ReadSavedState returns nil without error if the file does not exist
+func ReadSavedState(name string, sealer *Sealer) (*SavedState, error) {
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data, err = sealer.Open(STATE_STORE, data); err != nil {
+		return nil, err
+	}
+	res := new(SavedState)
+	if err := json.Unmarshal(data, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (v *SavedState) Write(name string, sealer *Sealer) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	if data, err = sealer.Seal(STATE_STORE, data); err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// StartEvent compares the saved state with the current settings observed at the
+// monitor start, without saved state it returns a plain proxy change record
+func (v *SavedState) StartEvent(source string, current Snapshot, now time.Time) *Event {
+	if v == nil || v.Source != source {
+		return NewProxyEvent(source, current, nil)
+	}
+	window := now.Sub(v.Checked)
+	if window < 0 {
+		window = 0
+	}
+	if v.Snapshot == current {
+		return NewUnchangedEvent(source, current, v.Since, window)
+	}
+	return NewOfflineChangeEvent(source, current, v.Snapshot, window)
+}
@@ -0,0 +1,263 @@
+package journal
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SYSLOG_FACILITY_USER   = 1
+	SYSLOG_FACILITY_LOCAL0 = 16
+
+	// IANA "example" enterprise number, replace with your own PEN in config
+	SYSLOG_ENTERPRISE_ID = 32473
+
+	syslogTimeout = 5 * time.Second
+)
+
+type SyslogOptions struct {
+	Network            string `json:"network,omitempty"` // udp (default), tcp or tls
+	Address            string `json:"address,omitempty"` // host:port
+	Facility           int    `json:"facility,omitempty"`
+	AppName            string `json:"appName,omitempty"`
+	Hostname           string `json:"hostname,omitempty"`
+	EnterpriseID       int    `json:"enterpriseId,omitempty"`
+	CAFile             string `json:"caFile,omitempty"`
+	CertFile           string `json:"certFile,omitempty"`
+	KeyFile            string `json:"keyFile,omitempty"`
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+
+	// Formatter of MSG (e.g. CEF or LEEF), nil - the event text
+	Formatter Formatter `json:"-"`
+}
+
+func (v *SyslogOptions) normalize() {
+	if v.Network == "" {
+		v.Network = "udp"
+	}
+	if v.Facility == 0 {
+		v.Facility = SYSLOG_FACILITY_USER
+	}
+	if v.AppName == "" {
+		v.AppName = EVENTLOG_SOURCE
+	}
+	if v.Hostname == "" {
+		v.Hostname, _ = os.Hostname()
+	}
+	if v.EnterpriseID == 0 {
+		v.EnterpriseID = SYSLOG_ENTERPRISE_ID
+	}
+}
+
+var syslogSeverities = map[Severity]int{
+	SEVERITY_INFO:    6,
+	SEVERITY_WARNING: 4,
+	SEVERITY_ERROR:   3,
+}
+
+// FormatSyslog returns an RFC 5424 message (without transport framing)
+func FormatSyslog(e *Event, opts SyslogOptions, procID int) []byte {
+	opts.normalize()
+	severity, ok := syslogSeverities[e.Severity]
+	if !ok {
+		severity = 5
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %v %v %v %v %v ",
+		opts.Facility*8+severity,
+		e.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(opts.Hostname, 255),
+		syslogHeaderField(opts.AppName, 48),
+		syslogHeaderField(strconv.Itoa(procID), 128),
+		syslogHeaderField(e.Type.String(), 32))
+	writeStructuredData(&b, e, opts.EnterpriseID)
+	if opts.Formatter != nil {
+		// SIEM parsers expect the format signature (CEF:, LEEF:) at the start of MSG, so there is no BOM
+		if msg, err := opts.Formatter.Format(e); err == nil {
+			b.WriteByte(' ')
+			b.Write(msg)
+			return b.Bytes()
+		}
+	}
+	if text := e.Text(); text != "" {
+		b.WriteString(" \xEF\xBB\xBF")
+		b.WriteString(text)
+	}
+	return b.Bytes()
+}
+
+// header fields are PRINTUSASCII without spaces, "-" means NILVALUE
+func syslogHeaderField(value string, maxLen int) string {
+	res := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+	if len(res) > maxLen {
+		res = res[:maxLen]
+	}
+	if res == "" {
+		return "-"
+	}
+	return res
+}
+
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+type sdParam struct {
+	name, value string
+}
+
+func writeSDElement(b *bytes.Buffer, id string, enterpriseID int, params []sdParam) {
+	fmt.Fprintf(b, "[%v@%d", id, enterpriseID)
+	for _, p := range params {
+		fmt.Fprintf(b, ` %v="%v"`, p.name, sdEscaper.Replace(p.value))
+	}
+	b.WriteByte(']')
+}
+
+func snapshotParams(s *Snapshot, source string) []sdParam {
+	res := make([]sdParam, 0, 3)
+	if source != "" {
+		res = append(res, sdParam{"source", source})
+	}
+	res = append(res, sdParam{"enabled", strconv.FormatBool(s.Enabled)})
+	res = append(res, sdParam{"server", s.Server})
+	return res
+}
+
+func writeStructuredData(b *bytes.Buffer, e *Event, enterpriseID int) {
+	params := []sdParam{
+		{"type", e.Type.String()},
+		{"severity", e.Severity.String()},
+	}
+	if e.Origin != "" {
+		params = append(params, sdParam{"origin", e.Origin})
+	}
+	writeSDElement(b, "event", enterpriseID, params)
+	if e.Snapshot != nil {
+		writeSDElement(b, "snapshot", enterpriseID, snapshotParams(e.Snapshot, e.Source))
+	}
+	if e.Previous != nil {
+		writeSDElement(b, "previous", enterpriseID, snapshotParams(e.Previous, ""))
+	}
+}
+
+// SyslogSink sends events to a syslog collector, TCP and TLS use octet-counting framing (RFC 6587, RFC 5425)
+type SyslogSink struct {
+	opts  SyslogOptions
+	tls   *tls.Config
+	mutex sync.Mutex
+	conn  net.Conn
+}
+
+func NewSyslogSink(opts SyslogOptions) (*SyslogSink, error) {
+	opts.normalize()
+	if opts.Address == "" {
+		return nil, fmt.Errorf("syslog address is not set")
+	}
+	res := &SyslogSink{opts: opts}
+	switch opts.Network {
+	case "udp", "tcp":
+	case "tls":
+		cfg, err := syslogTLSConfig(opts)
+		if err != nil {
+			return nil, err
+		}
+		res.tls = cfg
+	default:
+		return nil, fmt.Errorf("unsupported syslog network %q", opts.Network)
+	}
+	return res, nil
+}
+
+func syslogTLSConfig(opts SyslogOptions) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: opts.ServerName, InsecureSkipVerify: opts.InsecureSkipVerify}
+	if cfg.ServerName == "" {
+		if host, _, err := net.SplitHostPort(opts.Address); err == nil {
+			cfg.ServerName = host
+		}
+	}
+	if opts.CAFile != "" {
+		data, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %v", opts.CAFile)
+		}
+	}
+	if opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func (v *SyslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogTimeout}
+	if v.tls != nil {
+		return tls.DialWithDialer(dialer, "tcp", v.opts.Address, v.tls)
+	}
+	return dialer.Dial(v.opts.Network, v.opts.Address)
+}
+
+func (v *SyslogSink) frame(msg []byte) []byte {
+	if v.opts.Network == "udp" {
+		return msg
+	}
+	return append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+}
+
+func (v *SyslogSink) Write(e *Event) error {
+	data := v.frame(FormatSyslog(e, v.opts, os.Getpid()))
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	var err error
+	// the second attempt reconnects if the collector has dropped the connection.
+	// A partially written frame is not sent again: the connection with it is closed, so it
+	// can't corrupt the stream, and the collector could have received a part of it already
+	for attempt := 0; attempt < 2; attempt++ {
+		if v.conn == nil {
+			if v.conn, err = v.dial(); err != nil {
+				return err
+			}
+		}
+		v.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+		var n int
+		if n, err = v.conn.Write(data); err == nil {
+			return nil
+		}
+		v.conn.Close()
+		v.conn = nil
+		if n > 0 {
+			return fmt.Errorf("syslog message is dropped after %d of %d bytes: %w", n, len(data), err)
+		}
+	}
+	return err
+}
+
+func (v *SyslogSink) Close() error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.conn == nil {
+		return nil
+	}
+	err := v.conn.Close()
+	v.conn = nil
+	return err
+}
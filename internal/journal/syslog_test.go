@@ -0,0 +1,146 @@
+package journal
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var syslogTestTime = time.Date(2026, 10, 19, 9, 30, 0, 123456000, time.UTC)
+
+func syslogTestEvent() *Event {
+	e := NewProxyEvent(SOURCE_USER, Snapshot{Enabled: true, Server: `p"1\2]:3128`}, nil)
+	e.Time = syslogTestTime
+	return e
+}
+
+func syslogTestOptions(network, address string) SyslogOptions {
+	return SyslogOptions{Network: network, Address: address, Facility: SYSLOG_FACILITY_LOCAL0, AppName: "proxyMon", Hostname: "host 1"}
+}
+
+var syslogHeader = regexp.MustCompile(`^<(\d+)>1 (\S+) (\S+) (\S+) (\d+) (\S+) `)
+
+func checkSyslogMessage(t *testing.T, msg string) {
+	t.Helper()
+	m := syslogHeader.FindStringSubmatch(msg)
+	if m == nil {
+		t.Fatalf("invalid header: %q", msg)
+	}
+	if want := strconv.Itoa(SYSLOG_FACILITY_LOCAL0*8 + 6); m[1] != want {
+		t.Errorf("PRI %v, want %v", m[1], want)
+	}
+	if m[2] != "2026-10-19T09:30:00.123456Z" {
+		t.Errorf("TIMESTAMP %v", m[2])
+	}
+	if m[3] != "host1" || m[4] != "proxyMon" || m[6] != "proxy-changed" {
+		t.Errorf("HOSTNAME %v APP-NAME %v MSGID %v", m[3], m[4], m[6])
+	}
+	sd := `[event@32473 type="proxy-changed" severity="info"]` +
+		`[snapshot@32473 source="HKCU" enabled="true" server="p\"1\\2\]:3128"]`
+	if rest := msg[len(m[0]):]; !strings.HasPrefix(rest, sd+" \xEF\xBB\xBFproxy on, ") {
+		t.Errorf("STRUCTURED-DATA and MSG:\n%q\nwant prefix\n%q", rest, sd)
+	}
+}
+
+func TestFormatSyslogHeaderFields(t *testing.T) {
+	opts := syslogTestOptions("udp", "")
+	opts.AppName = strings.Repeat("a", 60)
+	msg := string(FormatSyslog(syslogTestEvent(), opts, 42))
+	if !strings.Contains(msg, " "+strings.Repeat("a", 48)+" 42 ") {
+		t.Errorf("APP-NAME is not truncated: %q", msg)
+	}
+	opts.Hostname = " \t"
+	if msg = string(FormatSyslog(syslogTestEvent(), opts, 42)); !strings.Contains(msg, "Z - ") {
+		t.Errorf("empty HOSTNAME is not NILVALUE: %q", msg)
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sink, err := NewSyslogSink(syslogTestOptions("udp", conn.LocalAddr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err := sink.Write(syslogTestEvent()); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// no framing over UDP, one datagram is one message
+	checkSyslogMessage(t, string(buf[:n]))
+}
+
+// readFrame reads one octet-counted frame: MSG-LEN SP SYSLOG-MSG
+func readFrame(r *bufio.Reader) (string, error) {
+	prefix, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	size, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, size)
+	_, err = io.ReadFull(r, msg)
+	return string(msg), err
+}
+
+func TestSyslogTCPFraming(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	frames := make(chan string, 4)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					msg, err := readFrame(r)
+					if err != nil {
+						return
+					}
+					frames <- msg
+				}
+			}()
+		}
+	}()
+	sink, err := NewSyslogSink(syslogTestOptions("tcp", l.Addr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	for i := 0; i < 2; i++ {
+		if err := sink.Write(syslogTestEvent()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-frames:
+			checkSyslogMessage(t, msg)
+		case <-time.After(5 * time.Second):
+			t.Fatal("frame is not received")
+		}
+	}
+}
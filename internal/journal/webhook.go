@@ -0,0 +1,271 @@
+package journal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	WEBHOOK_SIGNATURE_HEADER = "X-ProxyMon-Signature"
+	WEBHOOK_TIMESTAMP_HEADER = "X-ProxyMon-Timestamp"
+	WEBHOOK_EVENT_HEADER     = "X-ProxyMon-Event"
+	WEBHOOK_DELIVERY_HEADER  = "X-ProxyMon-Delivery"
+	WEBHOOK_STORE            = "webhook"
+
+	webhookMinBackoff = time.Second
+	webhookMaxBackoff = 10 * time.Minute
+	webhookTimeout    = 10 * time.Second
+	webhookMaxQueue   = 10000
+	webhookMaxBytes   = 64 << 20
+)
+
+type WebhookOptions struct {
+	URL        string   `json:"url,omitempty"`
+	Secret     string   `json:"secret,omitempty"`     // HMAC-SHA256 key, empty - requests are not signed
+	QueueDir   string   `json:"queueDir,omitempty"`   // pending deliveries
+	MaxRetries int      `json:"maxRetries,omitempty"` // 0 - retry until delivered
+	MinBackoff Duration `json:"minBackoff,omitempty"`
+	MaxBackoff Duration `json:"maxBackoff,omitempty"`
+	Timeout    Duration `json:"timeout,omitempty"`
+	// limits of the queue, the oldest events are dropped: 0 - 10000 events and 64 MiB, negative - no limit
+	MaxQueue     int   `json:"maxQueue,omitempty"`
+	MaxQueueSize int64 `json:"maxQueueSize,omitempty"`
+
+	// Formatter of the request body (e.g. CEF or LEEF), nil - JSON event
+	Formatter Formatter `json:"-"`
+	// OnError reports errors of the queue, nil - they are printed
+	OnError func(err error) `json:"-"`
+	// Sealer encrypts queued events, nil - they are stored as plain JSON
+	Sealer *Sealer `json:"-"`
+}
+
+// SignWebhook returns the signature header value: "sha256=" + hex(HMAC(secret, timestamp + "." + body))
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookSink stores every event in a disk queue first and posts it in
+// background, so Write never waits for the network
+type WebhookSink struct {
+	opts   WebhookOptions
+	queue  *DiskQueue
+	client *http.Client
+	signal chan struct{}
+	stop   chan struct{}
+	closed sync.Once
+	full   bool // written by Write only, it is called by one goroutine of the dispatcher
+	done   sync.WaitGroup
+	ctx    context.Context // cancelled by Close, so it does not wait for the request timeout
+	cancel context.CancelFunc
+}
+
+func NewWebhookSink(opts WebhookOptions) (*WebhookSink, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("webhook url is not set")
+	}
+	if opts.QueueDir == "" {
+		return nil, fmt.Errorf("webhook queue directory is not set")
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = Duration(webhookMinBackoff)
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = Duration(webhookMaxBackoff)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = Duration(webhookTimeout)
+	}
+	if opts.MaxQueue == 0 {
+		opts.MaxQueue = webhookMaxQueue
+	}
+	if opts.MaxQueueSize == 0 {
+		opts.MaxQueueSize = webhookMaxBytes
+	}
+	queue, err := OpenDiskQueue(opts.QueueDir, opts.MaxQueue, opts.MaxQueueSize)
+	if err != nil {
+		return nil, err
+	}
+	res := &WebhookSink{
+		opts:   opts,
+		queue:  queue,
+		client: &http.Client{Timeout: opts.Timeout.Get()},
+		signal: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+	res.ctx, res.cancel = context.WithCancel(context.Background())
+	res.done.Add(1)
+	go res.deliver()
+	return res, nil
+}
+
+func (v *WebhookSink) Write(e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if data, err = v.opts.Sealer.Seal(WEBHOOK_STORE, data); err != nil {
+		return err
+	}
+	// drops are reported once until the queue has room again, the report is an event for this sink too
+	dropped, err := v.queue.Push(data)
+	if dropped > 0 && !v.full {
+		v.queueError(fmt.Errorf("queue is full, the oldest events are dropped"))
+	}
+	v.full = dropped > 0
+	if err != nil {
+		return err
+	}
+	select {
+	case v.signal <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (v *WebhookSink) deliver() {
+	defer v.done.Done()
+	attempts := 0
+	for {
+		id, data, err := v.queue.Peek()
+		if err != nil {
+			v.queueError(err)
+			attempts++
+		} else if id == "" {
+			select {
+			case <-v.signal:
+				continue
+			case <-v.stop:
+				return
+			}
+		} else {
+			retry, err := v.post(id, data)
+			if v.ctx.Err() != nil {
+				return
+			}
+			if err == nil || !retry {
+				if err != nil {
+					fmt.Printf("Webhook delivery %v rejected: %v\n", id, err)
+					err = v.queue.Reject(id)
+				} else {
+					err = v.queue.Remove(id)
+				}
+				if err == nil {
+					attempts = 0
+					continue
+				}
+				// the item is still in the queue, it is posted again after backoff
+				v.queueError(err)
+				attempts++
+			} else {
+				attempts++
+				fmt.Printf("Webhook delivery %v failed (attempt %d): %v\n", id, attempts, err)
+				if v.opts.MaxRetries > 0 && attempts > v.opts.MaxRetries {
+					if err := v.queue.Reject(id); err == nil {
+						attempts = 0
+						continue
+					} else {
+						v.queueError(err)
+					}
+				}
+			}
+		}
+		select {
+		case <-time.After(v.backoff(attempts)):
+		case <-v.stop:
+			return
+		}
+	}
+}
+
+func (v *WebhookSink) queueError(err error) {
+	err = fmt.Errorf("webhook queue: %w", err)
+	if v.opts.OnError != nil {
+		v.opts.OnError(err)
+	} else {
+		fmt.Printf("%v\n", err)
+	}
+}
+
+func (v *WebhookSink) backoff(attempts int) time.Duration {
+	d := v.opts.MinBackoff.Get()
+	for i := 1; i < attempts && d < v.opts.MaxBackoff.Get(); i++ {
+		d *= 2
+	}
+	if d > v.opts.MaxBackoff.Get() {
+		d = v.opts.MaxBackoff.Get()
+	}
+	// up to 20% of jitter, so many agents do not retry at the same moment
+	return d + time.Duration(rand.Int63n(int64(d)/5+1))
+}
+
+// post returns retry = false when the error is permanent (client errors except 408 and 429).
+// The queue keeps JSON events, other formats are applied on delivery
+func (v *WebhookSink) post(id string, data []byte) (retry bool, err error) {
+	if data, err = v.opts.Sealer.Open(WEBHOOK_STORE, data); err != nil {
+		return false, err
+	}
+	var e Event
+	if err := json.Unmarshal(data, &e); err != nil {
+		return false, err
+	}
+	body, contentType := data, "application/json"
+	if v.opts.Formatter != nil {
+		if body, err = v.opts.Formatter.Format(&e); err != nil {
+			return false, err
+		}
+		if _, ok := v.opts.Formatter.(JSONFormatter); !ok {
+			contentType = "text/plain; charset=utf-8"
+		}
+	}
+	req, err := http.NewRequestWithContext(v.ctx, http.MethodPost, v.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(WEBHOOK_DELIVERY_HEADER, strings.TrimSuffix(id, queueFileExt))
+	req.Header.Set(WEBHOOK_TIMESTAMP_HEADER, timestamp)
+	req.Header.Set(WEBHOOK_EVENT_HEADER, e.Type.String())
+	if v.opts.Secret != "" {
+		req.Header.Set(WEBHOOK_SIGNATURE_HEADER, SignWebhook(v.opts.Secret, timestamp, body))
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook response: %v", resp.Status)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return false, err
+	}
+	return true, err
+}
+
+// Close stops delivery, undelivered events stay in the queue until the next start
+func (v *WebhookSink) Close() error {
+	v.closed.Do(func() {
+		close(v.stop)
+		v.cancel()
+	})
+	v.done.Wait()
+	return nil
+}
@@ -0,0 +1,258 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type webhookDelivery struct {
+	id, signature, timestamp, event string
+	body                            []byte
+}
+
+// startReceiver answers with statuses in order, the last one is repeated
+func startReceiver(t *testing.T, statuses ...int) (*httptest.Server, chan webhookDelivery) {
+	deliveries := make(chan webhookDelivery, 100)
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- webhookDelivery{r.Header.Get(WEBHOOK_DELIVERY_HEADER), r.Header.Get(WEBHOOK_SIGNATURE_HEADER),
+			r.Header.Get(WEBHOOK_TIMESTAMP_HEADER), r.Header.Get(WEBHOOK_EVENT_HEADER), body}
+		mutex.Lock()
+		status := statuses[0]
+		if len(statuses) > 1 {
+			statuses = statuses[1:]
+		}
+		mutex.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, deliveries
+}
+
+func receive(t *testing.T, deliveries chan webhookDelivery) webhookDelivery {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("event is not delivered")
+	}
+	return webhookDelivery{}
+}
+
+func fastWebhook(url, dir string) WebhookOptions {
+	return WebhookOptions{URL: url, QueueDir: dir, MinBackoff: Duration(10 * time.Millisecond), MaxBackoff: Duration(20 * time.Millisecond)}
+}
+
+// waitQueue waits until the queue has n messages
+func waitQueue(t *testing.T, q *DiskQueue, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); q.Len() != n; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue length %d, want %d", q.Len(), n)
+		}
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	server, deliveries := startReceiver(t, 500, 503, 200)
+	opts := fastWebhook(server.URL, t.TempDir())
+	opts.Secret = "secret"
+	sink, err := NewWebhookSink(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	e := NewProxyEvent(SOURCE_USER, Snapshot{Enabled: true, Server: "p:3128"}, nil)
+	if err := sink.Write(e); err != nil {
+		t.Fatal(err)
+	}
+	// 5xx is retried with the same delivery id
+	var first webhookDelivery
+	for i := 0; i < 3; i++ {
+		d := receive(t, deliveries)
+		if i == 0 {
+			first = d
+		}
+		if d.id != first.id || d.event != "proxy-changed" {
+			t.Errorf("attempt %d: delivery %v event %v, want %v proxy-changed", i, d.id, d.event, first.id)
+		}
+		if want := SignWebhook("secret", d.timestamp, d.body); d.signature != want {
+			t.Errorf("attempt %d: signature %q, want %q", i, d.signature, want)
+		}
+		var got Event
+		if err := json.Unmarshal(d.body, &got); err != nil || got.Snapshot == nil || *got.Snapshot != *e.Snapshot {
+			t.Errorf("attempt %d: body %s: %v", i, d.body, err)
+		}
+	}
+	waitQueue(t, sink.queue, 0)
+	select {
+	case d := <-deliveries:
+		t.Errorf("delivered event is sent again: %v", d.id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWebhookReject(t *testing.T) {
+	server, deliveries := startReceiver(t, 400, 200)
+	dir := t.TempDir()
+	sink, err := NewWebhookSink(fastWebhook(server.URL, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	for _, message := range []string{"rejected", "delivered"} {
+		if err := sink.Write(NewEvent(EVENT_MONITOR_STARTED, SEVERITY_INFO, message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 4xx is not retried, the next event is delivered
+	rejected, delivered := receive(t, deliveries), receive(t, deliveries)
+	if !strings.Contains(string(rejected.body), `"rejected"`) || !strings.Contains(string(delivered.body), `"delivered"`) {
+		t.Errorf("deliveries %s, %s", rejected.body, delivered.body)
+	}
+	waitQueue(t, sink.queue, 0)
+	if failed, _ := filepath.Glob(filepath.Join(dir, "*.failed")); len(failed) != 1 || filepath.Base(failed[0]) != rejected.id+".failed" {
+		t.Errorf("rejected event is not kept: %v", failed)
+	}
+}
+
+func TestWebhookReopen(t *testing.T) {
+	unavailable, _ := startReceiver(t, 503)
+	dir := t.TempDir()
+	sink, err := NewWebhookSink(fastWebhook(unavailable.URL, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := sink.Write(NewEvent(EVENT_MONITOR_STARTED, SEVERITY_INFO, fmt.Sprint("event ", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink.Close()
+	sink.Close() // Close is idempotent
+
+	// the queue of the previous run is delivered in order after restart
+	server, deliveries := startReceiver(t, 200)
+	if sink, err = NewWebhookSink(fastWebhook(server.URL, dir)); err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	for i := 1; i <= 3; i++ {
+		if d := receive(t, deliveries); !strings.Contains(string(d.body), fmt.Sprintf(`"event %d"`, i)) {
+			t.Errorf("delivery %d: %s", i, d.body)
+		}
+	}
+	waitQueue(t, sink.queue, 0)
+}
+
+func TestWebhookQueueFull(t *testing.T) {
+	unavailable, _ := startReceiver(t, 503)
+	opts := fastWebhook(unavailable.URL, t.TempDir())
+	opts.MaxQueue = 2
+	var errs []error
+	opts.OnError = func(err error) { errs = append(errs, err) }
+	sink, err := NewWebhookSink(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	for i := 0; i < 5; i++ {
+		if err := sink.Write(NewEvent(EVENT_MONITOR_STARTED, SEVERITY_INFO, "")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the error is an event for the sink itself, so it is reported once
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "oldest events are dropped") || sink.queue.Len() != 2 {
+		t.Errorf("errors %v, queue length %d", errs, sink.queue.Len())
+	}
+}
+
+func TestDiskQueueLimits(t *testing.T) {
+	q, err := OpenDiskQueue(t.TempDir(), 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		dropped, err := q.Push([]byte(fmt.Sprint(i)))
+		want := 0
+		if i > 3 {
+			want = 1
+		}
+		if err != nil || dropped != want {
+			t.Errorf("push %d: dropped %d, want %d: %v", i, dropped, want, err)
+		}
+	}
+	if _, data, err := q.Peek(); err != nil || string(data) != "3" || q.Len() != 3 {
+		t.Errorf("oldest message %q of %d, want 3 of 3: %v", data, q.Len(), err)
+	}
+
+	q, err = OpenDiskQueue(t.TempDir(), 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []string{"1234", "5678", "90ab", "cdefghijklmn"} {
+		if _, err := q.Push([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the newest message is kept even if it exceeds the limit alone
+	id, data, err := q.Peek()
+	if err != nil || string(data) != "cdefghijklmn" || q.Len() != 1 {
+		t.Errorf("queue %q of %d: %v", data, q.Len(), err)
+	}
+	if err := q.Remove(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Remove(id); err != nil {
+		t.Errorf("remove of a dropped message: %v", err)
+	}
+	if entries, _ := os.ReadDir(q.dir); len(entries) != 0 {
+		t.Errorf("files are left: %v", entries)
+	}
+}
+
+func TestWebhookCloseCancelsRequest(t *testing.T) {
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	sink, err := NewWebhookSink(WebhookOptions{URL: server.URL, QueueDir: t.TempDir(), Timeout: Duration(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(NewEvent(EVENT_MONITOR_STARTED, SEVERITY_INFO, "")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request is not sent")
+	}
+	start := time.Now()
+	sink.Close()
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Close waited for the request %v", d)
+	}
+	// the event is not delivered, so it stays in the queue for the next start
+	if n := sink.queue.Len(); n != 1 {
+		t.Errorf("queue length %d, want 1", n)
+	}
+}
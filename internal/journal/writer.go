@@ -0,0 +1,36 @@
+package journal
+
+import (
+	"io"
+	"sync"
+)
+
+// WriterSink writes formatted events as lines, it is used for log files and console
+type WriterSink struct {
+	mutex     sync.Mutex
+	writer    io.Writer
+	formatter Formatter
+}
+
+func NewWriterSink(writer io.Writer, formatter Formatter) *WriterSink {
+	return &WriterSink{writer: writer, formatter: formatter}
+}
+
+func (v *WriterSink) Write(e *Event) error {
+	data, err := v.formatter.Format(e)
+	if err != nil {
+		return err
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	_, err = v.writer.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the underlying writer if it is an io.Closer
+func (v *WriterSink) Close() error {
+	if c, ok := v.writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
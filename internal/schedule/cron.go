@@ -0,0 +1,123 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field bounds of cron expression: minute hour day-of-month month day-of-week
+var cronFields = []struct {
+	name     string
+	min, max int
+	names    []string
+}{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{"day of week", 0, 7, dayNames},
+}
+
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Cron is a parsed 5-field cron expression, fields contain lists, ranges, steps and names:
+// "0 9 * * mon-fri", "*/15 8-18 * * 1-5", "0 0 1 jan,jul *"
+type Cron struct {
+	fields [5]uint64 // bit sets of allowed values
+	anyDay bool      // day of month starts with "*"
+	anyDow bool      // day of week starts with "*"
+}
+
+func ParseCron(text string) (*Cron, error) {
+	parts := strings.Fields(text)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron %q: %d fields expected", text, len(cronFields))
+	}
+	// as in Vixie cron a day field starting with "*" ("*/2" too) makes both days required instead of either
+	c := &Cron{anyDay: strings.HasPrefix(parts[2], "*"), anyDow: strings.HasPrefix(parts[4], "*")}
+	for i, part := range parts {
+		bits, err := parseField(part, i)
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %v", text, err)
+		}
+		c.fields[i] = bits
+	}
+	// 7 is Sunday too
+	if c.fields[4]&(1<<7) != 0 {
+		c.fields[4] |= 1
+	}
+	return c, nil
+}
+
+func parseField(text string, index int) (uint64, error) {
+	f := cronFields[index]
+	var bits uint64
+	for _, item := range strings.Split(text, ",") {
+		step := 1
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			s, err := strconv.Atoi(item[i+1:])
+			if err != nil || s < 1 {
+				return 0, fmt.Errorf("invalid step of %v %q", f.name, item)
+			}
+			item, step = item[:i], s
+		}
+		lo, hi := f.min, f.max
+		if item != "*" {
+			var err error
+			bounds := strings.SplitN(item, "-", 2)
+			if lo, err = parseValue(bounds[0], index); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = parseValue(bounds[1], index); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = f.max // "5/10" means from 5 to the end
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range of %v %q", f.name, item)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(text string, index int) (int, error) {
+	f := cronFields[index]
+	for i, name := range f.names {
+		if strings.EqualFold(text, name) {
+			if index == 3 {
+				return i + 1, nil // months start from 1
+			}
+			return i, nil
+		}
+	}
+	v, err := strconv.Atoi(text)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %v %q", f.name, text)
+	}
+	return v, nil
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<v) != 0
+}
+
+// Matches checks the minute of t, if neither day field starts with "*" either of them matches (as in cron)
+func (v *Cron) Matches(t time.Time) bool {
+	if !has(v.fields[0], t.Minute()) || !has(v.fields[1], t.Hour()) || !has(v.fields[3], int(t.Month())) {
+		return false
+	}
+	day, dow := has(v.fields[2], t.Day()), has(v.fields[4], int(t.Weekday()))
+	if v.anyDay || v.anyDow {
+		return day && dow
+	}
+	return day || dow
+}
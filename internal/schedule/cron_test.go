@@ -0,0 +1,116 @@
+package schedule
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// values lists the allowed values of a field
+func values(bits uint64) []int {
+	var res []int
+	for v := 0; v < 64; v++ {
+		if has(bits, v) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		text   string
+		field  int
+		values string
+	}{
+		{"* * * * *", 1, "[0 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20 21 22 23]"},
+		{"*/15 * * * *", 0, "[0 15 30 45]"},
+		{"5/20 * * * *", 0, "[5 25 45]"},
+		{"10-20/5 * * * *", 0, "[10 15 20]"},
+		{"1,3,5-7 * * * *", 0, "[1 3 5 6 7]"},
+		{"0 8-18 * * *", 1, "[8 9 10 11 12 13 14 15 16 17 18]"},
+		{"0 0 */10 * *", 2, "[1 11 21 31]"},
+		{"0 0 1 jan,JUL *", 3, "[1 7]"},
+		{"0 0 1 mar-may *", 3, "[3 4 5]"},
+		{"0 0 * * mon-fri", 4, "[1 2 3 4 5]"},
+		{"0 0 * * sat,Sun", 4, "[0 6]"},
+		{"0 0 * * 7", 4, "[0 7]"},
+		{"0 0 * * 5-7", 4, "[0 5 6 7]"},
+		{"  0   0 * *  *  ", 0, "[0]"},
+	}
+	for _, test := range tests {
+		c, err := ParseCron(test.text)
+		if err != nil {
+			t.Errorf("%q: %v", test.text, err)
+			continue
+		}
+		if got := fmt.Sprint(values(c.fields[test.field])); got != test.values {
+			t.Errorf("%q: %v %v, want %v", test.text, cronFields[test.field].name, got, test.values)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"* * * * -1",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"20-10 * * * *",
+		"1-2-3 * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		"* * * mon *",
+		"* * * * jan",
+	} {
+		if _, err := ParseCron(text); err == nil {
+			t.Errorf("%q: no error", text)
+		}
+	}
+}
+
+func TestCronMatches(t *testing.T) {
+	// 2026-10-01 is Thursday, 2026-10-04 is Sunday
+	tests := []struct {
+		text  string
+		match []time.Time
+		miss  []time.Time
+	}{
+		{"*/15 8-18 * * 1-5", []time.Time{at(19, 8, 0), at(19, 18, 45), at(23, 12, 30)}, []time.Time{at(19, 7, 45), at(19, 19, 0), at(19, 8, 10), at(24, 8, 0)}},
+		{"0 0 * * 7", []time.Time{at(4, 0, 0)}, []time.Time{at(3, 0, 0), at(5, 0, 0)}},
+		{"0 0 * * 0", []time.Time{at(4, 0, 0)}, []time.Time{at(19, 0, 0)}},
+		{"0 0 1 oct *", []time.Time{at(1, 0, 0)}, []time.Time{at(2, 0, 0), time.Date(2026, 11, 1, 0, 0, 0, 0, time.Local)}},
+		// both days are restricted: either of them matches
+		{"0 12 1 * mon", []time.Time{at(1, 12, 0), at(19, 12, 0)}, []time.Time{at(2, 12, 0), at(20, 12, 0)}},
+		{"0 12 1,15 * sun", []time.Time{at(1, 12, 0), at(4, 12, 0), at(15, 12, 0)}, []time.Time{at(3, 12, 0)}},
+		// a day field starting with "*" makes both days required
+		{"0 12 */2 * mon", []time.Time{at(19, 12, 0)}, []time.Time{at(1, 12, 0), at(3, 12, 0)}},
+		{"0 12 1 * */2", []time.Time{at(1, 12, 0)}, []time.Time{at(4, 12, 0), time.Date(2026, 7, 1, 12, 0, 0, 0, time.Local)}},
+		{"0 12 */2 * */2", []time.Time{at(1, 12, 0), at(3, 12, 0)}, []time.Time{at(2, 12, 0), at(20, 12, 0)}},
+	}
+	for _, test := range tests {
+		c, err := ParseCron(test.text)
+		if err != nil {
+			t.Errorf("%q: %v", test.text, err)
+			continue
+		}
+		for _, m := range test.match {
+			if !c.Matches(m) {
+				t.Errorf("%q doesn't match %v", test.text, m.Format(time.RFC1123))
+			}
+		}
+		for _, m := range test.miss {
+			if c.Matches(m) {
+				t.Errorf("%q matches %v", test.text, m.Format(time.RFC1123))
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	ACTION_START = "start"
+	ACTION_STOP  = "stop"
+)
+
+const TIME_OF_DAY_FORMAT = "15:04"
+
+// RuleConfig is a rule of config, either Cron or the window From-To on Days is set.
+// Action is issued by cron or at the start of the window and the opposite one at the end
+type RuleConfig struct {
+	Name   string `json:"name"`
+	Action string `json:"action,omitempty"` // start (default) or stop
+	Cron   string `json:"cron,omitempty"`   // "0 9 * * mon-fri"
+	Days   string `json:"days,omitempty"`   // days of week of window start: "mon-fri", "sat,sun", default every day
+	From   string `json:"from,omitempty"`   // "09:00"
+	To     string `json:"to,omitempty"`     // "18:00", next day if it is not after From
+}
+
+type Rule struct {
+	RuleConfig
+	start    bool
+	cron     *Cron
+	days     uint64
+	from, to int // minutes of day
+}
+
+// Transition is the action of the rule at the time
+type Transition struct {
+	Time  time.Time
+	Start bool
+	Rule  *Rule
+}
+
+func (v *Transition) Action() string {
+	if v.Start {
+		return ACTION_START
+	}
+	return ACTION_STOP
+}
+
+// Schedule is a list of rules, the last one wins if several rules fire at the same minute
+type Schedule []*Rule
+
+func Compile(rules []RuleConfig) (Schedule, error) {
+	s := make(Schedule, 0, len(rules))
+	for i, cfg := range rules {
+		r, err := compileRule(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("schedule rule %d %q: %w", i+1, cfg.Name, err)
+		}
+		s = append(s, r)
+	}
+	return s, nil
+}
+
+func compileRule(cfg RuleConfig) (*Rule, error) {
+	r := &Rule{RuleConfig: cfg}
+	switch cfg.Action {
+	case "", ACTION_START:
+		r.start = true
+	case ACTION_STOP:
+	default:
+		return nil, fmt.Errorf("unknown action %q", cfg.Action)
+	}
+	if cfg.Cron != "" {
+		if cfg.Days != "" || cfg.From != "" || cfg.To != "" {
+			return nil, fmt.Errorf("cron can't be used with days, from and to")
+		}
+		c, err := ParseCron(cfg.Cron)
+		if err != nil {
+			return nil, err
+		}
+		r.cron = c
+		return r, nil
+	}
+	var err error
+	if r.from, err = parseTimeOfDay(cfg.From); err != nil {
+		return nil, err
+	}
+	if r.to, err = parseTimeOfDay(cfg.To); err != nil {
+		return nil, err
+	}
+	if r.from == r.to {
+		return nil, fmt.Errorf("empty window %v-%v", cfg.From, cfg.To)
+	}
+	days := cfg.Days
+	if days == "" {
+		days = "*"
+	}
+	if r.days, err = parseField(days, 4); err != nil {
+		return nil, err
+	}
+	if has(r.days, 7) {
+		r.days |= 1
+	}
+	return r, nil
+}
+
+func parseTimeOfDay(text string) (int, error) {
+	if text == "" {
+		return 0, fmt.Errorf("cron or from and to are required")
+	}
+	t, err := time.Parse(TIME_OF_DAY_FORMAT, text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, hh:mm expected", text)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// String describes the rule for the log
+func (v *Rule) String() string {
+	name := v.Name
+	if name == "" {
+		name = "unnamed"
+	}
+	if v.cron != nil {
+		return fmt.Sprintf("%q (cron %v)", name, v.Cron)
+	}
+	days := v.Days
+	if days == "" {
+		days = "daily"
+	}
+	return fmt.Sprintf("%q (%v %v-%v)", name, days, v.From, v.To)
+}
+
+// fires returns the action of the rule at the minute of t
+func (v *Rule) fires(t time.Time) (start, ok bool) {
+	if v.cron != nil {
+		return v.start, v.cron.Matches(t)
+	}
+	minute := t.Hour()*60 + t.Minute()
+	weekday := int(t.Weekday())
+	if minute == v.from && has(v.days, weekday) {
+		return v.start, true
+	}
+	if minute == v.to {
+		if v.to < v.from { // the window has started the day before
+			weekday = (weekday + 6) % 7
+		}
+		if has(v.days, weekday) {
+			return !v.start, true
+		}
+	}
+	return false, false
+}
+
+// Fired returns the transition at the minute of t, nil if no rule fires
+func (v Schedule) Fired(t time.Time) *Transition {
+	t = t.Truncate(time.Minute)
+	var res *Transition
+	for _, r := range v {
+		if start, ok := r.fires(t); ok {
+			res = &Transition{Time: t, Start: start, Rule: r}
+		}
+	}
+	return res
+}
+
+// Last returns the latest transition at or before t, rules are checked up to period back
+func (v Schedule) Last(t time.Time, period time.Duration) *Transition {
+	if len(v) == 0 {
+		return nil
+	}
+	t = t.Truncate(time.Minute)
+	for end := t.Add(-period); !t.Before(end); t = t.Add(-time.Minute) {
+		if tr := v.Fired(t); tr != nil {
+			return tr
+		}
+	}
+	return nil
+}
+
+// Next returns the first transition after t, rules are checked up to period ahead
+func (v Schedule) Next(t time.Time, period time.Duration) *Transition {
+	if len(v) == 0 {
+		return nil
+	}
+	t = t.Truncate(time.Minute)
+	for end := t.Add(period); t.Before(end); {
+		t = t.Add(time.Minute)
+		if tr := v.Fired(t); tr != nil {
+			return tr
+		}
+	}
+	return nil
+}
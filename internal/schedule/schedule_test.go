@@ -0,0 +1,132 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// 2026-10-19 is Monday
+func at(day, hour, minute int) time.Time {
+	return time.Date(2026, 10, day, hour, minute, 0, 0, time.Local)
+}
+
+// describe is a short form of a transition for comparison
+func describe(tr *Transition) string {
+	if tr == nil {
+		return "none"
+	}
+	return tr.Time.Format("Mon 02 15:04") + " " + tr.Action() + " " + tr.Rule.Name
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		rule RuleConfig
+		err  string
+	}{
+		{RuleConfig{Name: "a", Action: "pause", Cron: "* * * * *"}, `unknown action "pause"`},
+		{RuleConfig{Name: "a", Cron: "* * * * *", Days: "mon"}, "cron can't be used"},
+		{RuleConfig{Name: "a", Cron: "* * * * *", From: "09:00", To: "10:00"}, "cron can't be used"},
+		{RuleConfig{Name: "a", Cron: "* * *"}, "5 fields expected"},
+		{RuleConfig{Name: "a"}, "cron or from and to are required"},
+		{RuleConfig{Name: "a", From: "09:00"}, "cron or from and to are required"},
+		{RuleConfig{Name: "a", From: "9am", To: "10:00"}, `invalid time of day "9am"`},
+		{RuleConfig{Name: "a", From: "09:00", To: "24:00"}, `invalid time of day "24:00"`},
+		{RuleConfig{Name: "a", From: "09:00", To: "09:00"}, "empty window"},
+		{RuleConfig{Name: "a", Days: "mon-xyz", From: "09:00", To: "10:00"}, `invalid day of week "xyz"`},
+	}
+	for _, test := range tests {
+		_, err := Compile([]RuleConfig{{Name: "ok", Cron: "0 9 * * *"}, test.rule})
+		if err == nil || !strings.Contains(err.Error(), test.err) || !strings.HasPrefix(err.Error(), `schedule rule 2 "a": `) {
+			t.Errorf("%+v: error %v, want %q", test.rule, err, test.err)
+		}
+	}
+}
+
+func TestRuleString(t *testing.T) {
+	s, err := Compile([]RuleConfig{
+		{Name: "business-hours", Days: "mon-fri", From: "09:00", To: "18:00"},
+		{Cron: "0 0 1 * *", Action: ACTION_STOP},
+		{Name: "night", From: "22:00", To: "06:00"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`"business-hours" (mon-fri 09:00-18:00)`, `"unnamed" (cron 0 0 1 * *)`, `"night" (daily 22:00-06:00)`}
+	for i, r := range s {
+		if r.String() != want[i] {
+			t.Errorf("rule %d: %v, want %v", i+1, r, want[i])
+		}
+	}
+}
+
+func TestFired(t *testing.T) {
+	s, err := Compile([]RuleConfig{
+		{Name: "business-hours", Days: "mon-fri", From: "09:00", To: "18:00"},
+		// the window crosses midnight, it ends on Saturday
+		{Name: "friday-night", Action: ACTION_STOP, Days: "fri", From: "22:00", To: "06:00"},
+		{Name: "sunday", Days: "7", From: "23:30", To: "00:30"},
+		{Name: "monday-audit", Action: ACTION_STOP, Cron: "0 9 * * mon"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		time time.Time
+		want string
+	}{
+		{at(19, 9, 0), "Mon 19 09:00 stop monday-audit"}, // the last rule wins
+		{at(20, 9, 0), "Tue 20 09:00 start business-hours"},
+		{at(20, 9, 0).Add(59 * time.Second), "Tue 20 09:00 start business-hours"},
+		{at(20, 9, 1), "none"},
+		{at(20, 18, 0), "Tue 20 18:00 stop business-hours"},
+		{at(24, 9, 0), "none"},
+		{at(23, 22, 0), "Fri 23 22:00 stop friday-night"},
+		{at(24, 6, 0), "Sat 24 06:00 start friday-night"},
+		{at(23, 6, 0), "none"}, // Thursday night is not in the days
+		{at(25, 6, 0), "none"},
+		{at(25, 23, 30), "Sun 25 23:30 start sunday"},
+		{at(26, 0, 30), "Mon 26 00:30 stop sunday"},
+		{at(19, 0, 30), "Mon 19 00:30 stop sunday"},
+		{at(20, 0, 30), "none"},
+	}
+	for _, test := range tests {
+		if got := describe(s.Fired(test.time)); got != test.want {
+			t.Errorf("%v: %v, want %v", test.time.Format(time.RFC1123), got, test.want)
+		}
+	}
+}
+
+func TestLastNext(t *testing.T) {
+	s, err := Compile([]RuleConfig{{Name: "business-hours", Days: "mon-fri", From: "09:00", To: "18:00"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	week := 7 * 24 * time.Hour
+	tests := []struct {
+		time       time.Time
+		period     time.Duration
+		last, next string
+	}{
+		{at(24, 10, 0), week, "Fri 23 18:00 stop business-hours", "Mon 26 09:00 start business-hours"},
+		{at(24, 10, 0), time.Hour, "none", "none"},
+		{at(19, 9, 0).Add(30 * time.Second), week, "Mon 19 09:00 start business-hours", "Mon 19 18:00 stop business-hours"},
+		{at(19, 8, 59), week, "Fri 16 18:00 stop business-hours", "Mon 19 09:00 start business-hours"},
+		{at(19, 17, 0), time.Hour, "none", "Mon 19 18:00 stop business-hours"},
+		{at(19, 17, 0), time.Hour - time.Minute, "none", "none"},
+	}
+	for _, test := range tests {
+		if got := describe(s.Last(test.time, test.period)); got != test.last {
+			t.Errorf("last %v: %v, want %v", test.time.Format(time.RFC1123), got, test.last)
+		}
+		if got := describe(s.Next(test.time, test.period)); got != test.next {
+			t.Errorf("next %v: %v, want %v", test.time.Format(time.RFC1123), got, test.next)
+		}
+	}
+	if tr := (Schedule{}).Last(at(19, 9, 0), week); tr != nil {
+		t.Errorf("empty schedule: %v", describe(tr))
+	}
+	if tr := (Schedule{}).Next(at(19, 9, 0), week); tr != nil {
+		t.Errorf("empty schedule: %v", describe(tr))
+	}
+}
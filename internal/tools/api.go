@@ -0,0 +1,242 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"AI-Sid/monitor/internal/control"
+	"AI-Sid/monitor/internal/journal"
+)
+
+const (
+	API_PREFIX        = "/api/v1"
+	TOKEN_FILE_NAME   = "appname.token"
+	API_HISTORY_LIMIT = 1000 // default limit of GET history
+	apiMaxBody        = 64 * 1024
+)
+
+type APIConfig struct {
+	Address   string `json:"address,omitempty"`   // loopback host:port, e.g. 127.0.0.1:9465; empty - disabled
+	TokenFile string `json:"tokenFile,omitempty"` // default %APPDATA%/appname/appname.token, created on first start
+}
+
+var apiServer *http.Server
+
+func apiTokenPath() string {
+	if p := GetConfig().API.TokenFile; p != "" {
+		return p
+	}
+	return filepath.Join(AppDataDir(), TOKEN_FILE_NAME)
+}
+
+// loadAPIToken reads the bearer token, a missing file is created with a random token
+func loadAPIToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("token file %v is empty", path)
+		}
+		return token, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, fs.ErrExist) {
+		return loadAPIToken(path)
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(token); err != nil {
+		f.Close()
+		return "", err
+	}
+	return token, f.Close()
+}
+
+// startAPIServer starts the REST API if it is configured, it shares actions with the control channel
+func startAPIServer() {
+	address := GetConfig().API.Address
+	if address == "" {
+		return
+	}
+	if err := checkLoopback(address); err != nil {
+		InternalError(fmt.Errorf("api: %w", err))
+		return
+	}
+	token, err := loadAPIToken(apiTokenPath())
+	if err != nil {
+		InternalError(fmt.Errorf("api token: %w", err))
+		return
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		InternalError(fmt.Errorf("api: %w", err))
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+API_PREFIX+"/health", apiHealth)
+	mux.HandleFunc("GET "+API_PREFIX+"/snapshot", apiSnapshot)
+	mux.HandleFunc("GET "+API_PREFIX+"/history", apiHistory)
+	for _, action := range []Action{ACTION_START, ACTION_STOP, ACTION_PAUSE, ACTION_SNAPSHOT} {
+		mux.HandleFunc("POST "+API_PREFIX+"/"+actionCommands[action], apiAction(action))
+	}
+	s := &http.Server{Handler: apiAuth(token, mux), ReadHeaderTimeout: 5 * time.Second}
+	controlMutex.Lock()
+	apiServer = s
+	controlMutex.Unlock()
+	go func() {
+		if err := s.Serve(listener); err != nil && err != http.ErrServerClosed {
+			InternalError(fmt.Errorf("api: %w", err))
+		}
+	}()
+}
+
+func stopAPIServer() {
+	controlMutex.Lock()
+	s := apiServer
+	apiServer = nil
+	controlMutex.Unlock()
+	if s == nil {
+		return
+	}
+	ctx, done := context.WithTimeout(context.Background(), time.Second)
+	defer done()
+	s.Shutdown(ctx)
+}
+
+// apiAuth checks the bearer token; Host must be loopback too, so web pages
+// can't reach the API by DNS rebinding
+func apiAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			apiError(w, http.StatusForbidden, &control.Error{Code: control.ERROR_REJECTED, Message: "host is not allowed"})
+			return
+		}
+		auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="proxyMon"`)
+			apiError(w, http.StatusUnauthorized, &control.Error{Code: control.ERROR_REJECTED, Message: "invalid token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func apiJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+var apiErrorStatus = map[string]int{
+	control.ERROR_BAD_REQUEST: http.StatusBadRequest,
+	control.ERROR_REJECTED:    http.StatusConflict,
+}
+
+func apiError(w http.ResponseWriter, status int, err *control.Error) {
+	if status == 0 {
+		if status = apiErrorStatus[err.Code]; status == 0 {
+			status = http.StatusInternalServerError
+		}
+	}
+	apiJSON(w, status, struct {
+		Error *control.Error `json:"error"`
+	}{err})
+}
+
+func apiHealth(w http.ResponseWriter, r *http.Request) {
+	res := struct {
+		Status      string               `json:"status"`
+		Monitoring  bool                 `json:"monitoring"`
+		Pause       *control.PauseStatus `json:"pause,omitempty"`
+		NormalState bool                 `json:"normalState"`
+	}{"ok", GetLoggingEnabled(), currentPause(), IsNormalState()}
+	status := http.StatusOK
+	if !res.NormalState {
+		res.Status, status = "degraded", http.StatusServiceUnavailable
+	}
+	apiJSON(w, status, &res)
+}
+
+func apiSnapshot(w http.ResponseWriter, r *http.Request) {
+	s := currentStatus()
+	apiJSON(w, http.StatusOK, struct {
+		Monitoring bool                   `json:"monitoring"`
+		Sources    []control.SourceStatus `json:"sources"`
+	}{s.Monitoring, s.Sources})
+}
+
+// apiHistory accepts since, until (formats of -since), source and limit
+func apiHistory(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := journal.HistoryQuery{Source: params.Get("source"), Limit: API_HISTORY_LIMIT}
+	var err error
+	if q.Since, err = ParseTimeArg(params.Get("since")); err == nil {
+		q.Until, err = ParseTimeArg(params.Get("until"))
+	}
+	if limit := params.Get("limit"); err == nil && limit != "" {
+		q.Limit, err = strconv.Atoi(limit)
+	}
+	if err != nil {
+		apiError(w, 0, &control.Error{Code: control.ERROR_BAD_REQUEST, Message: err.Error()})
+		return
+	}
+	h, err := openHistory(true)
+	if err != nil {
+		apiError(w, 0, &control.Error{Code: control.ERROR_FAILED, Message: err.Error()})
+		return
+	}
+	defer h.Close()
+	events, err := h.Query(q)
+	if err != nil {
+		apiError(w, 0, &control.Error{Code: control.ERROR_FAILED, Message: err.Error()})
+		return
+	}
+	apiJSON(w, http.StatusOK, events)
+}
+
+// apiAction reads optional JSON arguments ({"duration": "30m", "reason": "...", "requester": "..."})
+func apiAction(action Action) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var args control.ActionArgs
+		if err := json.NewDecoder(io.LimitReader(r.Body, apiMaxBody)).Decode(&args); err != nil && err != io.EOF {
+			apiError(w, 0, &control.Error{Code: control.ERROR_BAD_REQUEST, Message: err.Error()})
+			return
+		}
+		res, err := executeAction(action, ORIGIN_API, args)
+		if err != nil {
+			apiError(w, 0, actionError(err).Error)
+			return
+		}
+		apiJSON(w, http.StatusOK, res)
+	}
+}
@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"AI-Sid/monitor/internal/control"
+	"AI-Sid/monitor/internal/journal"
+)
+
+// ControlConfig restricts actions of the control channel, empty lists allow everybody.
+// Named events can't tell their sender, so they are not created if a list is set.
+// The lists are not applied to the REST API (it has the token) and to the schedule of config
+type ControlConfig struct {
+	AllowUsers  []string `json:"allowUsers,omitempty"`  // SID or DOMAIN\user (uid or name on Linux)
+	AllowImages []string `json:"allowImages,omitempty"` // full paths of executables
+}
+
+func (v *ControlConfig) restricted() bool {
+	return len(v.AllowUsers) > 0 || len(v.AllowImages) > 0
+}
+
+var errClientNotAllowed = fmt.Errorf("client is not allowed")
+
+// checkClient fails if the client does not match the lists of config, an unknown client is not allowed then.
+// The executable is checked only if it is verified to be the one of the client, not of a process with reused PID
+func checkClient(cfg *ControlConfig, peer *control.Peer) error {
+	if len(cfg.AllowUsers) > 0 && (peer == nil || !allowedUser(cfg.AllowUsers, peer)) {
+		return fmt.Errorf("%w: user is not in allowUsers", errClientNotAllowed)
+	}
+	if len(cfg.AllowImages) > 0 && (peer == nil || !peer.ImageVerified) {
+		return fmt.Errorf("%w: executable is not verified", errClientNotAllowed)
+	}
+	if len(cfg.AllowImages) > 0 && !allowedImage(cfg.AllowImages, peer.Image) {
+		return fmt.Errorf("%w: executable is not in allowImages", errClientNotAllowed)
+	}
+	return nil
+}
+
+func allowedUser(list []string, peer *control.Peer) bool {
+	for _, v := range list {
+		if peer.User != "" && strings.EqualFold(v, peer.User) || peer.UserName != "" && strings.EqualFold(v, peer.UserName) {
+			return true
+		}
+	}
+	return false
+}
+
+func allowedImage(list []string, image string) bool {
+	if image == "" {
+		return false
+	}
+	image = filepath.Clean(image)
+	for _, v := range list {
+		v = filepath.Clean(v)
+		if v == image || runtime.GOOS == "windows" && strings.EqualFold(v, image) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditAction writes the client process of the action to the log, the action is refused
+// if the client is not allowed by config
+func auditAction(s *control.Session, action Action) error {
+	peer, err := s.Peer()
+	client := "unknown client"
+	if peer != nil {
+		client = peer.String()
+	}
+	if err != nil {
+		client += fmt.Sprintf(" (%v)", err)
+	}
+	cfg := &GetConfig().Control
+	if cfg.restricted() {
+		if err := checkClient(cfg, peer); err != nil {
+			e := journal.NewLifecycleEvent(journal.EVENT_CONTROL_ACTION, ORIGIN_REMOTE, fmt.Sprintf("%v refused for %v: %v", ActionsDisplay[action], client, err))
+			e.Severity = journal.SEVERITY_WARNING
+			emitEvent(e)
+			return err
+		}
+	}
+	emitEvent(journal.NewLifecycleEvent(journal.EVENT_CONTROL_ACTION, ORIGIN_REMOTE, fmt.Sprintf("%v requested by %v", ActionsDisplay[action], client)))
+	return nil
+}
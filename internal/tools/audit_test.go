@@ -0,0 +1,34 @@
+package tools
+
+import (
+	"errors"
+	"testing"
+
+	"AI-Sid/monitor/internal/control"
+)
+
+func TestCheckClient(t *testing.T) {
+	const image = "/usr/local/bin/proxyMon"
+	cfg := &ControlConfig{AllowUsers: []string{"1000", "admin"}, AllowImages: []string{image}}
+	tests := []struct {
+		name  string
+		peer  *control.Peer
+		allow bool
+	}{
+		{"allowed", &control.Peer{User: "1000", Image: image, ImageVerified: true}, true},
+		{"user name", &control.Peer{User: "1001", UserName: "Admin", Image: "/usr/local/bin/../bin/proxyMon", ImageVerified: true}, true},
+		{"unknown client", nil, false},
+		{"other user", &control.Peer{User: "1001", Image: image, ImageVerified: true}, false},
+		{"other image", &control.Peer{User: "1000", Image: "/tmp/proxyMon", ImageVerified: true}, false},
+		{"image is not verified", &control.Peer{User: "1000", Image: image}, false},
+	}
+	for _, test := range tests {
+		err := checkClient(cfg, test.peer)
+		if test.allow && err != nil || !test.allow && !errors.Is(err, errClientNotAllowed) {
+			t.Errorf("%v: %v", test.name, err)
+		}
+	}
+	if err := checkClient(&ControlConfig{AllowUsers: []string{"1000"}}, &control.Peer{User: "1000"}); err != nil {
+		t.Errorf("image is checked without allowImages: %v", err)
+	}
+}
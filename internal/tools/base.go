@@ -4,13 +4,15 @@ import (
 	"fmt"
 	"strconv"
 	"sync"
-	"syscall"
+	"time"
 
-	"golang.org/x/sys/windows"
+	"AI-Sid/monitor/internal/journal"
 )
 
 var stateIsNormal = true
 var stateMutex sync.Mutex
+var lastError string
+var lastErrorTime time.Time
 var buildMode = false
 
 func SetBuildMode(value string) bool {
@@ -24,9 +26,11 @@ func GetBuildMode() bool {
 
 func InternalError(err error) {
 	stateMutex.Lock()
-	defer stateMutex.Unlock()
 	stateIsNormal = false
+	lastError, lastErrorTime = fmt.Sprint(err), time.Now()
+	stateMutex.Unlock()
 	fmt.Printf("Internal Error: %v\n", err)
+	emitEvent(journal.NewEvent(journal.EVENT_INTERNAL_ERROR, journal.SEVERITY_ERROR, fmt.Sprint(err)))
 }
 
 func IsNormalState() bool {
@@ -58,14 +62,20 @@ func callSimpleFunc(f SimpleFunc) {
 }
 
 var quitFuncs []SimpleFunc = make([]SimpleFunc, 0, 4)
+var quitMutex sync.Mutex // quit can be requested by the control channel while the tray is registering
 
 func RegisterQuitFunc(f SimpleFunc) {
+	quitMutex.Lock()
 	quitFuncs = append(quitFuncs, f)
+	quitMutex.Unlock()
 }
 
 func HandleQuitEvent() {
-	for i := len(quitFuncs) - 1; i >= 0; i-- {
-		callSimpleFunc(quitFuncs[i])
+	quitMutex.Lock()
+	funcs := append([]SimpleFunc(nil), quitFuncs...)
+	quitMutex.Unlock()
+	for i := len(funcs) - 1; i >= 0; i-- {
+		callSimpleFunc(funcs[i])
 	}
 }
 
@@ -74,80 +84,3 @@ func DoExitProgram() {
 		callSimpleFunc(finalizeFuncs[i])
 	}
 }
-
-func GetUint16String(v string) (*uint16, error) {
-	return syscall.UTF16PtrFromString(v)
-}
-
-func CreateNamedMutex(name string) (handle windows.Handle, exists bool, e error) {
-	n, err := GetUint16String(name)
-	if err != nil {
-		return 0, false, err
-	}
-	handle, err = windows.CreateMutex(nil, false, n)
-	if err != nil {
-		if err.(syscall.Errno) == syscall.ERROR_ALREADY_EXISTS {
-			return 0, true, nil
-		}
-		return 0, false, err
-	}
-	return handle, false, nil
-}
-
-func CreateNamedEvent(name string) (windows.Handle, error) {
-	var nptr *uint16
-	if name != "" {
-		if n, err := GetUint16String(name); err != nil {
-			return 0, err
-		} else {
-			nptr = n
-		}
-	}
-	e, err := windows.CreateEvent(nil, 0, 0, nptr)
-	if err != nil {
-		return 0, err
-	}
-	return e, nil
-}
-
-func CreateEvent() (windows.Handle, error) {
-	return CreateNamedEvent("")
-}
-
-func SendNamedEvent(name string) bool {
-	var e error
-	if nptr, err := GetUint16String(name); err == nil {
-		if event, err := windows.OpenEvent(windows.EVENT_MODIFY_STATE, false, nptr); err == nil {
-			defer syscall.CloseHandle(syscall.Handle(event))
-			e = windows.SetEvent(event)
-		} else {
-			e = err
-		}
-	} else {
-		e = err
-	}
-	if e != nil {
-		InternalError(e)
-	}
-	return e == nil
-}
-
-func WaitForEvents(events ...windows.Handle) (windows.Handle, error) {
-	idx, err := windows.WaitForMultipleObjects(events, false, windows.INFINITE)
-	if err != nil {
-		return 0, err
-	}
-	idx -= windows.WAIT_OBJECT_0 // formal, because WAIT_OBJECT_0 == 0
-	return events[idx], nil
-}
-
-func CloseEvent(value *windows.Handle) {
-	if value == nil || *value == 0 {
-		return
-	}
-	err := syscall.CloseHandle(syscall.Handle(*value))
-    if err != nil {
-        InternalError(err)
-    }
-	*value = 0
-}
@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+func GetUint16String(v string) (*uint16, error) {
+	return syscall.UTF16PtrFromString(v)
+}
+
+func CreateNamedMutex(name string) (handle windows.Handle, exists bool, e error) {
+	n, err := GetUint16String(name)
+	if err != nil {
+		return 0, false, err
+	}
+	handle, err = windows.CreateMutex(nil, false, n)
+	if err != nil {
+		if err.(syscall.Errno) == syscall.ERROR_ALREADY_EXISTS {
+			// the handle keeps the mutex alive, IsPrimaryRunning must not see it after the primary exits
+			windows.CloseHandle(handle)
+			return 0, true, nil
+		}
+		return 0, false, err
+	}
+	return handle, false, nil
+}
+
+func CreateNamedEvent(name string) (windows.Handle, error) {
+	var nptr *uint16
+	if name != "" {
+		if n, err := GetUint16String(name); err != nil {
+			return 0, err
+		} else {
+			nptr = n
+		}
+	}
+	e, err := windows.CreateEvent(nil, 0, 0, nptr)
+	if err != nil {
+		return 0, err
+	}
+	return e, nil
+}
+
+func CreateEvent() (windows.Handle, error) {
+	return CreateNamedEvent("")
+}
+
+func SendNamedEvent(name string) bool {
+	var e error
+	if nptr, err := GetUint16String(name); err == nil {
+		if event, err := windows.OpenEvent(windows.EVENT_MODIFY_STATE, false, nptr); err == nil {
+			defer syscall.CloseHandle(syscall.Handle(event))
+			e = windows.SetEvent(event)
+		} else {
+			e = err
+		}
+	} else {
+		e = err
+	}
+	if e != nil {
+		InternalError(e)
+	}
+	return e == nil
+}
+
+func WaitForEvents(events ...windows.Handle) (windows.Handle, error) {
+	idx, err := windows.WaitForMultipleObjects(events, false, windows.INFINITE)
+	if err != nil {
+		return 0, err
+	}
+	idx -= windows.WAIT_OBJECT_0 // formal, because WAIT_OBJECT_0 == 0
+	return events[idx], nil
+}
+
+// WaitForEventsTimeout is WaitForEvents which returns 0 if no event is signaled within timeout
+func WaitForEventsTimeout(timeout time.Duration, events ...windows.Handle) (windows.Handle, error) {
+	idx, err := windows.WaitForMultipleObjects(events, false, uint32(timeout/time.Millisecond))
+	if err != nil {
+		return 0, err
+	}
+	if idx == uint32(windows.WAIT_TIMEOUT) {
+		return 0, nil
+	}
+	idx -= windows.WAIT_OBJECT_0
+	return events[idx], nil
+}
+
+func CloseEvent(value *windows.Handle) {
+	if value == nil || *value == 0 {
+		return
+	}
+	err := syscall.CloseHandle(syscall.Handle(*value))
+    if err != nil {
+        InternalError(err)
+    }
+	*value = 0
+}
@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"AI-Sid/monitor/internal/journal"
+	"AI-Sid/monitor/internal/schedule"
+)
+
+const (
+	APP_DIR_NAME     = "appname"
+	LOG_FILE_NAME    = "appname.log"
+	CONFIG_FILE_NAME = "appname.json"
+	STATE_FILE_NAME  = "appname.state"
+	KEY_FILE_NAME    = "appname.key"
+)
+
+type Config struct {
+	Log     LogConfig     `json:"log"`
+	History HistoryConfig `json:"history"`
+	Sinks   []SinkConfig  `json:"sinks"`
+	Metrics MetricsConfig `json:"metrics"`
+	API     APIConfig     `json:"api"`
+	Control ControlConfig `json:"control"`
+
+	Schedule []schedule.RuleConfig `json:"schedule"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Log: LogConfig{
+			RotateOptions: journal.RotateOptions{
+				MaxSize:    10 << 20,
+				MaxBackups: 10,
+			},
+			Format: journal.FORMAT_TEXT,
+		},
+	}
+}
+
+var config = defaultConfig()
+
+func AppDataDir() string {
+	dir := os.Getenv("APPDATA")
+	if dir == "" { // not Windows
+		dir, _ = os.UserConfigDir()
+	}
+	if instanceName != "" { // named instances are configured independently
+		return filepath.Join(dir, APP_DIR_NAME, instanceName)
+	}
+	return filepath.Join(dir, APP_DIR_NAME)
+}
+
+func DefaultConfigPath() string {
+	return filepath.Join(AppDataDir(), CONFIG_FILE_NAME)
+}
+
+func LogFilePath() string {
+	return filepath.Join(AppDataDir(), LOG_FILE_NAME)
+}
+
+func StateFilePath() string {
+	return filepath.Join(AppDataDir(), STATE_FILE_NAME)
+}
+
+// LoadConfig reads the JSON config, a missing file means default settings
+func LoadConfig(path string) error {
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+	cfg := defaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			config = cfg
+			return nil
+		}
+		return err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return err
+	}
+	config = cfg
+	return nil
+}
+
+func GetConfig() *Config {
+	return config
+}
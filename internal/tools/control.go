@@ -1,18 +1,16 @@
 package tools
 
 import (
-	"syscall"
+	"errors"
+	"fmt"
+	"os"
+	"time"
 
-	"golang.org/x/sys/windows"
+	"AI-Sid/monitor/internal/control"
+	"AI-Sid/monitor/internal/journal"
 )
 
-const (
-	BASE_NAME        = "Global\\AIS_Id_Proxy_Monitor"
-	MUTEX_NAME       = BASE_NAME
-	START_EVENT_NAME = BASE_NAME + "_Start"
-	STOP_EVENT_NAME  = BASE_NAME + "_Stop"
-	QUIT_EVENT_NAME  = BASE_NAME + "_Quit"
-)
+const CONTROL_NAME = "AIS_Id_Proxy_Monitor" // name of the control channel
 
 type Action int
 
@@ -20,6 +18,8 @@ const (
 	ACTION_START Action = iota
 	ACTION_STOP
 	ACTION_QUIT
+	ACTION_PAUSE    // only by the control channel and API, it has arguments
+	ACTION_SNAPSHOT // write the current settings to the log
 	ACTION_NONE
 )
 
@@ -27,74 +27,64 @@ var ActionsDisplay = map[Action]string{
 	ACTION_START: "START",
 	ACTION_STOP: "STOP",
 	ACTION_QUIT: "QUIT",
+	ACTION_PAUSE: "PAUSE",
+	ACTION_SNAPSHOT: "SNAPSHOT",
 }
 
-var actionNames = map[Action]string{
-	ACTION_START: START_EVENT_NAME,
-	ACTION_STOP:  STOP_EVENT_NAME,
-	ACTION_QUIT:  QUIT_EVENT_NAME,
-}
-
-var internalHandles []windows.Handle = make([]windows.Handle, 0, 4)
-var h2aMap, a2hMap = initMaps()
-
-func initMaps() (map[windows.Handle]Action, map[Action]windows.Handle) {
-	return make(map[windows.Handle]Action), make(map[Action]windows.Handle)
-}
+// origins of control actions, they are written to lifecycle events
+const (
+	ORIGIN_STARTUP  = "startup" // command line of the primary instance
+	ORIGIN_TRAY     = "tray"
+	ORIGIN_REMOTE   = "remote" // secondary instance
+	ORIGIN_EXIT     = "exit"
+	ORIGIN_ERROR    = "error"
+	ORIGIN_PAUSE    = "pause"    // automatic resume after pause
+	ORIGIN_API      = "api"      // REST API
+	ORIGIN_SCHEDULE = "schedule" // rule of the schedule in config
+)
 
-func clearEvents() {
-	for i, h := range internalHandles {
-		if i > 0 {
-			windows.CloseHandle(h)
+// performAction performs an action in the primary instance and logs its failure,
+// changed is false if the monitor is already in the requested state
+func performAction(action Action, origin, reason string) (changed bool, err error) {
+	switch action {
+	case ACTION_START, ACTION_STOP:
+		cancelled := cancelPause()
+		changed, err = setLoggingEnabled(action == ACTION_START, stateEvent(action == ACTION_START, origin, reason))
+		if err == nil && !changed && cancelled {
+			emitEvent(journal.NewLifecycleEvent(journal.EVENT_CONTROL_ACTION, origin, "pause cancelled, monitor stays stopped"))
+			changed = true
+		} else if err != nil {
+			e := journal.NewLifecycleEvent(journal.EVENT_CONTROL_ACTION, origin, fmt.Sprintf("%v failed: %v", ActionsDisplay[action], err))
+			e.Severity = journal.SEVERITY_WARNING
+			emitEvent(e)
+		} else if !changed {
+			emitEvent(journal.NewLifecycleEvent(journal.EVENT_CONTROL_ACTION, origin, ignoredMessage(action, reason)))
 		}
+	case ACTION_QUIT:
+		cancelPause()
+		emitEvent(journal.NewLifecycleEvent(journal.EVENT_MONITOR_QUIT, origin, reason))
+		HandleQuitEvent()
+		changed = true
 	}
-	internalHandles = internalHandles[:0]
-	h2aMap, a2hMap = initMaps()
-}
-
-func createActionEvent(name string, action Action) error {
-	if event, err := CreateNamedEvent(name); err == nil {
-		internalHandles = append(internalHandles, event)
-		h2aMap[event] = action
-		a2hMap[action] = event
-		return nil
-	} else {
-		return err
-	}
+	return changed, err
 }
 
-func createEvents() error {
-	for k, v := range actionNames {
-		if err := createActionEvent(v, k); err != nil {
-			return err
-		}
+func ignoredMessage(action Action, reason string) string {
+	msg := ActionsDisplay[action] + " ignored, state is not changed"
+	if reason != "" {
+		msg += " (" + reason + ")"
 	}
-	return nil
+	return msg
 }
 
-func waitForActions() {
-	for {
-		if event, err := WaitForEvents(internalHandles...); err != nil {
-			InternalError(err)
-			break
-		} else {
-			switch h2aMap[event] {
-			case ACTION_START:
-				SetLoggingEnabled(true)
-			case ACTION_STOP:
-				SetLoggingEnabled(false)
-			case ACTION_QUIT:
-				HandleQuitEvent()
-				return
-			}
-		}
-	}
+// handleAction performs an action in the primary instance, returns false after ACTION_QUIT
+func handleAction(action Action, origin string) bool {
+	performAction(action, origin, "")
+	return action != ACTION_QUIT
 }
 
-var Mutex windows.Handle = 0 // 0 indicates secondary Instance
-
 func InitializeControl(action Action) bool {
-	mtx, exists, err := CreateNamedMutex(MUTEX_NAME)
+	exists, err := lockPrimary()
 	if err != nil {
 		InternalError(err)
 		return false
@@ -102,31 +92,66 @@ func InitializeControl(action Action) bool {
 	if exists {
 		return false
 	}
-	Mutex = mtx
 	if action == ACTION_QUIT {
 		return true
 	}
-	if err := createEvents(); err != nil {
-		InternalError(err)
-		return false
+	openSinks()
+	// named events can't tell their sender, they would bypass the allow list
+	if !GetConfig().Control.restricted() {
+		if err := startEventActions(); err != nil {
+			InternalError(err)
+			return false
+		}
+	}
+	// the monitor is not running yet, so -stop only keeps it stopped: it is not an ignored action
+	if action != ACTION_STOP {
+		performAction(ACTION_START, ORIGIN_STARTUP, "")
 	}
-	SetLoggingEnabled(action != ACTION_STOP)
-	go waitForActions()
+	startScheduler()
+	startControlServer()
+	startAPIServer()
 	return true
 }
 
-func SendAction(action Action) bool {
+// SendAction sends the action to the primary instance and waits up to timeout until it confirms
+// the resulting state. Named events are used on Windows if the primary does not listen to the control
+// channel (older versions), then only quit can be confirmed and ErrNotConfirmed is returned for other actions
+func SendAction(action Action, reason string, timeout time.Duration) error {
 	if action == ACTION_NONE {
-		return true
+		return nil
 	}
-	return SendNamedEvent(actionNames[action])
+	deadline := time.Now().Add(timeout)
+	err := sendActionRequest(action, control.ActionArgs{Reason: reason}, timeout)
+	if errors.Is(err, control.ErrNotRunning) {
+		if !sendEventAction(action) {
+			return control.ErrNotRunning
+		}
+		if action != ACTION_QUIT {
+			return ErrNotConfirmed
+		}
+		err = nil
+	}
+	if err == nil && action == ACTION_QUIT {
+		err = waitPrimaryExit(deadline)
+	}
+	return err
 }
 
-func finalizeControl() {
-	clearEvents()
-	if Mutex != 0 {
-		syscall.CloseHandle(syscall.Handle(Mutex))
+func waitPrimaryExit(deadline time.Time) error {
+	for IsPrimaryRunning() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("main instance is still running: %w", os.ErrDeadlineExceeded)
+		}
+		time.Sleep(100 * time.Millisecond)
 	}
+	return nil
+}
+
+func finalizeControl() {
+	stopScheduler()
+	stopAPIServer()
+	stopControlServer()
+	releasePrimary()
 }
 
 func init() {
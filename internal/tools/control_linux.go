@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"AI-Sid/monitor/internal/control"
+)
+
+const LOCK_SUFFIX = ".lock"
+
+const lockRetryTimeout = 200 * time.Millisecond
+
+// lockFile is locked by the primary instance until it exits, nil indicates secondary instance.
+// The file is not removed on exit, a new primary can lock it at the same time
+var lockFile *os.File
+var lockMutex sync.Mutex
+
+func lockFilePath() (string, error) {
+	dir, err := control.RuntimeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, controlName()+LOCK_SUFFIX), nil
+}
+
+// channelName is the socket name, sockets and lock files are per user, so the namespace is not used
+func channelName() string {
+	return controlName()
+}
+
+// lockPrimary takes the exclusive flock of the lock file, exists is true if another instance holds it.
+// The lock belongs to the open file, so other descriptors of the file opened and closed by this
+// process don't release it (as they would with fcntl locks). The lock is released by the system
+// if the primary crashes
+func lockPrimary() (exists bool, err error) {
+	path, err := lockFilePath()
+	if err != nil {
+		return false, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return false, err
+	}
+	// IsPrimaryRunning of another process can hold a shared lock for a moment
+	deadline := time.Now().Add(lockRetryTimeout)
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if !errors.Is(err, syscall.EWOULDBLOCK) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(lockRetryTimeout / 10)
+	}
+	if err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return true, nil
+		}
+		return false, err
+	}
+	lockMutex.Lock()
+	lockFile = f
+	lockMutex.Unlock()
+	return false, nil
+}
+
+// IsPrimaryRunning tests the lock by a shared lock, which is released at once,
+// so it doesn't prevent the start of the primary
+func IsPrimaryRunning() bool {
+	lockMutex.Lock()
+	locked := lockFile != nil
+	lockMutex.Unlock()
+	if locked {
+		return true
+	}
+	path, err := lockFilePath()
+	if err != nil {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return errors.Is(syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB), syscall.EWOULDBLOCK)
+}
+
+// there are no named events on Linux, the control channel is the only way to control the primary
+func startEventActions() error {
+	return nil
+}
+
+func sendEventAction(action Action) bool {
+	return false
+}
+
+func releasePrimary() {
+	lockMutex.Lock()
+	defer lockMutex.Unlock()
+	if lockFile != nil {
+		lockFile.Close()
+		lockFile = nil
+	}
+}
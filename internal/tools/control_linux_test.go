@@ -0,0 +1,280 @@
+package tools
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"AI-Sid/monitor/internal/control"
+)
+
+const (
+	lockHelperEnv = "PROXYMON_TEST_LOCK_HELPER"
+	testTimeout   = 5 * time.Second
+)
+
+// TestMain keeps the files of the tests in a temporary directory. With lockHelperEnv=hold
+// the test binary is the process which holds the lock until its stdin is closed,
+// with lockHelperEnv=probe it prints what another instance sees
+func TestMain(m *testing.M) {
+	switch os.Getenv(lockHelperEnv) {
+	case "hold":
+		if exists, err := lockPrimary(); err != nil || exists {
+			fmt.Printf("lock failed: %v %v\n", exists, err)
+			os.Exit(1)
+		}
+		fmt.Println("locked")
+		bufio.NewReader(os.Stdin).ReadString('\n')
+		os.Exit(0)
+	case "probe":
+		running := IsPrimaryRunning()
+		exists, err := lockPrimary()
+		fmt.Printf("running %v, exists %v, error %v\n", running, exists, err)
+		os.Exit(0)
+	}
+	dir, err := os.MkdirTemp("", "proxyMon-test")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	os.Setenv("APPDATA", filepath.Join(dir, "appdata"))
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+	environmentFile = filepath.Join(dir, "environment")
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func setProxyVariables(t *testing.T, lines ...string) {
+	if err := os.WriteFile(environmentFile, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	helper := exec.Command(os.Args[0], "-test.run=^$")
+	helper.Env = append(os.Environ(), lockHelperEnv+"=hold")
+	stdin, err := helper.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := helper.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := helper.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer helper.Process.Kill()
+	if line, _ := bufio.NewReader(stdout).ReadString('\n'); line != "locked\n" {
+		t.Fatalf("helper: %q", line)
+	}
+
+	if !IsPrimaryRunning() {
+		t.Error("the lock of another process is not found")
+	}
+	if exists, err := lockPrimary(); err != nil || !exists {
+		t.Fatalf("lock of another process is taken: %v %v", exists, err)
+	}
+	// the lock is released by the system when the primary exits
+	stdin.Close()
+	if err := helper.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if IsPrimaryRunning() {
+		t.Error("the lock is found after the primary exited")
+	}
+	if exists, err := lockPrimary(); err != nil || exists {
+		t.Fatalf("lock is not taken after the primary exited: %v %v", exists, err)
+	}
+	defer releasePrimary()
+	path, err := lockFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("lock file: %v", err)
+	}
+}
+
+// other descriptors of the lock file opened and closed by the primary don't release the lock
+func TestLockKept(t *testing.T) {
+	if exists, err := lockPrimary(); err != nil || exists {
+		t.Fatalf("lock: %v %v", exists, err)
+	}
+	defer releasePrimary()
+	path, err := lockFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	probe := exec.Command(os.Args[0], "-test.run=^$")
+	probe.Env = append(os.Environ(), lockHelperEnv+"=probe")
+	out, err := probe.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "running true, exists true, error <nil>\n" {
+		t.Errorf("another instance: %q", out)
+	}
+}
+
+func TestSocketTransport(t *testing.T) {
+	transport := &control.SocketTransport{Dir: t.TempDir()}
+	if _, err := control.Dial(transport, "test", time.Second); !errors.Is(err, control.ErrNotRunning) {
+		t.Fatalf("dial without listener: %v", err)
+	}
+	l, err := transport.Listen("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(transport.Dir, "test"+control.SOCKET_SUFFIX))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode: %v %v", info, err)
+	}
+	if _, err := transport.Listen("test"); err == nil {
+		t.Error("the socket is listened twice")
+	}
+	peers := make(chan *control.Peer, 1)
+	s := control.NewServer(l, func(s *control.Session, req *control.Request) *control.Response {
+		peer, err := s.Peer()
+		if err != nil {
+			return control.NewError(control.ERROR_FAILED, "%v", err)
+		}
+		peers <- peer
+		return control.NewResult(control.PingResult{PID: peer.PID})
+	})
+	go s.Serve()
+	client, err := control.Dial(transport, "test", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ping control.PingResult
+	if err := client.Call(control.COMMAND_PING, nil, &ping); err != nil || ping.PID != os.Getpid() {
+		t.Errorf("peer pid %d, want %d: %v", ping.PID, os.Getpid(), err)
+	}
+	exe, _ := os.Executable()
+	if peer := <-peers; peer.Image != exe || !peer.ImageVerified {
+		t.Errorf("peer image %q (verified %v), want %q", peer.Image, peer.ImageVerified, exe)
+	}
+	client.Close()
+	s.Close()
+
+	// the socket of a crashed primary is replaced
+	if err := os.WriteFile(filepath.Join(transport.Dir, "stale"+control.SOCKET_SUFFIX), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if l, err = transport.Listen("stale"); err != nil {
+		t.Fatalf("listen instead of stale socket: %v", err)
+	}
+	l.Close()
+}
+
+// waitLog waits until the main log contains text n times, the monitor reports changes every MONITOR_INTERVAL
+func waitLog(t *testing.T, text string, n int, timeout time.Duration) {
+	for deadline := time.Now().Add(timeout); ; time.Sleep(100 * time.Millisecond) {
+		data, _ := os.ReadFile(LogFilePath())
+		if strings.Count(string(data), text) >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%q is not found in the log:\n%s", text, data)
+		}
+	}
+}
+
+func TestControlRoundTrips(t *testing.T) {
+	setProxyVariables(t, "# proxy", `export http_proxy="http://10.0.0.1:3128"`)
+	if !InitializeControl(ACTION_STOP) {
+		t.Fatal("primary is not initialized")
+	}
+	exited := make(chan struct{})
+	go func() {
+		RunTray()
+		DoExitProgram()
+		close(exited)
+	}()
+	if GetLoggingEnabled() || !IsPrimaryRunning() {
+		t.Fatal("primary must run with stopped monitor")
+	}
+
+	if err := SendAction(ACTION_START, "test start", testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if !GetLoggingEnabled() {
+		t.Error("monitor is not started")
+	}
+	waitLog(t, "proxy on, http://10.0.0.1:3128", 1, testTimeout)
+
+	// the change of the file is found by the monitor, snapshot reads it at once
+	setProxyVariables(t, "HTTPS_PROXY=proxy.local:8080", "http_proxy=http://10.0.0.1:3128")
+	var res control.ActionResult
+	if err := callPrimary(control.COMMAND_SNAPSHOT, control.ActionArgs{}, &res, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if res.Snapshot == nil || !res.Snapshot.Enabled || res.Snapshot.Server != "proxy.local:8080" {
+		t.Errorf("snapshot %+v", res.Snapshot)
+	}
+	// the snapshot is a separate record, the change is still reported by the monitor
+	waitLog(t, "snapshot [remote]: proxy on, proxy.local:8080", 1, 0)
+	waitLog(t, "proxy on, proxy.local:8080", 2, 3*MONITOR_INTERVAL)
+
+	if err := SendPause(30*time.Minute, "test pause", testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if until, ok := PausedUntil(); !ok || GetLoggingEnabled() || time.Until(until) < 29*time.Minute {
+		t.Errorf("monitor is not paused: %v %v", until, ok)
+	}
+	var snapshotErr *control.Error
+	if err := callPrimary(control.COMMAND_SNAPSHOT, control.ActionArgs{}, &res, testTimeout); !errors.As(err, &snapshotErr) || ExitCode(err) != EXIT_REJECTED {
+		t.Errorf("snapshot while paused: %v", err)
+	}
+	// start cancels the pause
+	if err := SendAction(ACTION_START, "", testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := PausedUntil(); ok || !GetLoggingEnabled() {
+		t.Error("pause is not cancelled by start")
+	}
+
+	if err := SendAction(ACTION_STOP, "test stop", testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if GetLoggingEnabled() {
+		t.Error("monitor is not stopped")
+	}
+
+	if err := SendAction(ACTION_QUIT, "test quit", testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(testTimeout):
+		t.Fatal("primary does not exit")
+	}
+	if IsPrimaryRunning() {
+		t.Error("primary is running after quit")
+	}
+	if err := SendAction(ACTION_START, "", time.Second); ExitCode(err) != EXIT_NO_PRIMARY {
+		t.Errorf("start after quit: %v", err)
+	}
+	for _, text := range []string{"START requested by pid", "monitor started [remote]: test start", "monitor paused [remote]", "monitor stopped [remote]: test stop", "monitor quit [remote]: test quit"} {
+		waitLog(t, text, 1, 0)
+	}
+	data, _ := os.ReadFile(LogFilePath())
+	if strings.Contains(string(data), "ignored") {
+		t.Errorf("startup with -stop logs an ignored action:\n%s", data)
+	}
+}
@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	GLOBAL_PREFIX      = "Global\\"
+	LOCAL_PREFIX       = "Local\\"
+	START_EVENT_SUFFIX = "_Start"
+	STOP_EVENT_SUFFIX  = "_Stop"
+	QUIT_EVENT_SUFFIX  = "_Quit"
+)
+
+// baseName is the name of the mutex and the prefix of events in the namespace of the instance
+func baseName() string {
+	if instanceNamespace == NAMESPACE_LOCAL {
+		return LOCAL_PREFIX + controlName()
+	}
+	return GLOBAL_PREFIX + controlName()
+}
+
+// channelName is the pipe name, pipes have no namespaces, so the local one includes the session
+func channelName() string {
+	if instanceNamespace != NAMESPACE_LOCAL {
+		return controlName()
+	}
+	var session uint32
+	if err := windows.ProcessIdToSessionId(windows.GetCurrentProcessId(), &session); err != nil {
+		InternalError(err)
+	}
+	return fmt.Sprintf("%v_session%d", controlName(), session)
+}
+
+var actionNames = map[Action]string{
+	ACTION_START: START_EVENT_SUFFIX,
+	ACTION_STOP:  STOP_EVENT_SUFFIX,
+	ACTION_QUIT:  QUIT_EVENT_SUFFIX,
+}
+
+var internalHandles []windows.Handle = make([]windows.Handle, 0, 4)
+var h2aMap, a2hMap = initMaps()
+
+func initMaps() (map[windows.Handle]Action, map[Action]windows.Handle) {
+	return make(map[windows.Handle]Action), make(map[Action]windows.Handle)
+}
+
+func clearEvents() {
+	for i, h := range internalHandles {
+		if i > 0 {
+			windows.CloseHandle(h)
+		}
+	}
+	internalHandles = internalHandles[:0]
+	h2aMap, a2hMap = initMaps()
+}
+
+func createActionEvent(name string, action Action) error {
+	if event, err := CreateNamedEvent(name); err == nil {
+		internalHandles = append(internalHandles, event)
+		h2aMap[event] = action
+		a2hMap[action] = event
+		return nil
+	} else {
+		return err
+	}
+}
+
+func createEvents() error {
+	for k, v := range actionNames {
+		if err := createActionEvent(baseName()+v, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func waitForActions() {
+	for {
+		if event, err := WaitForEvents(internalHandles...); err != nil {
+			InternalError(err)
+			break
+		} else if !handleAction(h2aMap[event], ORIGIN_REMOTE) {
+			return
+		}
+	}
+}
+
+var Mutex windows.Handle = 0 // 0 indicates secondary Instance
+
+func IsPrimaryRunning() bool {
+	if Mutex != 0 {
+		return true
+	}
+	n, err := GetUint16String(baseName())
+	if err != nil {
+		return false
+	}
+	mtx, err := windows.OpenMutex(windows.SYNCHRONIZE, false, n)
+	if err != nil {
+		return false
+	}
+	windows.CloseHandle(mtx)
+	return true
+}
+
+// lockPrimary creates the named mutex, exists is true if another instance owns it
+func lockPrimary() (exists bool, err error) {
+	mtx, exists, err := CreateNamedMutex(baseName())
+	if err != nil || exists {
+		return exists, err
+	}
+	Mutex = mtx
+	return false, nil
+}
+
+// startEventActions lets secondary instances of older versions control the primary by named events
+func startEventActions() error {
+	if err := createEvents(); err != nil {
+		return err
+	}
+	go waitForActions()
+	return nil
+}
+
+func sendEventAction(action Action) bool {
+	name, ok := actionNames[action]
+	return ok && SendNamedEvent(baseName()+name)
+}
+
+func releasePrimary() {
+	clearEvents()
+	if Mutex != 0 {
+		syscall.CloseHandle(syscall.Handle(Mutex))
+	}
+}
@@ -0,0 +1,103 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"AI-Sid/monitor/internal/journal"
+)
+
+// logKey returns the key of log encryption, only the writer of the log creates a missing key
+func logKey(enc journal.EncryptionOptions, create bool) ([]byte, error) {
+	provider, err := journal.NewKeyProvider(enc, filepath.Join(AppDataDir(), KEY_FILE_NAME), create)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Key()
+}
+
+// logDecoder returns the decryptor of log records, nil if encryption is disabled
+func logDecoder(enc journal.EncryptionOptions) (journal.LineDecoder, error) {
+	if !enc.Enabled {
+		return nil, nil
+	}
+	key, err := logKey(enc, false)
+	if err != nil {
+		return nil, err
+	}
+	decryptor, err := journal.NewLineDecryptor(key)
+	if err != nil {
+		return nil, err
+	}
+	return decryptor.Decoder(), nil
+}
+
+// RunDecryptCommand writes decrypted records of log files (default - appname.log with rotated
+// files) to out (empty - console), the key is taken from the log encryption settings even if it is disabled now
+func RunDecryptCommand(files []string, out string) error {
+	if len(files) == 0 {
+		var err error
+		if files, err = journal.LogFiles(LogFilePath()); err != nil {
+			return err
+		}
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no log files found")
+	}
+	key, err := logKey(GetConfig().Log.Encryption, false)
+	if err != nil {
+		return err
+	}
+	decryptor, err := journal.NewLineDecryptor(key)
+	if err != nil {
+		return err
+	}
+	w := os.Stdout
+	if out != "" {
+		if w, err = os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600); err != nil {
+			return err
+		}
+		defer w.Close()
+	}
+	count, err := journal.DecryptRecords(w, files, decryptor.Decoder())
+	if out != "" {
+		fmt.Printf("%d records decrypted to %v\n", count, out)
+	}
+	return err
+}
+
+// the sealer is cached, the state is saved every CHECKED_INTERVAL and DPAPI should not be called each time
+var (
+	sealerMutex sync.Mutex
+	sealerOpts  journal.EncryptionOptions
+	sealer      *journal.Sealer
+)
+
+// storeSealer returns the encryption of history, state and webhook queue, nil if log encryption
+// is disabled. If the key is not available, the stores must not be written as plain text
+func storeSealer(create bool) (*journal.Sealer, error) {
+	enc := GetConfig().Log.Encryption
+	if !enc.Enabled {
+		return nil, nil
+	}
+	if enc.KeyFile == "" {
+		enc.KeyFile = filepath.Join(AppDataDir(), KEY_FILE_NAME)
+	}
+	sealerMutex.Lock()
+	defer sealerMutex.Unlock()
+	if sealer != nil && sealerOpts == enc {
+		return sealer, nil
+	}
+	key, err := logKey(enc, create)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: %w", err)
+	}
+	s, err := journal.NewSealer(key)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: %w", err)
+	}
+	sealer, sealerOpts = s, enc
+	return s, nil
+}
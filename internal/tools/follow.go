@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"AI-Sid/monitor/internal/control"
+	"AI-Sid/monitor/internal/journal"
+)
+
+const (
+	FOLLOW_SINK   = "follow"
+	FOLLOW_BUFFER = 64 // events waiting for a -follow client, newer are dropped
+)
+
+// subscriptions of -follow clients, the hub is added to sinks of the primary instance
+var hub = journal.NewHub()
+
+func addFollowSink() {
+	sinksMutex.Lock()
+	defer sinksMutex.Unlock()
+	dispatcher.Add(FOLLOW_SINK, hub, journal.Filter{}, 0)
+}
+
+func subscribe(s *control.Session, req *control.Request) *control.Response {
+	var args control.SubscribeArgs
+	if err := req.DecodeArgs(&args); err != nil {
+		return control.NewError(control.ERROR_BAD_REQUEST, "%v", err)
+	}
+	sub := hub.Subscribe(args.Filter, FOLLOW_BUFFER)
+	if err := s.Send(&control.Response{ID: req.ID, OK: true}); err != nil {
+		sub.Close()
+		return nil
+	}
+	go streamEvents(s, req.ID, sub)
+	return nil
+}
+
+func streamEvents(s *control.Session, id uint64, sub *journal.Subscription) {
+	defer sub.Close()
+	var reported uint64
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok { // sinks are closed on exit
+				return
+			}
+			msg := &control.Response{ID: id, OK: true, Event: e}
+			if dropped := sub.Dropped(); dropped != reported {
+				msg.Dropped, reported = dropped-reported, dropped
+			}
+			if s.Send(msg) != nil {
+				return
+			}
+		case <-s.Done():
+			return
+		}
+	}
+}
+
+// RunFollowCommand prints events of the primary instance as they happen until it exits
+func RunFollowCommand(source string, asJSON bool, timeout time.Duration) error {
+	client, err := control.Dial(control.DefaultTransport, channelName(), timeout)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	args := control.SubscribeArgs{}
+	if source != "" {
+		args.Filter.Sources = []string{source}
+	}
+	client.Timeout = timeout
+	if err := client.Call(control.COMMAND_SUBSCRIBE, args, nil); err != nil {
+		return err
+	}
+	client.Timeout = 0
+	for {
+		msg, err := client.Receive()
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			fmt.Println("Main instance closed the connection")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Dropped > 0 {
+			fmt.Printf("... %d events dropped\n", msg.Dropped)
+		}
+		if msg.Event != nil {
+			if err := printEvents([]*journal.Event{msg.Event}, asJSON); err != nil {
+				return err
+			}
+		}
+	}
+}
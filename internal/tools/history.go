@@ -0,0 +1,222 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"AI-Sid/monitor/internal/journal"
+)
+
+const (
+	HISTORY_SINK      = "history"
+	HISTORY_FILE_NAME = "appname.history"
+)
+
+type HistoryConfig struct {
+	Disabled bool           `json:"disabled,omitempty"`
+	Path     string         `json:"path,omitempty"` // without extension, default %APPDATA%/appname/appname.history
+	Filter   journal.Filter `json:"filter"`
+}
+
+func HistoryPath() string {
+	if p := GetConfig().History.Path; p != "" {
+		return p
+	}
+	return filepath.Join(AppDataDir(), HISTORY_FILE_NAME)
+}
+
+func openHistorySink() {
+	cfg := GetConfig().History
+	if cfg.Disabled {
+		return
+	}
+	sealer, err := storeSealer(true)
+	if err != nil {
+		InternalError(fmt.Errorf("history: %w", err))
+		return
+	}
+	h, err := journal.OpenHistory(HistoryPath(), false, sealer)
+	if err != nil {
+		InternalError(fmt.Errorf("history: %w", err))
+		return
+	}
+	sinksMutex.Lock()
+	defer sinksMutex.Unlock()
+	dispatcher.Add(HISTORY_SINK, h, cfg.Filter, 0)
+}
+
+// openHistory opens the store for commands, the key of encryption is not created by them
+func openHistory(readOnly bool) (*journal.History, error) {
+	sealer, err := storeSealer(false)
+	if err != nil {
+		return nil, err
+	}
+	return journal.OpenHistory(HistoryPath(), readOnly, sealer)
+}
+
+var timeArgFormats = []string{
+	journal.TIME_FORMAT,
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseTimeArg accepts local date/time ("2006-01-02 15:04"), time of today ("14:32")
+// or a duration back from now ("90m", "24h", "7d")
+func ParseTimeArg(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, f := range timeArgFormats {
+		if t, err := time.ParseInLocation(f, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	for _, f := range []string{"15:04", "15:04:05"} {
+		if t, err := time.ParseInLocation(f, value, time.Local); err == nil {
+			y, m, d := time.Now().Date()
+			return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+	}
+	if d, err := journal.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+type HistoryArgs struct {
+	Since, Until, At string
+	Source           string
+	JSON             bool
+}
+
+func printEvents(events []*journal.Event, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range events {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, e := range events {
+		source := e.Source
+		if source == "" {
+			source = "-"
+		}
+		fmt.Printf("%v  %-6v %v\n", e.Time.Format(journal.TIME_FORMAT), source, e.Text())
+	}
+	return nil
+}
+
+// RunHistoryCommand prints history records, with At - the proxy settings at the given moment
+func RunHistoryCommand(args HistoryArgs) error {
+	h, err := openHistory(true)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	if args.At != "" {
+		at, err := ParseTimeArg(args.At)
+		if err != nil {
+			return err
+		}
+		source := args.Source
+		if source == "" {
+			source = journal.SOURCE_USER
+		}
+		e, err := h.At(at, source)
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			return fmt.Errorf("no records for %v before %v", source, at.Format(journal.TIME_FORMAT))
+		}
+		return printEvents([]*journal.Event{e}, args.JSON)
+	}
+	q := journal.HistoryQuery{Source: args.Source}
+	if q.Since, err = ParseTimeArg(args.Since); err != nil {
+		return err
+	}
+	if q.Until, err = ParseTimeArg(args.Until); err != nil {
+		return err
+	}
+	events, err := h.Query(q)
+	if err != nil {
+		return err
+	}
+	return printEvents(events, args.JSON)
+}
+
+// RunImportCommand imports text logs (default - appname.log with rotated files) into history.
+// Records which are already stored are skipped, so import can be repeated
+func RunImportCommand(files []string) error {
+	if IsPrimaryRunning() {
+		return fmt.Errorf("history is in use by running monitor, stop it with -quit first")
+	}
+	if len(files) == 0 {
+		var err error
+		if files, err = journal.LogFiles(LogFilePath()); err != nil {
+			return err
+		}
+	}
+	h, err := openHistory(false)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	for _, name := range files {
+		imported, duplicates, err := importLegacyLog(h, name)
+		if err != nil {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+		fmt.Printf("%v: imported %d, already present %d\n", name, imported, duplicates)
+	}
+	return nil
+}
+
+func importLegacyLog(h *journal.History, name string) (imported, duplicates int, err error) {
+	f, err := journal.OpenRecordFile(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	reader := journal.NewLegacyReader(f)
+	if reader.Decode, err = logDecoder(GetConfig().Log.Encryption); err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		for _, e := range reader.Skipped {
+			fmt.Printf("%v: skipped %v\n", name, e)
+		}
+	}()
+	for {
+		e, err := reader.Next()
+		if err == io.EOF {
+			return imported, duplicates, nil
+		}
+		if err != nil {
+			return imported, duplicates, err
+		}
+		if found, err := h.Contains(e); err != nil {
+			return imported, duplicates, err
+		} else if found {
+			duplicates++
+			continue
+		}
+		if err := h.Append(e); err != nil {
+			return imported, duplicates, err
+		}
+		imported++
+	}
+}
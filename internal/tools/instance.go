@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// namespaces of named objects of the instance
+const (
+	NAMESPACE_GLOBAL = "global" // one instance of the name per machine
+	NAMESPACE_LOCAL  = "local"  // one instance of the name per terminal server session
+)
+
+const MAX_INSTANCE_NAME = 64
+
+var instanceNamePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// instanceName is empty for the default instance, it has names and paths of previous versions
+var instanceName string
+var instanceNamespace = NAMESPACE_GLOBAL
+
+// SetInstance selects the named instance and its namespace, it must be called before LoadConfig.
+// Names are not case sensitive, because pipe names and paths are not
+func SetInstance(name, namespace string) error {
+	name = strings.ToLower(name)
+	if name != "" && (len(name) > MAX_INSTANCE_NAME || !instanceNamePattern.MatchString(name)) {
+		return fmt.Errorf("invalid instance name %q: letters, digits, '-' and '_' are allowed", name)
+	}
+	switch namespace {
+	case "":
+		namespace = NAMESPACE_GLOBAL
+	case NAMESPACE_GLOBAL, NAMESPACE_LOCAL:
+	default:
+		return fmt.Errorf("unknown namespace %q: %v or %v expected", namespace, NAMESPACE_GLOBAL, NAMESPACE_LOCAL)
+	}
+	instanceName, instanceNamespace = name, namespace
+	return nil
+}
+
+func InstanceName() string {
+	return instanceName
+}
+
+// controlName is the base of the control channel and named objects of the instance
+func controlName() string {
+	if instanceName == "" {
+		return CONTROL_NAME
+	}
+	return CONTROL_NAME + "_" + instanceName
+}
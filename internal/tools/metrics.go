@@ -0,0 +1,91 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"AI-Sid/monitor/internal/journal"
+)
+
+const (
+	METRICS_SINK = "metrics"
+	METRICS_PATH = "/metrics"
+)
+
+type MetricsConfig struct {
+	Address string `json:"address,omitempty"` // loopback host:port, e.g. 127.0.0.1:9464; empty - disabled
+}
+
+var metrics = journal.NewMetrics()
+var metricsServer *http.Server
+var metricsSinkAdded bool
+
+// addMetricsSink lets metrics count events, it is called with locked sinksMutex
+// by the Prometheus endpoint and OTLP sinks
+func addMetricsSink() {
+	if metricsSinkAdded || dispatcher == nil {
+		return
+	}
+	metrics.SinkStats = dispatcher.Stats
+	dispatcher.Add(METRICS_SINK, metrics, journal.Filter{}, 0)
+	metricsSinkAdded = true
+}
+
+// checkLoopback rejects addresses which are reachable from other hosts
+func checkLoopback(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("%v is not a loopback address", address)
+}
+
+// startMetricsServer starts the Prometheus endpoint if it is configured
+func startMetricsServer() {
+	address := GetConfig().Metrics.Address
+	if address == "" {
+		return
+	}
+	if err := checkLoopback(address); err != nil {
+		InternalError(fmt.Errorf("metrics: %w", err))
+		return
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		InternalError(fmt.Errorf("metrics: %w", err))
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(METRICS_PATH, metrics)
+	sinksMutex.Lock()
+	defer sinksMutex.Unlock()
+	addMetricsSink()
+	metricsServer = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func(s *http.Server) {
+		if err := s.Serve(listener); err != nil && err != http.ErrServerClosed {
+			InternalError(fmt.Errorf("metrics: %w", err))
+		}
+	}(metricsServer)
+}
+
+func stopMetricsServer() {
+	sinksMutex.Lock()
+	s := metricsServer
+	metricsServer = nil
+	sinksMutex.Unlock()
+	if s == nil {
+		return
+	}
+	ctx, done := context.WithTimeout(context.Background(), time.Second)
+	defer done()
+	s.Shutdown(ctx)
+}
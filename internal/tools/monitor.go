@@ -2,24 +2,12 @@ package tools
 
 import (
 	"fmt"
-	"os"
 	"sync"
 	"time"
 
-	"golang.org/x/sys/windows"
-	"golang.org/x/sys/windows/registry"
+	"AI-Sid/monitor/internal/journal"
 )
 
-const (
-	INET_KEY   = `SOFTWARE\Microsoft\Windows\CurrentVersion\Internet Settings`
-	REG_NOTIFY = 5 // REG_NOTIFY_CHANGE_NAME | REG_NOTIFY_CHANGE_LAST_SET
-)
-
-var (
-	winRegNotifyChangeKeyValue = GetDllProc("Advapi32.dll", "RegNotifyChangeKeyValue")
-)
-
-var cancel windows.Handle
 var loggingEnabled bool
 
 type MonitorStateChanged = func(value bool)
@@ -40,29 +28,42 @@ func RegisterLoggingStateListener(listener MonitorStateChanged) {
 	listeners = append(listeners, listener)
 }
 
-const timeFormat = "2006-01-02T15:04:05.000"
+func logProxyData(previous *journal.Snapshot) {
+	emitEvent(journal.NewProxyEvent(journal.SOURCE_USER, journal.Snapshot{Enabled: proxyEnabled, Server: proxyServer}, previous))
+}
 
-func logProxyData(log *os.File) {
-	timestamp := time.Now().Format(timeFormat)
-	if proxyEnabled {
-		fmt.Fprintf(log, "%v        proxy on, %v\n", timestamp, proxyServer)
-	} else {
-		fmt.Fprintf(log, "%v        proxy off\n", timestamp)
+var (
+	errMonitorUnavailable = fmt.Errorf("monitor is not initialized")
+	errStateLocked        = fmt.Errorf("monitor state is locked")
+)
+
+// SetLoggingEnabled changes the monitor state on behalf of origin (tray, remote, ...),
+// changed is false if the monitor is already in the requested state
+func SetLoggingEnabled(value bool, origin string) (changed bool, err error) {
+	return setLoggingEnabled(value, stateEvent(value, origin, ""))
+}
+
+// stateEvent is the lifecycle event of start or stop, message is e.g. the reason of remote action
+func stateEvent(value bool, origin, message string) *journal.Event {
+	if value {
+		return journal.NewLifecycleEvent(journal.EVENT_MONITOR_STARTED, origin, message)
 	}
+	return journal.NewLifecycleEvent(journal.EVENT_MONITOR_STOPPED, origin, message)
 }
 
-func SetLoggingEnabled(value bool) {
-    if cancel == 0 {
-        return
+// setLoggingEnabled emits e if the state is changed (start, stop or pause event)
+func setLoggingEnabled(value bool, e *journal.Event) (changed bool, err error) {
+    if !monitorAvailable() {
+        return false, errMonitorUnavailable
     }
 	monitorMutex.Lock()
 	defer monitorMutex.Unlock()
     if loggingEnabled == value {
-		return
+		return false, nil
 	}
     if changeStateLocked {
 		fmt.Println("Error: Monitor state is locked.")
-        return
+        return false, errStateLocked
 	}
 	changeStateLocked = true
     defer func() {
@@ -72,18 +73,24 @@ func SetLoggingEnabled(value bool) {
 		err := startMonitor()
 		if err != nil {
 			InternalError(err)
-			return
+			return false, err
 		}
 	} else {
-		if cancel != 0 {
-			err := windows.SetEvent(cancel)
-			if err != nil {
-				InternalError(err)
-				return
-			}
+		err := stopMonitor()
+		if err != nil {
+			InternalError(err)
+			return false, err
 		}
+		touchProxyState()
 	}
 	loggingEnabled = value
+	emitEvent(e)
+	notifyListeners(value)
+	return true, nil
+}
+
+// notifyListeners is called with locked monitorMutex
+func notifyListeners(value bool) {
 	for _, listener := range listeners {
 		func() {
 			monitorMutex.Unlock()
@@ -93,128 +100,70 @@ func SetLoggingEnabled(value bool) {
 	}
 }
 
-func GetLoggingEnabled() bool {
+// monitoringFailed marks the monitor as stopped when monitoring goroutine can't continue
+func monitoringFailed(err error) {
 	monitorMutex.Lock()
 	defer monitorMutex.Unlock()
-	return loggingEnabled
-}
-
-type monitorState struct {
-    monitoring bool
-    log *os.File
-    key registry.Key
-    event windows.Handle
+	if !loggingEnabled || changeStateLocked {
+		return
+	}
+	loggingEnabled = false
+	touchProxyState()
+	e := journal.NewLifecycleEvent(journal.EVENT_MONITOR_STOPPED, ORIGIN_ERROR, fmt.Sprint(err))
+	e.Severity = journal.SEVERITY_ERROR
+	emitEvent(e)
+	notifyListeners(false)
 }
 
-func (v *monitorState) Release(force bool) {
-    if !force && v.monitoring {
-        return
-    }
-    if v.key != 0 {
-		v.key.Close()
-        v.key = 0
-	}
-	if v.event != 0 {
-		CloseEvent(&v.event)
-	}
-	if v.log != nil {
-		v.log.Close()
-        v.log = nil
-	}
+func GetLoggingEnabled() bool {
+	monitorMutex.Lock()
+	defer monitorMutex.Unlock()
+	return loggingEnabled
 }
 
-func startMonitor() error {
-	var err error
-    state := &monitorState{}
-	defer state.Release(false)
-	filePath := os.Getenv("APPDATA") + "/appname"
-	if err := os.MkdirAll(filePath, 00770); err != nil {
-		return err
-	}
-	filePath += "/appname.log"
-	state.log, err = os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+func updateProxySettings(firstCall *bool) error {
+	defer func(start time.Time) {
+		metrics.ObserveCheck(time.Since(start))
+	}(time.Now())
+	current, err := readProxySettings()
 	if err != nil {
 		return err
 	}
-	if state.key, err = registry.OpenKey(registry.CURRENT_USER, INET_KEY, registry.NOTIFY); err != nil {
-		return err
-	}
-	state.event, err = CreateEvent()
-	if err != nil {
-		return err
+	enabled, server := current.Enabled, current.Server
+	if *firstCall {
+		proxyEnabled, proxyServer, *firstCall = enabled, server, false
+		logProxyStart()
+	} else if proxyEnabled != enabled || proxyServer != server {
+		previous := &journal.Snapshot{Enabled: proxyEnabled, Server: proxyServer}
+		proxyEnabled, proxyServer = enabled, server
+		logProxyData(previous)
+		saveProxyState(true)
+	} else {
+		refreshProxyState()
 	}
-	state.monitoring = true
-	go monitoring(state)
 	return nil
 }
 
-func monitoring(state *monitorState) {
-	defer state.Release(true)
-	firstCall := true
-	for GetLoggingEnabled() {
-		ret, _, err := winRegNotifyChangeKeyValue.Call(uintptr(state.key), 0, REG_NOTIFY, uintptr(state.event), 1)
-		if ret != uintptr(windows.ERROR_SUCCESS) {
-			InternalError(err)
-			break
-		}
-		err = updateProxySettings(&firstCall, state.log)
-        if err != nil {
-            InternalError(err)
-            break
-        }
-		event, err := WaitForEvents(cancel, state.event)
-		if err != nil {
-			InternalError(err)
-			break
-		}
-		if event == cancel {
-			break
-		}
-	}
-}
-
-func updateProxySettings(firstCall *bool, log *os.File) error {
-	var (
-		enabled    bool
-		server     string
-		err        error
-		enabledInt uint64
-	)
-	var k registry.Key
-	k, err = registry.OpenKey(registry.CURRENT_USER, INET_KEY, registry.QUERY_VALUE)
-	if err != nil {
-		return err
+// takeSnapshot reads the settings on request and writes them to the log as a checkpoint (not a change),
+// the monitoring goroutine still reports the change if they differ from the last record
+func takeSnapshot(origin string) (*journal.Snapshot, error) {
+	if !GetLoggingEnabled() {
+		return nil, errNotMonitoring
 	}
-	defer k.Close()
-	enabledInt, _, err = k.GetIntegerValue("ProxyEnable")
+	current, err := readProxySettings()
 	if err != nil {
-        enabledInt = 0
+		return nil, err
 	}
-	enabled = enabledInt != 0
-	server, _, err = k.GetStringValue("ProxyServer")
-	if err != nil {
-		server = ""
-	}
-	if *firstCall || proxyEnabled != enabled || proxyServer != server {
-		proxyEnabled, proxyServer, *firstCall = enabled, server, false
-		logProxyData(log)
-	}
-	return nil
+	emitEvent(journal.NewSnapshotEvent(journal.SOURCE_USER, current, origin))
+	return &current, nil
 }
 
 func finalizeMonitor() {
-    SetLoggingEnabled(false)
-    if cancel != 0 {
-        CloseEvent(&cancel)
-    }
+    SetLoggingEnabled(false, ORIGIN_EXIT)
+    closeSinks()
+    closeMonitor()
 }
 
 func init() {
     RegisterFinalizer(finalizeMonitor)
-    c, err := CreateEvent()
-    if err != nil {
-        InternalError(err)
-    } else {
-        cancel = c
-    }
 }
@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"AI-Sid/monitor/internal/journal"
+)
+
+const MONITOR_INTERVAL = 5 * time.Second
+
+// there is no registry on Linux, the system-wide proxy variables of environmentFile are polled every
+// MONITOR_INTERVAL. It is a limited source: proxy of desktop settings (gsettings, KDE) and variables of
+// user sessions are not read, the environment of the process is not used, because it never changes
+var proxyVariables = []string{"https_proxy", "HTTPS_PROXY", "http_proxy", "HTTP_PROXY"}
+
+// environmentFile is the file of system-wide variables (pam_env format), tests replace it
+var environmentFile = "/etc/environment"
+
+// stopped is closed to stop the monitoring goroutine, it is changed with locked monitorMutex
+var stopped chan struct{}
+
+func monitorAvailable() bool {
+	return true
+}
+
+func startMonitor() error {
+	if err := openMainLog(); err != nil {
+		return err
+	}
+	stopped = make(chan struct{})
+	go monitoring(stopped)
+	return nil
+}
+
+func monitoring(done chan struct{}) {
+	metrics.SetMonitoring(true)
+	defer metrics.SetMonitoring(false)
+	ticker := time.NewTicker(MONITOR_INTERVAL)
+	defer ticker.Stop()
+	firstCall := true
+	for GetLoggingEnabled() {
+		if err := updateProxySettings(&firstCall); err != nil {
+			InternalError(err)
+			monitoringFailed(err)
+			return
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// readProxySettings reads the first proxy variable of environmentFile which is set, a missing file means no proxy
+func readProxySettings() (journal.Snapshot, error) {
+	vars, err := readEnvironmentFile(environmentFile)
+	if err != nil {
+		return journal.Snapshot{}, err
+	}
+	for _, name := range proxyVariables {
+		if server := vars[name]; server != "" {
+			return journal.Snapshot{Enabled: true, Server: server}, nil
+		}
+	}
+	return journal.Snapshot{}, nil
+}
+
+// readEnvironmentFile parses NAME=value lines, "export" and quotes of values are allowed
+func readEnvironmentFile(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	res := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		res[strings.TrimSpace(key)] = value
+	}
+	return res, scanner.Err()
+}
+
+// stopMonitor signals the monitoring goroutine to exit
+func stopMonitor() error {
+	if stopped != nil {
+		close(stopped)
+		stopped = nil
+	}
+	return nil
+}
+
+func closeMonitor() {
+	// nothing
+}
@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"AI-Sid/monitor/internal/journal"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	INET_KEY   = `SOFTWARE\Microsoft\Windows\CurrentVersion\Internet Settings`
+	REG_NOTIFY = 5 // REG_NOTIFY_CHANGE_NAME | REG_NOTIFY_CHANGE_LAST_SET
+)
+
+var (
+	winRegNotifyChangeKeyValue = GetDllProc("Advapi32.dll", "RegNotifyChangeKeyValue")
+)
+
+var cancel windows.Handle
+
+type monitorState struct {
+    monitoring bool
+    key registry.Key
+    event windows.Handle
+}
+
+func (v *monitorState) Release(force bool) {
+    if !force && v.monitoring {
+        return
+    }
+    if v.key != 0 {
+		v.key.Close()
+        v.key = 0
+	}
+	if v.event != 0 {
+		CloseEvent(&v.event)
+	}
+}
+
+func startMonitor() error {
+	var err error
+    state := &monitorState{}
+	defer state.Release(false)
+	if err = openMainLog(); err != nil {
+		return err
+	}
+	if state.key, err = registry.OpenKey(registry.CURRENT_USER, INET_KEY, registry.NOTIFY); err != nil {
+		return err
+	}
+	state.event, err = CreateEvent()
+	if err != nil {
+		return err
+	}
+	state.monitoring = true
+	go monitoring(state)
+	return nil
+}
+
+func monitoring(state *monitorState) {
+	defer state.Release(true)
+	metrics.SetMonitoring(true)
+	defer metrics.SetMonitoring(false)
+	var failure error
+	defer func() {
+		if failure != nil {
+			InternalError(failure)
+			monitoringFailed(failure)
+		}
+	}()
+	firstCall := true
+	for GetLoggingEnabled() {
+		ret, _, err := winRegNotifyChangeKeyValue.Call(uintptr(state.key), 0, REG_NOTIFY, uintptr(state.event), 1)
+		if ret != uintptr(windows.ERROR_SUCCESS) {
+			failure = err
+			break
+		}
+		err = updateProxySettings(&firstCall)
+        if err != nil {
+            failure = err
+            break
+        }
+		// the registry notification stays armed, the timeout only saves the time of the check
+		var event windows.Handle
+		for event == 0 && err == nil {
+			if event, err = WaitForEventsTimeout(CHECKED_INTERVAL, cancel, state.event); err == nil && event == 0 {
+				refreshProxyState()
+			}
+		}
+		if err != nil {
+			failure = err
+			break
+		}
+		if event == cancel {
+			break
+		}
+	}
+}
+
+// readProxySettings reads the current settings of HKCU
+func readProxySettings() (journal.Snapshot, error) {
+	var (
+		enabledInt uint64
+		err        error
+	)
+	k, err := registry.OpenKey(registry.CURRENT_USER, INET_KEY, registry.QUERY_VALUE)
+	if err != nil {
+		return journal.Snapshot{}, err
+	}
+	defer k.Close()
+	enabledInt, _, err = k.GetIntegerValue("ProxyEnable")
+	if err != nil {
+        enabledInt = 0
+	}
+	server, _, err := k.GetStringValue("ProxyServer")
+	if err != nil {
+		server = ""
+	}
+	return journal.Snapshot{Enabled: enabledInt != 0, Server: server}, nil
+}
+
+func monitorAvailable() bool {
+	return cancel != 0
+}
+
+// stopMonitor signals the monitoring goroutine to exit
+func stopMonitor() error {
+	if cancel != 0 {
+		return windows.SetEvent(cancel)
+	}
+	return nil
+}
+
+func closeMonitor() {
+    if cancel != 0 {
+        CloseEvent(&cancel)
+    }
+}
+
+func init() {
+    c, err := CreateEvent()
+    if err != nil {
+        InternalError(err)
+    } else {
+        cancel = c
+    }
+}
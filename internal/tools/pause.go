@@ -0,0 +1,134 @@
+package tools
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"AI-Sid/monitor/internal/control"
+	"AI-Sid/monitor/internal/journal"
+)
+
+// MAX_PAUSE limits pauses, the monitor must not be forgotten in the stopped state
+const MAX_PAUSE = 24 * time.Hour
+
+var (
+	errNotMonitoring = fmt.Errorf("monitor is not running")
+	errInvalidPause  = fmt.Errorf("pause must be from 1s to %v", MAX_PAUSE)
+)
+
+type pauseState struct {
+	until     time.Time
+	reason    string
+	requester string
+	timer     *time.Timer
+}
+
+var pause *pauseState
+var pauseMutex sync.Mutex
+
+func (v *pauseState) message(d time.Duration) string {
+	msg := fmt.Sprintf("for %v until %v", d, v.until.Format(journal.TIME_FORMAT))
+	if v.requester != "" {
+		msg += " by " + v.requester
+	}
+	if v.reason != "" {
+		msg += ": " + v.reason
+	}
+	return msg
+}
+
+// pauseMonitor stops monitoring for d and starts it again automatically,
+// a new pause replaces the current one
+func pauseMonitor(d time.Duration, origin, reason, requester string) (bool, error) {
+	if d < time.Second || d > MAX_PAUSE {
+		return false, errInvalidPause
+	}
+	p := &pauseState{until: time.Now().Add(d), reason: reason, requester: requester}
+	e := journal.NewLifecycleEvent(journal.EVENT_MONITOR_PAUSED, origin, p.message(d))
+	pauseMutex.Lock()
+	previous := pause
+	if previous == nil && !GetLoggingEnabled() {
+		pauseMutex.Unlock()
+		return false, errNotMonitoring
+	}
+	if previous != nil {
+		previous.timer.Stop()
+	}
+	pause = p
+	p.timer = time.AfterFunc(d, func() { resumeMonitor(p) })
+	pauseMutex.Unlock()
+	if previous != nil {
+		emitEvent(e)
+		notifyPauseListeners()
+		return true, nil
+	}
+	// the mutex is released: state listeners (tray) read the pause
+	changed, err := setLoggingEnabled(false, e)
+	if err == nil && !changed {
+		err = errNotMonitoring
+	}
+	if err != nil {
+		clearPause(p)
+	}
+	return changed, err
+}
+
+func clearPause(p *pauseState) bool {
+	pauseMutex.Lock()
+	defer pauseMutex.Unlock()
+	if pause == nil || (p != nil && pause != p) {
+		return false
+	}
+	pause.timer.Stop()
+	pause = nil
+	return true
+}
+
+// cancelPause is called by start, stop and quit, they replace the pause
+func cancelPause() bool {
+	return clearPause(nil)
+}
+
+func resumeMonitor(p *pauseState) {
+	if clearPause(p) {
+		performAction(ACTION_START, ORIGIN_PAUSE, "resumed after pause")
+	}
+}
+
+// PausedUntil returns the end of the current pause
+func PausedUntil() (time.Time, bool) {
+	pauseMutex.Lock()
+	defer pauseMutex.Unlock()
+	if pause == nil {
+		return time.Time{}, false
+	}
+	return pause.until, true
+}
+
+func currentPause() *control.PauseStatus {
+	pauseMutex.Lock()
+	defer pauseMutex.Unlock()
+	if pause == nil {
+		return nil
+	}
+	return &control.PauseStatus{Until: pause.until, Reason: pause.reason, Requester: pause.requester}
+}
+
+// listeners of pause changes which do not change the monitor state (e.g. a longer pause)
+var pauseListeners []SimpleFunc
+
+func RegisterPauseListener(f SimpleFunc) {
+	pauseMutex.Lock()
+	defer pauseMutex.Unlock()
+	pauseListeners = append(pauseListeners, f)
+}
+
+func notifyPauseListeners() {
+	pauseMutex.Lock()
+	list := append([]SimpleFunc{}, pauseListeners...)
+	pauseMutex.Unlock()
+	for _, f := range list {
+		callSimpleFunc(f)
+	}
+}
@@ -0,0 +1,225 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"AI-Sid/monitor/internal/control"
+	"AI-Sid/monitor/internal/journal"
+)
+
+const CONTROL_TIMEOUT = 10 * time.Second
+
+var controlServer *control.Server
+var controlMutex sync.Mutex
+
+var commandActions = map[string]Action{
+	control.COMMAND_START: ACTION_START,
+	control.COMMAND_STOP:  ACTION_STOP,
+	control.COMMAND_QUIT:  ACTION_QUIT,
+	control.COMMAND_PAUSE: ACTION_PAUSE,
+
+	control.COMMAND_SNAPSHOT: ACTION_SNAPSHOT,
+}
+
+var actionCommands = map[Action]string{
+	ACTION_START: control.COMMAND_START,
+	ACTION_STOP:  control.COMMAND_STOP,
+	ACTION_QUIT:  control.COMMAND_QUIT,
+	ACTION_PAUSE: control.COMMAND_PAUSE,
+
+	ACTION_SNAPSHOT: control.COMMAND_SNAPSHOT,
+}
+
+// startControlServer listens to requests of secondary instances,
+// the primary is still controlled by named events if it fails
+func startControlServer() {
+	if control.DefaultTransport == nil {
+		return
+	}
+	listener, err := control.DefaultTransport.Listen(channelName())
+	if err != nil {
+		InternalError(fmt.Errorf("control channel: %w", err))
+		return
+	}
+	s := control.NewServer(listener, handleRequest)
+	controlMutex.Lock()
+	controlServer = s
+	controlMutex.Unlock()
+	go func() {
+		if err := s.Serve(); err != nil {
+			InternalError(fmt.Errorf("control channel: %w", err))
+		}
+	}()
+}
+
+func stopControlServer() {
+	controlMutex.Lock()
+	s := controlServer
+	controlServer = nil
+	controlMutex.Unlock()
+	if s != nil {
+		s.Close()
+	}
+}
+
+func handleRequest(s *control.Session, req *control.Request) *control.Response {
+	switch req.Command {
+	case control.COMMAND_PING:
+		return control.NewResult(control.PingResult{PID: os.Getpid(), Monitoring: GetLoggingEnabled()})
+	case control.COMMAND_STATUS:
+		return control.NewResult(currentStatus())
+	case control.COMMAND_SUBSCRIBE:
+		return subscribe(s, req)
+	case control.COMMAND_START, control.COMMAND_STOP, control.COMMAND_QUIT, control.COMMAND_PAUSE, control.COMMAND_SNAPSHOT:
+		var args control.ActionArgs
+		if err := req.DecodeArgs(&args); err != nil {
+			return control.NewError(control.ERROR_BAD_REQUEST, "%v", err)
+		}
+		action := commandActions[req.Command]
+		if err := auditAction(s, action); err != nil {
+			return actionError(err)
+		}
+		if action == ACTION_QUIT {
+			// the response is sent before quit, the server is closed on exit
+			s.Send(&control.Response{ID: req.ID, OK: true})
+			performAction(action, ORIGIN_REMOTE, args.Reason)
+			return nil
+		}
+		res, err := executeAction(action, ORIGIN_REMOTE, args)
+		if err != nil {
+			return actionError(err)
+		}
+		return control.NewResult(res)
+	}
+	return control.NewError(control.ERROR_UNKNOWN_COMMAND, "unknown command %q", req.Command)
+}
+
+// exit codes of commands sent to the primary instance
+const (
+	EXIT_OK          = 0
+	EXIT_ERROR       = 1
+	EXIT_NO_PRIMARY  = 2
+	EXIT_REJECTED    = 3
+	EXIT_TIMEOUT     = 4
+	EXIT_FAILED      = 5
+	EXIT_UNCONFIRMED = 6 // sent by named event, the primary can't confirm the result
+)
+
+// ErrNotConfirmed is returned by SendAction if the action is sent, but its result is unknown
+var ErrNotConfirmed = errors.New("main instance does not support control channel, the result is not confirmed")
+
+// ExitCode maps the error of SendAction or RunStatusCommand onto the exit code
+func ExitCode(err error) int {
+	var ce *control.Error
+	switch {
+	case err == nil:
+		return EXIT_OK
+	case errors.Is(err, control.ErrNotRunning):
+		return EXIT_NO_PRIMARY
+	case errors.Is(err, ErrNotConfirmed):
+		return EXIT_UNCONFIRMED
+	case control.IsTimeout(err):
+		return EXIT_TIMEOUT
+	case errors.As(err, &ce) && ce.Code == control.ERROR_REJECTED:
+		return EXIT_REJECTED
+	}
+	return EXIT_FAILED
+}
+
+// executeAction performs actions of the control channel and REST API, except quit
+func executeAction(action Action, origin string, args control.ActionArgs) (*control.ActionResult, error) {
+	res := &control.ActionResult{}
+	var err error
+	switch action {
+	case ACTION_PAUSE:
+		d, e := journal.ParseDuration(args.Duration)
+		if e != nil {
+			return nil, &control.Error{Code: control.ERROR_BAD_REQUEST, Message: fmt.Sprintf("pause duration: %v", e)}
+		}
+		res.Changed, err = pauseMonitor(d, origin, args.Reason, args.Requester)
+	case ACTION_SNAPSHOT:
+		res.Snapshot, err = takeSnapshot(origin)
+	case ACTION_START, ACTION_STOP:
+		res.Changed, err = performAction(action, origin, args.Reason)
+	default:
+		return nil, &control.Error{Code: control.ERROR_BAD_REQUEST, Message: fmt.Sprintf("unsupported action %v", action)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.Monitoring = GetLoggingEnabled()
+	if until, ok := PausedUntil(); ok {
+		res.PausedUntil = &until
+	}
+	return res, nil
+}
+
+func actionError(err error) *control.Response {
+	var ce *control.Error
+	if errors.As(err, &ce) {
+		return &control.Response{Error: ce}
+	}
+	switch {
+	case err == errInvalidPause:
+		return control.NewError(control.ERROR_BAD_REQUEST, "%v", err)
+	case err == errStateLocked, err == errNotMonitoring, errors.Is(err, errClientNotAllowed):
+		return control.NewError(control.ERROR_REJECTED, "%v", err)
+	}
+	return control.NewError(control.ERROR_FAILED, "%v", err)
+}
+
+// requester is sent with actions to be written to the log of the primary
+func requester() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return fmt.Sprintf("pid %d", os.Getpid())
+}
+
+// callPrimary sends one request to the primary instance and waits for the response up to timeout
+func callPrimary(command string, args, result any, timeout time.Duration) error {
+	client, err := control.Dial(control.DefaultTransport, channelName(), timeout)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	client.Timeout = timeout
+	return client.Call(command, args, result)
+}
+
+// sendActionRequest checks that the primary reached the requested state
+func sendActionRequest(action Action, args control.ActionArgs, timeout time.Duration) error {
+	command, ok := actionCommands[action]
+	if !ok {
+		return fmt.Errorf("unknown action %v", action)
+	}
+	args.Requester = requester()
+	var res control.ActionResult
+	if err := callPrimary(command, args, &res, timeout); err != nil {
+		return err
+	}
+	switch {
+	case action == ACTION_PAUSE && (res.Monitoring || res.PausedUntil == nil):
+		return &control.Error{Code: control.ERROR_FAILED, Message: "monitoring is not paused"}
+	case (action == ACTION_START || action == ACTION_STOP) && res.Monitoring != (action == ACTION_START):
+		return &control.Error{Code: control.ERROR_FAILED, Message: "monitoring state is not changed"}
+	}
+	if res.PausedUntil != nil {
+		fmt.Printf("Monitoring is paused until %v\n", res.PausedUntil.Format(journal.TIME_FORMAT))
+	}
+	return nil
+}
+
+// SendPause pauses monitoring of the primary instance for d
+func SendPause(d time.Duration, reason string, timeout time.Duration) error {
+	err := sendActionRequest(ACTION_PAUSE, control.ActionArgs{Reason: reason, Duration: d.String()}, timeout)
+	if errors.Is(err, control.ErrNotRunning) && IsPrimaryRunning() {
+		return fmt.Errorf("main instance does not support pause")
+	}
+	return err
+}
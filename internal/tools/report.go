@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"AI-Sid/monitor/internal/journal"
+)
+
+type ReportArgs struct {
+	Since, Until string
+	Source       string
+	Period       string // day (default) or week
+	HTML         bool
+	Out          string // empty - console
+}
+
+// RunReportCommand prints the summary of history per day or week, as text or HTML.
+// Default range is the last 7 days (4 weeks for weekly report)
+func RunReportCommand(args ReportArgs) error {
+	if args.Period == "" {
+		args.Period = journal.REPORT_DAY
+	}
+	if args.Source == "" {
+		args.Source = journal.SOURCE_USER
+	}
+	until, err := ParseTimeArg(args.Until)
+	if err != nil {
+		return err
+	}
+	if until.IsZero() {
+		until = time.Now()
+	}
+	since, err := ParseTimeArg(args.Since)
+	if err != nil {
+		return err
+	}
+	if since.IsZero() {
+		days := 7
+		if args.Period == journal.REPORT_WEEK {
+			days = 28
+		}
+		y, m, d := until.AddDate(0, 0, -days+1).Date()
+		since = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	}
+	h, err := openHistory(true)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	// all records before the range are needed for the state at its start
+	events, err := h.Query(journal.HistoryQuery{Until: until})
+	if err != nil {
+		return err
+	}
+	report, err := journal.BuildReport(events, args.Source, args.Period, since, until)
+	if err != nil {
+		return err
+	}
+	w := os.Stdout
+	if args.Out != "" {
+		if w, err = os.OpenFile(args.Out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600); err != nil {
+			return err
+		}
+		defer w.Close()
+	}
+	if args.HTML {
+		err = report.WriteHTML(w)
+	} else {
+		err = report.WriteText(w)
+	}
+	if err == nil && args.Out != "" {
+		fmt.Printf("Report written to %v\n", args.Out)
+	}
+	return err
+}
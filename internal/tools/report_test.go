@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"AI-Sid/monitor/internal/journal"
+)
+
+func TestRunReportCommand(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("APPDATA", dir)
+	defer func(c *Config) { config = c }(config)
+	config = defaultConfig()
+	if err := os.MkdirAll(AppDataDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	h, err := journal.OpenHistory(HistoryPath(), false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2026-06-01 is Monday: monitored 08:00-18:00, the proxy is on since 09:00
+	on := journal.Snapshot{Enabled: true, Server: "proxy.local:8080"}
+	events := []*journal.Event{
+		journal.NewLifecycleEvent(journal.EVENT_MONITOR_STARTED, "", ""),
+		journal.NewProxyEvent(journal.SOURCE_USER, journal.Snapshot{}, nil),
+		journal.NewProxyEvent(journal.SOURCE_USER, on, &journal.Snapshot{}),
+		journal.NewLifecycleEvent(journal.EVENT_MONITOR_STOPPED, "", ""),
+	}
+	for i, hour := range []int{8, 8, 9, 18} {
+		events[i].Time = time.Date(2026, 6, 1, hour, 0, 0, 0, time.Local)
+		if err := h.Append(events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.Close()
+
+	tests := []struct {
+		args ReportArgs
+		want []string
+	}{
+		{
+			ReportArgs{Since: "2026-06-01T00:00:00", Until: "2026-06-03T00:00:00"},
+			[]string{
+				"Proxy report for HKCU, 2026-06-01 00:00 .. 2026-06-03 00:00, per day",
+				"2026-06-01 Mon                   9h 00m        1h 00m       14h 00m        1          0        1  8h 00m (00:00)",
+				"2026-06-02 Tue                   0h 00m        0h 00m    1d 00h 00m        0          0        0  1d 00h 00m (00:00)",
+				"Servers:\n  proxy.local:8080\n",
+				"  2026-06-01 18:00 .. 2026-06-03 00:00  1d 06h 00m\n",
+			},
+		},
+		{
+			ReportArgs{Since: "2026-06-01T12:00:00", Until: "2026-06-01T13:00:00", Period: journal.REPORT_WEEK, HTML: true},
+			[]string{"<h2>Proxy report for HKCU</h2>", "<td>2026-06-01 .. 2026-06-07</td>", "<li>proxy.local:8080</li>", "<li>-</li>"},
+		},
+		{
+			ReportArgs{Since: "2026-06-01T00:00:00", Until: "2026-06-02T00:00:00", Source: "HKLM"},
+			[]string{"Proxy report for HKLM", "Servers:\n  -\n"},
+		},
+	}
+	for i, test := range tests {
+		test.args.Out = filepath.Join(dir, "report")
+		if err := RunReportCommand(test.args); err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		data, err := os.ReadFile(test.args.Out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("%d: report has no %q:\n%s", i, want, data)
+			}
+		}
+	}
+
+	for _, args := range []ReportArgs{
+		{Since: "2026-06-02T00:00:00", Until: "2026-06-01T00:00:00"},
+		{Since: "yesterday"},
+		{Period: "month"},
+	} {
+		if err := RunReportCommand(args); err == nil {
+			t.Errorf("%+v: no error", args)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package tools
+
+import (
+	"sync"
+	"time"
+
+	"AI-Sid/monitor/internal/control"
+	"AI-Sid/monitor/internal/schedule"
+)
+
+// SCHEDULE_PERIOD limits the search of the last transition on start and of the next one for -status
+const SCHEDULE_PERIOD = 7 * 24 * time.Hour
+
+var activeSchedule schedule.Schedule
+var scheduleStop chan struct{}
+var scheduleMutex sync.Mutex
+
+// startScheduler issues start and stop by the rules of config, the state of the last
+// transition is restored on start, e.g. the monitor is stopped if it is started after working hours
+func startScheduler() {
+	rules, err := schedule.Compile(config.Schedule)
+	if err != nil {
+		InternalError(err)
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+	if tr := rules.Last(time.Now(), SCHEDULE_PERIOD); tr != nil && tr.Start != GetLoggingEnabled() {
+		applyTransition(tr)
+	}
+	stop := make(chan struct{})
+	scheduleMutex.Lock()
+	activeSchedule, scheduleStop = rules, stop
+	scheduleMutex.Unlock()
+	go runSchedule(rules, stop)
+}
+
+func runSchedule(rules schedule.Schedule, stop chan struct{}) {
+	checked := time.Now().Truncate(time.Minute)
+	for {
+		timer := time.NewTimer(time.Until(checked.Add(time.Minute)))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		now := time.Now().Truncate(time.Minute)
+		if !now.After(checked) {
+			continue
+		}
+		// several minutes are checked after sleep of the computer, the last transition is applied
+		if tr := rules.Last(now, now.Sub(checked)-time.Minute); tr != nil {
+			applyTransition(tr)
+		}
+		checked = now
+	}
+}
+
+func applyTransition(tr *schedule.Transition) {
+	action := ACTION_STOP
+	if tr.Start {
+		action = ACTION_START
+	}
+	performAction(action, ORIGIN_SCHEDULE, "rule "+tr.Rule.String())
+}
+
+func stopScheduler() {
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+	if scheduleStop != nil {
+		close(scheduleStop)
+		scheduleStop = nil
+	}
+}
+
+// scheduleStatus is the next transition for -status, nil if there is no schedule
+func scheduleStatus() *control.ScheduleStatus {
+	scheduleMutex.Lock()
+	rules := activeSchedule
+	scheduleMutex.Unlock()
+	if len(rules) == 0 {
+		return nil
+	}
+	res := &control.ScheduleStatus{Rules: len(rules)}
+	if tr := rules.Next(time.Now(), SCHEDULE_PERIOD); tr != nil {
+		res.Next = &control.TransitionStatus{Time: tr.Time, Action: tr.Action(), Rule: tr.Rule.String()}
+	}
+	return res
+}
@@ -0,0 +1,253 @@
+package tools
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"AI-Sid/monitor/internal/journal"
+)
+
+const (
+	SINK_FILE     = "file"
+	SINK_CONSOLE  = "console"
+	SINK_EVENTLOG = "eventlog"
+	SINK_SYSLOG   = "syslog"
+	SINK_WEBHOOK  = "webhook"
+	SINK_OTLP     = "otlp"
+
+	MAIN_LOG_SINK = "log"
+)
+
+type SinkConfig struct {
+	Type   string               `json:"type"`
+	Name   string               `json:"name,omitempty"`   // for messages, default - type
+	Format string               `json:"format,omitempty"` // text, json, cef or leef; syslog - MSG, webhook - body
+	Filter journal.Filter       `json:"filter"`
+	Buffer int                  `json:"buffer,omitempty"` // events waiting for delivery, newer are dropped
+	Path   string               `json:"path,omitempty"`   // file
+	Source string               `json:"source,omitempty"` // event log source name
+	Chain  journal.ChainOptions `json:"chain"`            // file
+	// file, the key is shared with appname.log
+	Encryption journal.EncryptionOptions `json:"encryption"`
+	journal.RotateOptions
+	journal.SyslogOptions
+	journal.WebhookOptions
+	journal.OTLPOptions
+}
+
+func (v *SinkConfig) name() string {
+	if v.Name != "" {
+		return v.Name
+	}
+	return v.Type
+}
+
+type LogConfig struct {
+	journal.RotateOptions
+	Format     string                    `json:"format,omitempty"`
+	Filter     journal.Filter            `json:"filter"`
+	Chain      journal.ChainOptions      `json:"chain"`
+	Encryption journal.EncryptionOptions `json:"encryption"`
+}
+
+var dispatcher *journal.Dispatcher
+var mainLogOpened bool
+var sinksMutex sync.Mutex
+
+func openSink(cfg SinkConfig) (journal.Sink, error) {
+	switch cfg.Type {
+	case SINK_FILE, SINK_CONSOLE:
+		formatter, err := journal.NewFormatter(cfg.Format)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Type == SINK_CONSOLE {
+			return journal.NewWriterSink(os.Stdout, formatter), nil
+		}
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("file path is not set")
+		}
+		w, err := openLogWriter(cfg.Path, cfg.RotateOptions, cfg.Chain, cfg.Encryption)
+		if err != nil {
+			return nil, err
+		}
+		return journal.NewWriterSink(w, formatter), nil
+	case SINK_EVENTLOG:
+		return journal.OpenEventLog(cfg.Source)
+	case SINK_SYSLOG:
+		if cfg.Format != "" && cfg.Format != journal.FORMAT_TEXT {
+			formatter, err := journal.NewFormatter(cfg.Format)
+			if err != nil {
+				return nil, err
+			}
+			cfg.SyslogOptions.Formatter = formatter
+		}
+		return journal.NewSyslogSink(cfg.SyslogOptions)
+	case SINK_WEBHOOK:
+		if cfg.QueueDir == "" {
+			cfg.QueueDir = webhookQueueDir(cfg.URL)
+		}
+		if cfg.Format != "" && cfg.Format != journal.FORMAT_JSON {
+			formatter, err := journal.NewFormatter(cfg.Format)
+			if err != nil {
+				return nil, err
+			}
+			cfg.WebhookOptions.Formatter = formatter
+		}
+		name := cfg.name()
+		cfg.WebhookOptions.OnError = func(err error) {
+			InternalError(fmt.Errorf("sink %v: %w", name, err))
+		}
+		sealer, err := storeSealer(true)
+		if err != nil {
+			return nil, err
+		}
+		cfg.WebhookOptions.Sealer = sealer
+		return journal.NewWebhookSink(cfg.WebhookOptions)
+	case SINK_OTLP:
+		sinksMutex.Lock()
+		addMetricsSink()
+		sinksMutex.Unlock()
+		return journal.NewOTLPSink(cfg.OTLPOptions, metrics)
+	}
+	return nil, fmt.Errorf("unknown sink type %q", cfg.Type)
+}
+
+// openLogWriter returns the rotating file, wrapped by encryption and hash chain if they are enabled.
+// The chain seals plain records, so it is verified after decryption
+func openLogWriter(path string, rotate journal.RotateOptions, chain journal.ChainOptions, enc journal.EncryptionOptions) (io.WriteCloser, error) {
+	f, err := journal.OpenRotatingFile(path, rotate)
+	if err != nil {
+		return nil, err
+	}
+	var w io.WriteCloser = f
+	var decoders journal.DecoderFactory
+	if enc.Enabled {
+		var decryptor *journal.LineDecryptor
+		key, err := logKey(enc, true)
+		if err == nil {
+			w, err = journal.NewEncryptWriter(f, key, path)
+		}
+		if err == nil {
+			decryptor, err = journal.NewLineDecryptor(key)
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("encryption: %w", err)
+		}
+		decoders = decryptor.Decoder
+	}
+	if !chain.Enabled {
+		return w, nil
+	}
+	key, err := chain.LoadKey()
+	if err == nil {
+		var cw *journal.ChainWriter
+		if cw, err = journal.NewChainWriter(w, key, path, decoders); err == nil {
+			// retention keeps the last link of removed files, so the chain start can be verified
+			checkpoint := path + journal.CHAIN_CHECKPOINT_EXT
+			f.SetRemoveFunc(func(name string) error {
+				return journal.RemoveChainedFile(name, checkpoint, decoders)
+			})
+			return cw, nil
+		}
+	}
+	w.Close()
+	return nil, fmt.Errorf("hash chain: %w", err)
+}
+
+// every webhook gets its own queue, so pending events are not sent to another url after config change
+func webhookQueueDir(url string) string {
+	h := fnv.New32a()
+	h.Write([]byte(url))
+	return filepath.Join(AppDataDir(), "queue", fmt.Sprintf("webhook-%08x", h.Sum32()))
+}
+
+func onSinkError(name string, err error) {
+	// not InternalError: a broken sink must not produce new events for itself
+	fmt.Printf("Sink %v error: %v\n", name, err)
+}
+
+func openSinks() {
+	sinksMutex.Lock()
+	dispatcher = journal.NewDispatcher(onSinkError)
+	sinksMutex.Unlock()
+	if err := openMainLog(); err != nil {
+		InternalError(err)
+	}
+	openHistorySink()
+	addFollowSink()
+	startMetricsServer()
+	for _, cfg := range GetConfig().Sinks {
+		s, err := openSink(cfg)
+		if err != nil {
+			InternalError(fmt.Errorf("sink %v: %w", cfg.name(), err))
+			continue
+		}
+		sinksMutex.Lock()
+		dispatcher.Add(cfg.name(), s, cfg.Filter, cfg.Buffer)
+		sinksMutex.Unlock()
+	}
+}
+
+// openMainLog adds appname.log to sinks, it is called again on every start until the file is opened
+func openMainLog() error {
+	sinksMutex.Lock()
+	defer sinksMutex.Unlock()
+	if mainLogOpened || dispatcher == nil {
+		return nil
+	}
+	cfg := GetConfig().Log
+	formatter, err := journal.NewFormatter(cfg.Format)
+	if err != nil {
+		return err
+	}
+	w, err := openLogWriter(LogFilePath(), cfg.RotateOptions, cfg.Chain, cfg.Encryption)
+	if err != nil {
+		return err
+	}
+	dispatcher.Add(MAIN_LOG_SINK, journal.NewWriterSink(w, formatter), cfg.Filter, 0)
+	mainLogOpened = true
+	return nil
+}
+
+func emitEvent(e *journal.Event) {
+	sinksMutex.Lock()
+	d := dispatcher
+	sinksMutex.Unlock()
+	if d != nil {
+		d.Dispatch(e)
+	}
+}
+
+func closeSinks() {
+	sinksMutex.Lock()
+	d := dispatcher
+	dispatcher, mainLogOpened, metricsSinkAdded = nil, false, false
+	sinksMutex.Unlock()
+	stopMetricsServer()
+	if d != nil {
+		d.Close()
+	}
+}
+
+func eventLogSource() string {
+	for _, cfg := range GetConfig().Sinks {
+		if cfg.Type == SINK_EVENTLOG && cfg.Source != "" {
+			return cfg.Source
+		}
+	}
+	return journal.EVENTLOG_SOURCE
+}
+
+// RegisterEventSource installs or removes the Windows Event Log source used by eventlog sinks
+func RegisterEventSource(install bool) error {
+	if install {
+		return journal.InstallEventSource(eventLogSource())
+	}
+	return journal.RemoveEventSource(eventLogSource())
+}
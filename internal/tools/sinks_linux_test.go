@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"AI-Sid/monitor/internal/journal"
+)
+
+// with log encryption no store under AppDataDir keeps the proxy server as plain text
+func TestEncryptedStores(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("APPDATA", dir)
+	configFile := filepath.Join(dir, "config.json")
+	err := os.WriteFile(configFile, []byte(`{
+		"log": {"encryption": {"enabled": true, "provider": "file"}},
+		"sinks": [{"type": "webhook", "url": "http://127.0.0.1:1/events"}]
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(c *Config) { config = c }(config)
+	if err := LoadConfig(configFile); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { savedState, savedStateRead = nil, false }()
+
+	const server = "secret-proxy.example:3128"
+	openSinks()
+	emitEvent(journal.NewProxyEvent(journal.SOURCE_USER, journal.Snapshot{Enabled: true, Server: server}, nil))
+	proxyEnabled, proxyServer = true, server
+	saveProxyState(true)
+	closeSinks()
+	proxyEnabled, proxyServer = false, ""
+
+	stores := map[string]bool{LOG_FILE_NAME: false, STATE_FILE_NAME: false, HISTORY_FILE_NAME + journal.HISTORY_DATA_EXT: false, "queue": false}
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path == configFile {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(data), "secret-proxy") {
+			t.Errorf("%v has the proxy server as plain text:\n%s", path, data)
+		}
+		name, _ := filepath.Rel(AppDataDir(), path)
+		name = strings.Split(filepath.ToSlash(name), "/")[0]
+		if _, ok := stores[name]; ok && len(data) > 0 {
+			stores[name] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, written := range stores {
+		if !written {
+			t.Errorf("%v is not written", name)
+		}
+	}
+
+	// the stores are readable with the key
+	h, err := openHistory(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if e, err := h.At(time.Now(), journal.SOURCE_USER); err != nil || e == nil || e.Snapshot == nil || e.Snapshot.Server != server {
+		t.Errorf("history record %+v: %v", e, err)
+	}
+	sealer, err := storeSealer(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := journal.ReadSavedState(StateFilePath(), sealer); err != nil || s == nil || s.Snapshot.Server != server {
+		t.Errorf("saved state %+v: %v", s, err)
+	}
+}
@@ -0,0 +1,96 @@
+package tools
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"AI-Sid/monitor/internal/journal"
+)
+
+// CHECKED_INTERVAL is how often the time of the last check is saved while the settings are unchanged,
+// so after a crash or power loss the unmonitored period starts not earlier than this interval ago
+const CHECKED_INTERVAL = time.Minute
+
+// the last observed settings, they are saved to appname.state on every change, stop and CHECKED_INTERVAL
+var (
+	savedState      *journal.SavedState
+	savedStateRead  bool
+	savedStateMutex sync.Mutex
+)
+
+func loadSavedState() *journal.SavedState {
+	if !savedStateRead {
+		savedStateRead = true
+		sealer, err := storeSealer(true)
+		if err == nil {
+			savedState, err = journal.ReadSavedState(StateFilePath(), sealer)
+		}
+		if err != nil {
+			InternalError(fmt.Errorf("state: %w", err))
+		}
+	}
+	return savedState
+}
+
+// logProxyStart writes the first record after start: the settings are compared
+// with the saved ones, because changes made while the monitor was stopped are unknown
+func logProxyStart() {
+	current := journal.Snapshot{Enabled: proxyEnabled, Server: proxyServer}
+	savedStateMutex.Lock()
+	e := loadSavedState().StartEvent(journal.SOURCE_USER, current, time.Now())
+	savedStateMutex.Unlock()
+	emitEvent(e)
+	saveProxyState(e.Type != journal.EVENT_PROXY_UNCHANGED)
+}
+
+// saveProxyState saves the current settings, changed resets the time they were observed first
+func saveProxyState(changed bool) {
+	savedStateMutex.Lock()
+	defer savedStateMutex.Unlock()
+	now := time.Now()
+	if changed || savedState == nil {
+		savedState = &journal.SavedState{
+			Source:   journal.SOURCE_USER,
+			Snapshot: journal.Snapshot{Enabled: proxyEnabled, Server: proxyServer},
+			Since:    now,
+		}
+	}
+	savedState.Checked = now
+	writeSavedState()
+}
+
+// touchProxyState marks the saved settings as current at the moment the monitoring stops
+func touchProxyState() {
+	savedStateMutex.Lock()
+	defer savedStateMutex.Unlock()
+	if savedState == nil {
+		return
+	}
+	savedState.Checked = time.Now()
+	writeSavedState()
+}
+
+// refreshProxyState saves the time of the check if the saved one is older than CHECKED_INTERVAL
+func refreshProxyState() {
+	savedStateMutex.Lock()
+	defer savedStateMutex.Unlock()
+	if savedState == nil {
+		return
+	}
+	if now := time.Now(); now.Sub(savedState.Checked) >= CHECKED_INTERVAL {
+		savedState.Checked = now
+		writeSavedState()
+	}
+}
+
+// with log encryption the state is not written without the key
+func writeSavedState() {
+	sealer, err := storeSealer(true)
+	if err == nil {
+		err = savedState.Write(StateFilePath(), sealer)
+	}
+	if err != nil {
+		InternalError(fmt.Errorf("state: %w", err))
+	}
+}
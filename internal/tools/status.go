@@ -0,0 +1,94 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"AI-Sid/monitor/internal/control"
+	"AI-Sid/monitor/internal/journal"
+)
+
+// currentStatus is the state of the primary instance for -status
+func currentStatus() *control.StatusResult {
+	res := &control.StatusResult{
+		PID:         os.Getpid(),
+		Version:     journal.ProductVersion,
+		Instance:    instanceName,
+		Namespace:   instanceNamespace,
+		Monitoring:  GetLoggingEnabled(),
+		Pause:       currentPause(),
+		NormalState: IsNormalState(),
+		Started:     metrics.Started(),
+		Uptime:      time.Since(metrics.Started()).Seconds(),
+		LogPath:     LogFilePath(),
+		Sources:     make([]control.SourceStatus, 0, 1),
+	}
+	savedStateMutex.Lock()
+	if s := loadSavedState(); s != nil {
+		res.Sources = append(res.Sources, control.SourceStatus{Source: s.Source, Snapshot: s.Snapshot, Since: s.Since, Checked: s.Checked})
+		since := s.Since
+		res.LastChange = &since
+	}
+	savedStateMutex.Unlock()
+	res.Schedule = scheduleStatus()
+	stateMutex.Lock()
+	if lastError != "" {
+		res.LastError = &control.ErrorStatus{Time: lastErrorTime, Message: lastError}
+	}
+	stateMutex.Unlock()
+	return res
+}
+
+func printStatus(s *control.StatusResult) {
+	state := "stopped"
+	if s.Monitoring {
+		state = "running"
+	}
+	if s.Pause != nil {
+		state = fmt.Sprintf("paused until %v (%v left)", s.Pause.Until.Format(journal.TIME_FORMAT), time.Until(s.Pause.Until).Round(time.Second))
+	}
+	fmt.Printf("Monitoring:   %v\n", state)
+	if s.Pause != nil && (s.Pause.Requester != "" || s.Pause.Reason != "") {
+		fmt.Printf("Paused by:    %v %v\n", s.Pause.Requester, s.Pause.Reason)
+	}
+	fmt.Printf("Normal state: %v\n", s.NormalState)
+	fmt.Printf("PID:          %v (version %v)\n", s.PID, s.Version)
+	if s.Instance != "" {
+		fmt.Printf("Instance:     %v (%v)\n", s.Instance, s.Namespace)
+	}
+	fmt.Printf("Started:      %v (uptime %v)\n", s.Started.Format(journal.TIME_FORMAT), (time.Duration(s.Uptime) * time.Second).String())
+	fmt.Printf("Log:          %v\n", s.LogPath)
+	for _, src := range s.Sources {
+		fmt.Printf("%-13v %v (since %v, checked %v)\n", src.Source+":", src.Snapshot, src.Since.Format(journal.TIME_FORMAT), src.Checked.Format(journal.TIME_FORMAT))
+	}
+	if s.LastChange != nil {
+		fmt.Printf("Last change:  %v\n", s.LastChange.Format(journal.TIME_FORMAT))
+	}
+	if s.Schedule != nil {
+		next := "no transitions in a week"
+		if s.Schedule.Next != nil {
+			next = fmt.Sprintf("%v at %v by rule %v", s.Schedule.Next.Action, s.Schedule.Next.Time.Format(journal.TIME_FORMAT), s.Schedule.Next.Rule)
+		}
+		fmt.Printf("Schedule:     %v rules, %v\n", s.Schedule.Rules, next)
+	}
+	if s.LastError != nil {
+		fmt.Printf("Last error:   %v %v\n", s.LastError.Time.Format(journal.TIME_FORMAT), s.LastError.Message)
+	}
+}
+
+// RunStatusCommand asks the primary instance for its state, control.ErrNotRunning is returned if there is no primary
+func RunStatusCommand(asJSON bool, timeout time.Duration) error {
+	var s control.StatusResult
+	if err := callPrimary(control.COMMAND_STATUS, nil, &s, timeout); err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(&s)
+	}
+	printStatus(&s)
+	return nil
+}
@@ -0,0 +1,40 @@
+package tools
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// trayQuit keeps a quit requested before RunTray has started (e.g. by the control channel)
+var trayQuit = make(chan struct{}, 1)
+
+func init() {
+	RegisterQuitFunc(func() {
+		select {
+		case trayQuit <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// there is no tray on Linux, resources are not used
+func SetResourceModule(name string) {
+	// nothing
+}
+
+// RunTray blocks until quit action or termination signal
+func RunTray() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	select {
+	case <-trayQuit:
+	case <-signals:
+		handleAction(ACTION_QUIT, ORIGIN_EXIT)
+		select { // the request of the quit action itself
+		case <-trayQuit:
+		default:
+		}
+	}
+}
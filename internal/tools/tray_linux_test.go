@@ -0,0 +1,34 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+// quit requested before RunTray has started is not lost
+func TestQuitBeforeTray(t *testing.T) {
+	HandleQuitEvent()
+	done := make(chan struct{})
+	go func() {
+		RunTray()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatal("RunTray does not return after quit")
+	}
+	// the request is used once
+	done = make(chan struct{})
+	go func() {
+		RunTray()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("RunTray returns without quit")
+	case <-time.After(100 * time.Millisecond):
+	}
+	HandleQuitEvent()
+	<-done
+}
@@ -3,9 +3,21 @@ package tools
 import (
 	//"os"
     "fmt"
+    "time"
 	"github.com/getlantern/systray"
 )
 
+const TRAY_TOOLTIP = "Proxy Settings Monitor"
+const PAUSE_REFRESH = 30 * time.Second
+
+// trayTooltip distinguishes icons of named instances
+func trayTooltip() string {
+    if instanceName != "" {
+        return TRAY_TOOLTIP + " [" + instanceName + "]"
+    }
+    return TRAY_TOOLTIP
+}
+
 var module *ResourceModule = nil
 
 func SetResourceModule(name string) {
@@ -14,20 +26,51 @@ func SetResourceModule(name string) {
 
 var appIcon []byte
 
-var start, stop, quit *systray.MenuItem
+var start, stop, quit, paused *systray.MenuItem
 
 func onStart() {
 	systray.SetIcon(appIcon)
+	systray.SetTooltip(trayTooltip())
+	paused = systray.AddMenuItem("", "Monitoring is resumed automatically")
+	paused.Disable()
+	paused.Hide()
 	start = systray.AddMenuItem("Start", "Start Proxy Settings Monitoring")
 	stop = systray.AddMenuItem("Stop", "Stop Proxy Settings Monitoring")
 	systray.AddSeparator()
 	quit = systray.AddMenuItem("Quit", "Quit Proxy Settings Monitor")
     RegisterLoggingStateListener(trayLoggingModified)
+    RegisterPauseListener(trayPauseModified)
     trayLoggingModified(GetLoggingEnabled())
     go handleTray()
+    go refreshPause()
+}
+
+// trayPauseModified shows the remaining time of the pause
+func trayPauseModified() {
+    until, ok := PausedUntil()
+    if !ok {
+        paused.Hide()
+        systray.SetTooltip(trayTooltip())
+        return
+    }
+    left := time.Until(until).Round(time.Minute)
+    if left < time.Minute {
+        left = time.Minute
+    }
+    text := fmt.Sprintf("Paused, %v left (until %v)", left, until.Format("15:04"))
+    paused.SetTitle(text)
+    paused.Show()
+    systray.SetTooltip(trayTooltip() + ": " + text)
+}
+
+func refreshPause() {
+    for range time.Tick(PAUSE_REFRESH) {
+        trayPauseModified()
+    }
 }
 
 func trayLoggingModified(enabled bool) {
+    trayPauseModified()
     if enabled {
         start.Disable()
         stop.Enable()
@@ -41,11 +84,11 @@ func handleTray() {
     for {
         select {
         case <- start.ClickedCh:
-            SendAction(ACTION_START)
+            handleAction(ACTION_START, ORIGIN_TRAY)
         case <- stop.ClickedCh:
-            SendAction(ACTION_STOP)
+            handleAction(ACTION_STOP, ORIGIN_TRAY)
         case <- quit.ClickedCh:
-            SendAction(ACTION_QUIT)
+            handleAction(ACTION_QUIT, ORIGIN_TRAY)
             return
         }
     }
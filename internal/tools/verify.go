@@ -0,0 +1,64 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"AI-Sid/monitor/internal/journal"
+)
+
+// RunVerifyCommand checks the hash chain of log files (default - appname.log with
+// rotated files, its anchor and checkpoint), returns false if the chain is broken or its start
+// can't be verified
+func RunVerifyCommand(files []string) (bool, error) {
+	cfg := GetConfig().Log.Chain
+	key, err := cfg.LoadKey()
+	if err != nil {
+		return false, err
+	}
+	var anchor, checkpoint *journal.ChainAnchor
+	if len(files) == 0 {
+		if files, err = journal.LogFiles(LogFilePath()); err != nil {
+			return false, err
+		}
+		anchor, err = journal.ReadChainAnchor(LogFilePath() + journal.CHAIN_ANCHOR_EXT)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+		checkpoint, err = journal.ReadChainAnchor(LogFilePath() + journal.CHAIN_CHECKPOINT_EXT)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+	}
+	if len(files) == 0 {
+		return false, fmt.Errorf("no log files found")
+	}
+	decode, err := logDecoder(GetConfig().Log.Encryption)
+	if err != nil {
+		return false, err
+	}
+	report, err := journal.VerifyChain(files, key, anchor, checkpoint, decode)
+	if err != nil {
+		return false, err
+	}
+	if report.Legacy > 0 {
+		fmt.Printf("%d records written before the chain start\n", report.Legacy)
+	}
+	if report.FirstSeq > 1 && report.Problem == nil {
+		fmt.Printf("Chain starts at record %d, checkpoint of removed files is verified\n", report.FirstSeq)
+	}
+	if anchor == nil {
+		fmt.Println("Anchor is not used, truncation of the last records can't be detected")
+	}
+	if report.Problem != nil {
+		fmt.Printf("FAILED after %d records: %v\n", report.Records, report.Problem)
+		return false, nil
+	}
+	if report.Records == 0 {
+		fmt.Println("FAILED: no sealed records found")
+		return false, nil
+	}
+	fmt.Printf("OK: %d records, chain %d..%d\n", report.Records, report.FirstSeq, report.LastSeq)
+	return true, nil
+}